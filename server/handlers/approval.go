@@ -0,0 +1,818 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"dootask-kpi-server/models"
+	"dootask-kpi-server/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 审批人确定方式
+const (
+	approvalResolverManager          = "manager"            // 直属上级
+	approvalResolverManagerOfManager = "manager_of_manager" // 直属上级的上级
+	approvalResolverDepartmentHead   = "department_head"    // 部门负责人（本部门主管角色）
+	approvalResolverRole             = "role"               // 指定角色的所有在职员工
+)
+
+// 审批步骤操作
+const (
+	approvalActionScore   = "score"   // 审批人为各考核项目评分
+	approvalActionApprove = "approve" // 审批人仅审批通过或退回
+)
+
+// 审批人确定方式的默认步骤名称
+var approvalResolverNames = map[string]string{
+	approvalResolverManager:          "直属上级",
+	approvalResolverManagerOfManager: "上级的上级",
+	approvalResolverDepartmentHead:   "部门负责人",
+	approvalResolverRole:             "指定角色",
+}
+
+// 审批链请求结构
+type ApprovalChainRequest struct {
+	Name         string                `json:"name" binding:"required"`
+	TemplateID   *uint                 `json:"template_id"`   // 为空表示适用所有模板
+	DepartmentID *uint                 `json:"department_id"` // 为空表示适用所有部门
+	Steps        []models.ApprovalStep `json:"steps"`
+	IsActive     *bool                 `json:"is_active"`
+}
+
+// 处理审批步骤请求结构
+type ApprovalActionRequest struct {
+	Action  string                     `json:"action" binding:"required,oneof=approve return"` // approve: 通过, return: 退回主管重新评分
+	Comment string                     `json:"comment"`
+	Scores  []models.ApprovalItemScore `json:"scores"` // 评分步骤通过时需为每个考核项目评分
+}
+
+// 评估当前的审批状态
+type EvaluationApprovalState struct {
+	Step       *models.EvaluationApproval `json:"step"`         // 当前待处理的审批步骤
+	CanAct     bool                       `json:"can_act"`      // 当前用户能否处理
+	OnBehalfOf *uint                      `json:"on_behalf_of"` // 当前用户以受托人身份处理时被代理的审批人
+}
+
+// resolveApprovalChain 返回评估适用的审批链：模板和部门都匹配的优先，其次为模板、部门，最后为组织默认
+func resolveApprovalChain(db *gorm.DB, evaluation *models.KPIEvaluation) (*models.ApprovalChain, error) {
+	var chains []models.ApprovalChain
+	if err := db.Where("is_active = ?", true).
+		Where("template_id IS NULL OR template_id = ?", evaluation.TemplateID).
+		Where("department_id IS NULL OR department_id = ?", evaluation.Employee.DepartmentID).
+		Find(&chains).Error; err != nil {
+		return nil, err
+	}
+
+	var best *models.ApprovalChain
+	bestRank := -1
+	for i := range chains {
+		rank := 0
+		if chains[i].TemplateID != nil {
+			rank += 2
+		}
+		if chains[i].DepartmentID != nil {
+			rank++
+		}
+		if rank > bestRank {
+			best, bestRank = &chains[i], rank
+		}
+	}
+	return best, nil
+}
+
+// resolveStepApprovers 按步骤配置确定审批人，被评估员工本人不能审批自己的评估
+func resolveStepApprovers(db *gorm.DB, employee *models.Employee, step models.ApprovalStep) []uint {
+	var candidates []models.Employee
+	switch step.Resolver {
+	case approvalResolverManager:
+		if employee.ManagerID != nil {
+			db.Where("id = ? AND is_active = ?", *employee.ManagerID, true).Find(&candidates)
+		}
+	case approvalResolverManagerOfManager:
+		if employee.ManagerID != nil {
+			db.Where("id = (SELECT manager_id FROM employees WHERE id = ?) AND is_active = ?", *employee.ManagerID, true).Find(&candidates)
+		}
+	case approvalResolverDepartmentHead:
+		db.Where("department_id = ? AND role = ? AND is_active = ?", employee.DepartmentID, "manager", true).Find(&candidates)
+	case approvalResolverRole:
+		db.Where("role = ? AND is_active = ?", step.Role, true).Find(&candidates)
+	}
+
+	approvers := make([]uint, 0, len(candidates))
+	for _, candidate := range candidates {
+		if candidate.ID != employee.ID {
+			approvers = append(approvers, candidate.ID)
+		}
+	}
+	return approvers
+}
+
+// startApprovalChain 主管提交评分后按适用的审批链生成本轮审批步骤，返回第一个待处理的步骤
+// 找不到审批人的步骤直接跳过；没有适用的审批链或所有步骤都被跳过时返回 nil，评估直接进入待HR审核
+// evaluation 需预加载 Employee
+func startApprovalChain(tx *gorm.DB, evaluation *models.KPIEvaluation) (*models.EvaluationApproval, error) {
+	chain, err := resolveApprovalChain(tx, evaluation)
+	if err != nil || chain == nil || len(chain.Steps) == 0 {
+		return nil, err
+	}
+
+	var round int
+	if err := tx.Model(&models.EvaluationApproval{}).Where("evaluation_id = ?", evaluation.ID).
+		Select("COALESCE(MAX(round), 0)").Scan(&round).Error; err != nil {
+		return nil, err
+	}
+	round++
+
+	approvals := make([]models.EvaluationApproval, 0, len(chain.Steps))
+	firstPending := -1
+	for i, step := range chain.Steps {
+		approval := models.EvaluationApproval{
+			EvaluationID: evaluation.ID,
+			ChainID:      chain.ID,
+			Round:        round,
+			StepOrder:    i + 1,
+			StepName:     step.Name,
+			Resolver:     step.Resolver,
+			Role:         step.Role,
+			Action:       step.Action,
+			ApproverIDs:  resolveStepApprovers(tx, &evaluation.Employee, step),
+			Status:       "waiting",
+		}
+		if len(approval.ApproverIDs) == 0 {
+			approval.Status = "skipped"
+		} else if firstPending < 0 {
+			approval.Status = "pending"
+			firstPending = i
+		}
+		approvals = append(approvals, approval)
+	}
+	if err := tx.Create(&approvals).Error; err != nil {
+		return nil, err
+	}
+	if firstPending < 0 {
+		return nil, nil
+	}
+	return &approvals[firstPending], nil
+}
+
+// currentApprovalStep 返回评估当前待处理的审批步骤，没有时返回 nil
+func currentApprovalStep(evaluationID uint) *models.EvaluationApproval {
+	var step models.EvaluationApproval
+	result := models.DB.Where("evaluation_id = ? AND status = ?", evaluationID, "pending").Order("round DESC, step_order").Limit(1).Find(&step)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil
+	}
+	return &step
+}
+
+// approvalPending 评估是否还有未完成的审批步骤
+func approvalPending(evaluationID uint) bool {
+	return currentApprovalStep(evaluationID) != nil
+}
+
+// cancelPendingApprovals 取消评估未完成的审批步骤
+func cancelPendingApprovals(tx *gorm.DB, evaluationID uint) error {
+	return tx.Model(&models.EvaluationApproval{}).
+		Where("evaluation_id = ? AND status IN ?", evaluationID, []string{"waiting", "pending"}).
+		Update("status", "cancelled").Error
+}
+
+// approvalActor 检查用户能否处理审批步骤：审批人本人、审批人委托期间的受托人，或HR（仅在审批人均已离职、步骤无法审批时代为处理）
+// 受托人处理时返回被代理的审批人ID
+func approvalActor(step *models.EvaluationApproval, evaluation *models.KPIEvaluation, user *models.Employee) (bool, *uint) {
+	if evaluation.EmployeeID == user.ID {
+		return false, nil
+	}
+	for _, approverID := range step.ApproverIDs {
+		if approverID == user.ID {
+			return true, nil
+		}
+	}
+	now := time.Now()
+	for _, approverID := range step.ApproverIDs {
+		if activeReviewDelegation(approverID, user.ID, now) != nil {
+			id := approverID
+			return true, &id
+		}
+	}
+	return user.Role == "hr" && !hasActiveApprover(step.ApproverIDs), nil
+}
+
+// hasActiveApprover 审批人中是否还有在职员工
+func hasActiveApprover(approverIDs []uint) bool {
+	if len(approverIDs) == 0 {
+		return false
+	}
+	var count int64
+	models.DB.Model(&models.Employee{}).Where("id IN ? AND is_active = ?", approverIDs, true).Count(&count)
+	return count > 0
+}
+
+// evaluationApprovalState 返回评估当前的审批步骤及当前用户能否处理
+func evaluationApprovalState(evaluation *models.KPIEvaluation, user *models.Employee) *EvaluationApprovalState {
+	if evaluation.Status != "manager_evaluated" {
+		return nil
+	}
+	step := currentApprovalStep(evaluation.ID)
+	if step == nil {
+		return nil
+	}
+	canAct, onBehalfOf := approvalActor(step, evaluation, user)
+	return &EvaluationApprovalState{Step: step, CanAct: canAct, OnBehalfOf: onBehalfOf}
+}
+
+// pendingApprovalsFor 返回用户可处理的审批步骤，HR另可看到审批人均已离职的步骤
+func pendingApprovalsFor(user *models.Employee) ([]models.EvaluationApproval, error) {
+	var steps []models.EvaluationApproval
+	if err := models.DB.Preload("Evaluation.Employee.Department").Preload("Evaluation.Template").
+		Where("status = ?", "pending").Order("created_at").Find(&steps).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]models.EvaluationApproval, 0, len(steps))
+	for _, step := range steps {
+		if step.Evaluation == nil || step.Evaluation.Status != "manager_evaluated" {
+			continue
+		}
+		if canAct, _ := approvalActor(&step, step.Evaluation, user); canAct {
+			result = append(result, step)
+		}
+	}
+	return result, nil
+}
+
+// approvalStepLabel 审批步骤的显示名称，如“第2步 部门负责人”
+func approvalStepLabel(step *models.EvaluationApproval) string {
+	return fmt.Sprintf("第%d步 %s", step.StepOrder, step.StepName)
+}
+
+// notifyApprovalStepPending 审批步骤进入待处理时通知审批人及其受托人（DooTask 机器人通知 + 实时通知）
+// evaluation 需预加载 Employee 和 Template
+func notifyApprovalStepPending(dooTaskToken string, operatorID uint, evaluation *models.KPIEvaluation, step *models.EvaluationApproval) {
+	dooTaskClient := utils.NewDooTaskClient(dooTaskToken)
+	periodValue := utils.GetPeriodValue(evaluation.Period, evaluation.Year, evaluation.Month, evaluation.Quarter)
+	appConfigJSON := utils.BuildKPIAppConfig(evaluation.ID)
+
+	actionText := "审批"
+	if step.Action == approvalActionScore {
+		actionText = "评分"
+	}
+	now := time.Now()
+	for _, approverID := range step.ApproverIDs {
+		var approver models.Employee
+		if err := models.DB.First(&approver, approverID).Error; err != nil {
+			continue
+		}
+		recipients := append([]models.Employee{approver}, activeDelegatesOf(approverID, now)...)
+		for _, recipient := range recipients {
+			if recipient.DooTaskUserID == nil {
+				continue
+			}
+			delegateLine := ""
+			if recipient.ID != approver.ID {
+				delegateLine = fmt.Sprintf("\n- 委托人：%s", approver.Name)
+			}
+			message := fmt.Sprintf(
+				"**你有一条绩效考核待%s**\n- 考核模板：%s\n- 考核周期：%s\n- 部门员工：%s\n- 审批步骤：%s%s\n\n> <div class=\"open-micro-app\" data-app-config='%s'>查看详情：点击查看详情</div>",
+				actionText,
+				evaluation.Template.Name,
+				periodValue,
+				evaluation.Employee.Name,
+				approvalStepLabel(step),
+				delegateLine,
+				appConfigJSON,
+			)
+			_ = dooTaskClient.SendBotMessage(recipient.DooTaskUserID, message)
+		}
+	}
+
+	GetNotificationService().SendNotification(operatorID, EventApprovalStepPending, step)
+}
+
+// validateApprovalChain 校验审批链：至少一个步骤，审批人确定方式和操作有效，同一适用范围只能有一条审批链
+func validateApprovalChain(req *ApprovalChainRequest, chainID uint) ([]models.ApprovalStep, error) {
+	if req.TemplateID != nil {
+		var template models.KPITemplate
+		if err := models.DB.First(&template, *req.TemplateID).Error; err != nil {
+			return nil, fmt.Errorf("模板不存在")
+		}
+	}
+	if req.DepartmentID != nil {
+		var department models.Department
+		if err := models.DB.First(&department, *req.DepartmentID).Error; err != nil {
+			return nil, fmt.Errorf("部门不存在")
+		}
+	}
+	if len(req.Steps) == 0 {
+		return nil, fmt.Errorf("审批链至少需要一个步骤")
+	}
+
+	steps := make([]models.ApprovalStep, 0, len(req.Steps))
+	for i, step := range req.Steps {
+		step.Name = strings.TrimSpace(step.Name)
+		step.Role = strings.TrimSpace(step.Role)
+		defaultName, ok := approvalResolverNames[step.Resolver]
+		if !ok {
+			return nil, fmt.Errorf("第%d步的审批人确定方式无效", i+1)
+		}
+		if step.Resolver == approvalResolverRole {
+			if step.Role == "" {
+				return nil, fmt.Errorf("第%d步需指定审批角色", i+1)
+			}
+		} else {
+			step.Role = ""
+		}
+		if step.Action == "" {
+			step.Action = approvalActionApprove
+		}
+		if step.Action != approvalActionScore && step.Action != approvalActionApprove {
+			return nil, fmt.Errorf("第%d步的操作无效，只能为评分或审批", i+1)
+		}
+		if step.Name == "" {
+			step.Name = defaultName
+			if step.Resolver == approvalResolverRole {
+				step.Name = fmt.Sprintf("%s审批", step.Role)
+			}
+		}
+		steps = append(steps, step)
+	}
+
+	query := models.DB.Model(&models.ApprovalChain{}).Where("id <> ?", chainID)
+	if req.TemplateID != nil {
+		query = query.Where("template_id = ?", *req.TemplateID)
+	} else {
+		query = query.Where("template_id IS NULL")
+	}
+	if req.DepartmentID != nil {
+		query = query.Where("department_id = ?", *req.DepartmentID)
+	} else {
+		query = query.Where("department_id IS NULL")
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("该模板和部门范围已配置审批链")
+	}
+	return steps, nil
+}
+
+// 获取审批链列表
+func GetApprovalChains(c *gin.Context) {
+	query := models.DB.Preload("Template").Preload("Department")
+	if templateID := c.Query("template_id"); templateID != "" {
+		query = query.Where("template_id = ?", templateID)
+	}
+	if departmentID := c.Query("department_id"); departmentID != "" {
+		query = query.Where("department_id = ?", departmentID)
+	}
+
+	var chains []models.ApprovalChain
+	if err := query.Order("id").Find(&chains).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取审批链失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  chains,
+		"total": len(chains),
+	})
+}
+
+// 创建审批链
+func CreateApprovalChain(c *gin.Context) {
+	var req ApprovalChainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	steps, err := validateApprovalChain(&req, 0)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	chain := models.ApprovalChain{
+		Name:         strings.TrimSpace(req.Name),
+		TemplateID:   req.TemplateID,
+		DepartmentID: req.DepartmentID,
+		Steps:        steps,
+		IsActive:     req.IsActive == nil || *req.IsActive,
+	}
+	if err := models.DB.Create(&chain).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "创建审批链失败",
+			"message": err.Error(),
+		})
+		return
+	}
+	// is_active 默认值为 true，显式停用时需单独更新
+	if !chain.IsActive {
+		models.DB.Model(&chain).Update("is_active", false)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "审批链创建成功",
+		"data":    chain,
+	})
+}
+
+// 更新审批链，已进入审批的评估按生成时的步骤继续
+func UpdateApprovalChain(c *gin.Context) {
+	chainId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的审批链ID",
+		})
+		return
+	}
+
+	var chain models.ApprovalChain
+	if err := models.DB.First(&chain, chainId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "审批链不存在",
+		})
+		return
+	}
+
+	var req ApprovalChainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	steps, err := validateApprovalChain(&req, chain.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	chain.Name = strings.TrimSpace(req.Name)
+	chain.TemplateID = req.TemplateID
+	chain.DepartmentID = req.DepartmentID
+	chain.Steps = steps
+	if req.IsActive != nil {
+		chain.IsActive = *req.IsActive
+	}
+	if err := models.DB.Save(&chain).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "更新审批链失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "审批链更新成功",
+		"data":    chain,
+	})
+}
+
+// 删除审批链，已进入审批的评估按生成时的步骤继续
+func DeleteApprovalChain(c *gin.Context) {
+	chainId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的审批链ID",
+		})
+		return
+	}
+
+	result := models.DB.Delete(&models.ApprovalChain{}, chainId)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "删除审批链失败",
+			"message": result.Error.Error(),
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "审批链不存在",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "审批链删除成功",
+	})
+}
+
+// 获取评估的审批记录（所有轮次）及当前待处理的步骤
+func GetEvaluationApprovals(c *gin.Context) {
+	evaluationId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的评估ID",
+		})
+		return
+	}
+
+	var evaluation models.KPIEvaluation
+	if err := models.DB.Preload("Employee").First(&evaluation, evaluationId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "评估不存在",
+		})
+		return
+	}
+
+	var user models.Employee
+	if err := models.DB.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "用户不存在",
+		})
+		return
+	}
+
+	var approvals []models.EvaluationApproval
+	if err := models.DB.Preload("ActedBy").Where("evaluation_id = ?", evaluation.ID).Order("round, step_order").Find(&approvals).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取审批记录失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":    approvals,
+		"current": evaluationApprovalState(&evaluation, &user),
+	})
+}
+
+// 获取当前用户待处理的审批步骤
+func GetPendingApprovals(c *gin.Context) {
+	var user models.Employee
+	if err := models.DB.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "用户不存在",
+		})
+		return
+	}
+
+	steps, err := pendingApprovalsFor(&user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取待审批记录失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  steps,
+		"total": len(steps),
+	})
+}
+
+// 处理评估当前的审批步骤：通过后进入下一步骤，全部通过后进入待HR审核；退回时评估回到待主管评估
+func ActOnEvaluationApproval(c *gin.Context) {
+	evaluationId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的评估ID",
+		})
+		return
+	}
+
+	var req ApprovalActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+	req.Comment = strings.TrimSpace(req.Comment)
+
+	var evaluation models.KPIEvaluation
+	if err := models.DB.Preload("Employee").Preload("Scores").First(&evaluation, evaluationId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "评估不存在",
+		})
+		return
+	}
+	applyItemSnapshots(evaluation.Scores)
+
+	var operator models.Employee
+	if err := models.DB.First(&operator, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "用户不存在",
+		})
+		return
+	}
+
+	step := currentApprovalStep(evaluation.ID)
+	if evaluation.Status != "manager_evaluated" || step == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "评估没有待处理的审批步骤",
+		})
+		return
+	}
+	canAct, onBehalfOf := approvalActor(step, &evaluation, &operator)
+	if !canAct {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": fmt.Sprintf("无权处理审批步骤：%s", approvalStepLabel(step)),
+		})
+		return
+	}
+
+	// 退回需说明原因；评分步骤通过时需为每个考核项目评分，按计分方式计算该步骤的总分
+	var stepScore *float64
+	if req.Action == "return" && req.Comment == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请填写退回原因",
+		})
+		return
+	}
+	if req.Action == "approve" && step.Action == approvalActionScore {
+		values := make(map[uint]float64, len(req.Scores))
+		for _, entry := range req.Scores {
+			values[entry.ScoreID] = entry.Score
+		}
+		projected := make([]models.KPIScore, len(evaluation.Scores))
+		var errs []ScoreValidationError
+		for i, score := range evaluation.Scores {
+			value, ok := values[score.ID]
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": fmt.Sprintf("请为「%s」评分", score.Item.Name),
+				})
+				return
+			}
+			errs = append(errs, validateScore(&evaluation.Scores[i], "score", &value, req.Comment)...)
+			projected[i] = score
+			projected[i].FinalScore = &value
+			delete(values, score.ID)
+		}
+		if len(errs) > 0 {
+			respondScoreValidationErrors(c, errs)
+			return
+		}
+		if len(values) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "部分评分记录不属于该评估",
+			})
+			return
+		}
+		total, _ := evaluationTotalScore(&evaluation, projected)
+		stepScore = &total
+	} else {
+		req.Scores = nil
+	}
+
+	now := time.Now()
+	status := "approved"
+	if req.Action == "return" {
+		status = "returned"
+	}
+	result := fmt.Sprintf("%s：通过", approvalStepLabel(step))
+	if stepScore != nil {
+		result = fmt.Sprintf("%s：评分通过，总分%s", approvalStepLabel(step), formatScore(*stepScore))
+	}
+	if req.Action == "return" {
+		result = fmt.Sprintf("%s：退回，原因：%s", approvalStepLabel(step), req.Comment)
+	}
+
+	history := newHistoryRecorder(evaluation.ID, operator.ID, historySourceApproval)
+	history.change("approval", "", result)
+
+	var next *models.EvaluationApproval
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		updated := tx.Model(&models.EvaluationApproval{}).Where("id = ? AND status = ?", step.ID, "pending").Updates(models.EvaluationApproval{
+			Status:       status,
+			ItemScores:   req.Scores,
+			Score:        stepScore,
+			Comment:      req.Comment,
+			ActedByID:    &operator.ID,
+			OnBehalfOfID: onBehalfOf,
+			ActedAt:      &now,
+		})
+		if updated.Error != nil {
+			return updated.Error
+		}
+		if updated.RowsAffected == 0 {
+			return errApprovalConflict
+		}
+
+		if req.Action == "return" {
+			if err := cancelPendingApprovals(tx, evaluation.ID); err != nil {
+				return err
+			}
+			moved := tx.Model(&models.KPIEvaluation{}).Where("id = ? AND status = ?", evaluation.ID, "manager_evaluated").Update("status", "self_evaluated")
+			if moved.Error != nil {
+				return moved.Error
+			}
+			if moved.RowsAffected == 0 {
+				return errApprovalConflict
+			}
+			history.change("status", "manager_evaluated", "self_evaluated")
+			return history.save(tx)
+		}
+
+		// 通过：本轮下一个未开始的步骤进入待处理
+		var candidate models.EvaluationApproval
+		found := tx.Where("evaluation_id = ? AND round = ? AND step_order > ? AND status = ?", evaluation.ID, step.Round, step.StepOrder, "waiting").
+			Order("step_order").Limit(1).Find(&candidate)
+		if found.Error != nil {
+			return found.Error
+		}
+		if found.RowsAffected > 0 {
+			if err := tx.Model(&candidate).Update("status", "pending").Error; err != nil {
+				return err
+			}
+			candidate.Status = "pending"
+			next = &candidate
+		}
+		return history.save(tx)
+	})
+	if errors.Is(err, errApprovalConflict) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "审批步骤已被处理，请刷新后重试",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "处理审批失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// 自动评论记录审批结果（受托人处理时署名为“X 代 Y”）
+	if err := createAutoCommentOnBehalf(evaluation.ID, operator.ID, onBehalfOf, result); err != nil {
+		fmt.Printf("创建审批自动评论失败: %v\n", err)
+	}
+
+	dooTaskToken := c.GetHeader("DooTaskAuth")
+	models.DB.Preload("Employee.Manager").Preload("Template").First(&evaluation, evaluation.ID)
+	message := "审批已通过"
+	switch {
+	case req.Action == "return":
+		// 退回：通知直属上级重新评分
+		message = "已退回主管重新评分"
+		if evaluation.Employee.Manager != nil && evaluation.Employee.Manager.DooTaskUserID != nil {
+			periodValue := utils.GetPeriodValue(evaluation.Period, evaluation.Year, evaluation.Month, evaluation.Quarter)
+			appConfigJSON := utils.BuildKPIAppConfig(evaluation.ID)
+			text := fmt.Sprintf(
+				"**绩效考核审批被退回，请重新评分**\n- 考核模板：%s\n- 考核周期：%s\n- 部门员工：%s\n- 审批步骤：%s\n- 原因：%s\n\n> <div class=\"open-micro-app\" data-app-config='%s'>查看详情：点击查看详情</div>",
+				evaluation.Template.Name,
+				periodValue,
+				evaluation.Employee.Name,
+				approvalStepLabel(step),
+				req.Comment,
+				appConfigJSON,
+			)
+			dooTaskClient := utils.NewDooTaskClient(dooTaskToken)
+			_ = dooTaskClient.SendBotMessage(evaluation.Employee.Manager.DooTaskUserID, text)
+		}
+		GetNotificationService().SendNotificationOnBehalf(operator.ID, onBehalfOf, EventEvaluationStatusChange, &evaluation)
+	case next != nil:
+		notifyApprovalStepPending(dooTaskToken, operator.ID, &evaluation, next)
+		GetNotificationService().SendNotificationOnBehalf(operator.ID, onBehalfOf, EventEvaluationUpdated, &evaluation)
+	case tryAutoConfirmEvaluation(evaluation.ID):
+		// 审批全部通过且绩效规则自动审核
+		message = "审批已全部通过，已按绩效规则完成审核"
+		models.DB.Preload("Employee.Manager").Preload("Template").First(&evaluation, evaluation.ID)
+		notifyEvaluationStatusChanged(dooTaskToken, &operator, nil, &evaluation, "pending_confirm")
+		GetNotificationService().SendNotification(operator.ID, EventEvaluationStatusChange, &evaluation)
+	default:
+		// 审批全部通过：通知HR审核
+		message = "审批已全部通过，等待HR审核"
+		notifyHRReviewPending(dooTaskToken, &evaluation, "\n- 审批：已全部通过")
+		GetNotificationService().SendNotificationOnBehalf(operator.ID, onBehalfOf, EventEvaluationUpdated, &evaluation)
+	}
+
+	var approvals []models.EvaluationApproval
+	models.DB.Preload("ActedBy").Where("evaluation_id = ?", evaluation.ID).Order("round, step_order").Find(&approvals)
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"data":    approvals,
+		"status":  evaluation.Status,
+	})
+}
+
+// errApprovalConflict 审批步骤或评估状态已被其他操作改变
+var errApprovalConflict = errors.New("approval conflict")
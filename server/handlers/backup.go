@@ -305,14 +305,35 @@ func generateSQLBackup(w io.Writer) error {
 		"departments",
 		"employees",
 		"kpi_templates",
+		"template_versions",
+		"template_version_items",
+		"template_assignments",
 		"kpi_items",
 		"kpi_evaluations",
 		"kpi_scores",
 		"evaluation_comments",
+		"evaluation_histories",
+		"evaluation_reminders",
+		"evaluation_escalations",
+		"review_delegations",
 		"evaluation_invitations",
 		"invited_scores",
 		"system_settings",
 		"performance_rules",
+		"performance_rule_versions",
+		"evaluation_schedules",
+		"evaluation_schedule_runs",
+		"objectives",
+		"key_results",
+		"key_result_check_ins",
+		"evaluation_goals",
+		"grade_bands",
+		"distribution_quotas",
+		"calibration_sessions",
+		"calibration_evaluations",
+		"calibration_adjustments",
+		"approval_chains",
+		"evaluation_approvals",
 	}
 
 	// 写入备份头部信息
@@ -0,0 +1,827 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dootask-kpi-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 可以参与校准的评估状态：主管评分完成后、结果发布（员工确认）前
+var calibratableStatuses = map[string]bool{
+	"manager_evaluated": true,
+	"pending_confirm":   true,
+}
+
+// 创建校准会议请求结构：指定评估，或按部门和考核周期选取可校准的评估
+type CreateCalibrationSessionRequest struct {
+	Name          string `json:"name" binding:"required"`
+	Description   string `json:"description"`
+	EvaluationIDs []uint `json:"evaluation_ids"`
+	DepartmentID  *uint  `json:"department_id"`
+	Year          int    `json:"year"`
+	Month         *int   `json:"month"`
+	Quarter       *int   `json:"quarter"`
+}
+
+// 校准调整建议请求结构
+type CalibrationAdjustmentRequest struct {
+	ScoreID       uint     `json:"score_id" binding:"required"`
+	ProposedScore *float64 `json:"proposed_score" binding:"required"`
+	Justification string   `json:"justification"`
+}
+
+// 校准评分表中的考核项目
+type CalibrationGridItem struct {
+	ScoreID       uint     `json:"score_id"`
+	ItemName      string   `json:"item_name"`
+	MaxScore      float64  `json:"max_score"`
+	SelfScore     *float64 `json:"self_score,omitempty"`
+	ManagerScore  *float64 `json:"manager_score,omitempty"`
+	HRScore       *float64 `json:"hr_score,omitempty"`
+	ProposedScore *float64 `json:"proposed_score,omitempty"`
+	Justification string   `json:"justification,omitempty"`
+	AdjustmentID  uint     `json:"adjustment_id,omitempty"`
+	ProposedBy    string   `json:"proposed_by,omitempty"`
+}
+
+// 校准评分表中的一行（一份评估），按调整后的总分排名
+type CalibrationGridRow struct {
+	Rank           int                   `json:"rank"`
+	EvaluationID   uint                  `json:"evaluation_id"`
+	EmployeeID     uint                  `json:"employee_id"`
+	EmployeeName   string                `json:"employee_name"`
+	DepartmentName string                `json:"department_name"`
+	TemplateName   string                `json:"template_name"`
+	Status         string                `json:"status"`
+	CurrentScore   float64               `json:"current_score"`
+	CurrentGrade   string                `json:"current_grade"`
+	ProjectedScore float64               `json:"projected_score"` // 应用调整建议后的总分
+	ProjectedGrade string                `json:"projected_grade"`
+	Delta          float64               `json:"delta"`
+	Editable       bool                  `json:"editable"` // 当前用户能否为该评估提出调整
+	Items          []CalibrationGridItem `json:"items"`
+}
+
+// 校准前后单个评估的变化
+type CalibrationChange struct {
+	EvaluationID uint    `json:"evaluation_id"`
+	EmployeeName string  `json:"employee_name"`
+	BeforeScore  float64 `json:"before_score"`
+	AfterScore   float64 `json:"after_score"`
+	Delta        float64 `json:"delta"`
+	BeforeGrade  string  `json:"before_grade"`
+	AfterGrade   string  `json:"after_grade"`
+	Adjustments  int     `json:"adjustments"`
+}
+
+// 校准前后汇总
+type CalibrationSummary struct {
+	Evaluations   int                 `json:"evaluations"`
+	Changed       int                 `json:"changed"` // 总分发生变化的评估数
+	Adjustments   int                 `json:"adjustments"`
+	AverageBefore float64             `json:"average_before"`
+	AverageAfter  float64             `json:"average_after"`
+	GradesBefore  []GradeCount        `json:"grades_before"`
+	GradesAfter   []GradeCount        `json:"grades_after"`
+	Changes       []CalibrationChange `json:"changes"`
+}
+
+// canCalibrateEmployee HR可校准所有员工，部门负责人（主管）可校准本部门员工和直属下级
+func canCalibrateEmployee(user *models.Employee, employee *models.Employee) bool {
+	if user.Role == "hr" {
+		return true
+	}
+	if user.Role != "manager" {
+		return false
+	}
+	return employee.DepartmentID == user.DepartmentID || (employee.ManagerID != nil && *employee.ManagerID == user.ID)
+}
+
+// visibleCalibrationSessions 限定用户可查看的校准会议：HR查看全部，主管查看包含本部门员工或直属下级评估的会议
+func visibleCalibrationSessions(query *gorm.DB, user *models.Employee) *gorm.DB {
+	if user.Role == "hr" {
+		return query
+	}
+	return query.Where("id IN (SELECT session_id FROM calibration_evaluations WHERE evaluation_id IN (SELECT kpi_evaluations.id FROM kpi_evaluations JOIN employees ON kpi_evaluations.employee_id = employees.id WHERE employees.department_id = ? OR employees.manager_id = ?))",
+		user.DepartmentID, user.ID)
+}
+
+// evaluationGradeOf 返回评估在指定总分下的等级：已完成的评估使用完成时确定的等级，其他按等级区间预估
+func evaluationGradeOf(evaluation *models.KPIEvaluation, score float64, bandsByTemplate map[uint][]models.GradeBand) string {
+	if evaluation.Status == "completed" && evaluation.Grade != "" && score == evaluation.TotalScore {
+		return evaluation.Grade
+	}
+	bands, ok := bandsByTemplate[evaluation.TemplateID]
+	if !ok {
+		bands, _ = resolveGradeBands(models.DB, evaluation.TemplateID)
+		bandsByTemplate[evaluation.TemplateID] = bands
+	}
+	if band := matchGrade(bands, score); band != nil {
+		return band.Grade
+	}
+	return ""
+}
+
+// loadCalibrationSession 解析路径中的会议ID，加载会议及当前用户，并检查查看权限
+func loadCalibrationSession(c *gin.Context) (*models.CalibrationSession, *models.Employee, bool) {
+	sessionId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的校准会议ID",
+		})
+		return nil, nil, false
+	}
+
+	var operator models.Employee
+	if err := models.DB.First(&operator, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "用户不存在",
+		})
+		return nil, nil, false
+	}
+
+	var session models.CalibrationSession
+	query := visibleCalibrationSessions(models.DB.Preload("CreatedBy").Preload("CommittedBy").Preload("Evaluations").Preload("Adjustments.ProposedBy"), &operator)
+	if err := query.First(&session, sessionId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "校准会议不存在",
+		})
+		return nil, nil, false
+	}
+	return &session, &operator, true
+}
+
+// requireOpenSession 只有进行中的会议可以修改
+func requireOpenSession(c *gin.Context, session *models.CalibrationSession) bool {
+	if session.Status != "open" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "校准会议已提交或已取消，不能修改",
+		})
+		return false
+	}
+	return true
+}
+
+// sessionEvaluationIDs 返回会议包含的评估ID
+func sessionEvaluationIDs(session *models.CalibrationSession) []uint {
+	ids := make([]uint, 0, len(session.Evaluations))
+	for _, entry := range session.Evaluations {
+		ids = append(ids, entry.EvaluationID)
+	}
+	return ids
+}
+
+// buildCalibrationGrid 生成校准评分表：各评估当前总分和应用调整建议后的预估总分，按预估总分从高到低排名
+func buildCalibrationGrid(session *models.CalibrationSession, user *models.Employee) ([]CalibrationGridRow, error) {
+	var evaluations []models.KPIEvaluation
+	if err := models.DB.Preload("Employee.Department").Preload("Template").Preload("Scores", func(db *gorm.DB) *gorm.DB {
+		return db.Order("item_order, id")
+	}).Where("id IN ?", sessionEvaluationIDs(session)).Find(&evaluations).Error; err != nil {
+		return nil, err
+	}
+
+	adjustments := make(map[uint]models.CalibrationAdjustment, len(session.Adjustments))
+	for _, adjustment := range session.Adjustments {
+		adjustments[adjustment.ScoreID] = adjustment
+	}
+
+	bandsByTemplate := make(map[uint][]models.GradeBand)
+	rows := make([]CalibrationGridRow, 0, len(evaluations))
+	for i := range evaluations {
+		evaluation := &evaluations[i]
+		applyItemSnapshots(evaluation.Scores)
+
+		row := CalibrationGridRow{
+			EvaluationID:   evaluation.ID,
+			EmployeeID:     evaluation.EmployeeID,
+			EmployeeName:   evaluation.Employee.Name,
+			DepartmentName: evaluation.Employee.Department.Name,
+			TemplateName:   evaluation.Template.Name,
+			Status:         evaluation.Status,
+			CurrentScore:   evaluation.TotalScore,
+			Editable:       session.Status == "open" && calibratableStatuses[evaluation.Status] && canCalibrateEmployee(user, &evaluation.Employee),
+			Items:          make([]CalibrationGridItem, 0, len(evaluation.Scores)),
+		}
+
+		projected := make([]models.KPIScore, len(evaluation.Scores))
+		adjusted := false
+		for j, score := range evaluation.Scores {
+			item := CalibrationGridItem{
+				ScoreID:      score.ID,
+				ItemName:     score.Item.Name,
+				MaxScore:     score.Item.MaxScore,
+				SelfScore:    score.SelfScore,
+				ManagerScore: score.ManagerScore,
+				HRScore:      score.HRScore,
+			}
+			projected[j] = score
+			if adjustment, ok := adjustments[score.ID]; ok && session.Status == "open" {
+				value := adjustment.ProposedScore
+				item.ProposedScore = &value
+				item.Justification = adjustment.Justification
+				item.AdjustmentID = adjustment.ID
+				if adjustment.ProposedBy != nil {
+					item.ProposedBy = adjustment.ProposedBy.Name
+				}
+				projected[j].HRScore = &value
+				projected[j].FinalScore = nil
+				adjusted = true
+			}
+			row.Items = append(row.Items, item)
+		}
+
+		row.ProjectedScore = row.CurrentScore
+		if adjusted {
+			row.ProjectedScore, _ = evaluationTotalScore(evaluation, projected)
+		}
+		row.Delta = math.Round((row.ProjectedScore-row.CurrentScore)*100) / 100
+		row.CurrentGrade = evaluationGradeOf(evaluation, row.CurrentScore, bandsByTemplate)
+		row.ProjectedGrade = evaluationGradeOf(evaluation, row.ProjectedScore, bandsByTemplate)
+		rows = append(rows, row)
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].ProjectedScore != rows[j].ProjectedScore {
+			return rows[i].ProjectedScore > rows[j].ProjectedScore
+		}
+		return rows[i].EmployeeName < rows[j].EmployeeName
+	})
+	for i := range rows {
+		rows[i].Rank = i + 1
+	}
+	return rows, nil
+}
+
+// countGradeList 统计等级人数，按组织默认等级的顺序排列
+func countGradeList(grades []string) []GradeCount {
+	counts := make(map[string]int64)
+	for _, grade := range grades {
+		if grade != "" {
+			counts[grade]++
+		}
+	}
+	result := make([]GradeCount, 0, len(counts))
+	bands, _ := resolveGradeBands(models.DB, 0)
+	for _, band := range bands {
+		if count, ok := counts[band.Grade]; ok {
+			result = append(result, GradeCount{Grade: band.Grade, Label: band.Label, Count: count})
+			delete(counts, band.Grade)
+		}
+	}
+	others := make([]string, 0, len(counts))
+	for grade := range counts {
+		others = append(others, grade)
+	}
+	sort.Strings(others)
+	for _, grade := range others {
+		result = append(result, GradeCount{Grade: grade, Count: counts[grade]})
+	}
+	return result
+}
+
+// buildCalibrationSummary 根据提交时记录的校准前后总分和等级生成汇总
+func buildCalibrationSummary(session *models.CalibrationSession) CalibrationSummary {
+	summary := CalibrationSummary{
+		Evaluations: len(session.Evaluations),
+		Adjustments: len(session.Adjustments),
+		Changes:     make([]CalibrationChange, 0),
+	}
+
+	adjustmentCounts := make(map[uint]int)
+	for _, adjustment := range session.Adjustments {
+		adjustmentCounts[adjustment.EvaluationID]++
+	}
+	names := make(map[uint]string)
+	var employees []struct {
+		EvaluationID uint
+		Name         string
+	}
+	models.DB.Model(&models.KPIEvaluation{}).
+		Select("kpi_evaluations.id as evaluation_id, employees.name as name").
+		Joins("JOIN employees ON kpi_evaluations.employee_id = employees.id").
+		Where("kpi_evaluations.id IN ?", sessionEvaluationIDs(session)).
+		Scan(&employees)
+	for _, employee := range employees {
+		names[employee.EvaluationID] = employee.Name
+	}
+
+	var beforeTotal, afterTotal float64
+	var recorded int
+	gradesBefore := make([]string, 0, len(session.Evaluations))
+	gradesAfter := make([]string, 0, len(session.Evaluations))
+	for _, entry := range session.Evaluations {
+		if entry.BeforeScore == nil || entry.AfterScore == nil {
+			continue
+		}
+		recorded++
+		beforeTotal += *entry.BeforeScore
+		afterTotal += *entry.AfterScore
+		gradesBefore = append(gradesBefore, entry.BeforeGrade)
+		gradesAfter = append(gradesAfter, entry.AfterGrade)
+
+		delta := math.Round((*entry.AfterScore-*entry.BeforeScore)*100) / 100
+		if delta != 0 || entry.BeforeGrade != entry.AfterGrade {
+			summary.Changed++
+		}
+		summary.Changes = append(summary.Changes, CalibrationChange{
+			EvaluationID: entry.EvaluationID,
+			EmployeeName: names[entry.EvaluationID],
+			BeforeScore:  *entry.BeforeScore,
+			AfterScore:   *entry.AfterScore,
+			Delta:        delta,
+			BeforeGrade:  entry.BeforeGrade,
+			AfterGrade:   entry.AfterGrade,
+			Adjustments:  adjustmentCounts[entry.EvaluationID],
+		})
+	}
+	if recorded > 0 {
+		summary.AverageBefore = math.Round(beforeTotal/float64(recorded)*100) / 100
+		summary.AverageAfter = math.Round(afterTotal/float64(recorded)*100) / 100
+	}
+	summary.GradesBefore = countGradeList(gradesBefore)
+	summary.GradesAfter = countGradeList(gradesAfter)
+
+	sort.SliceStable(summary.Changes, func(i, j int) bool {
+		return math.Abs(summary.Changes[i].Delta) > math.Abs(summary.Changes[j].Delta)
+	})
+	return summary
+}
+
+// 获取校准会议列表
+func GetCalibrationSessions(c *gin.Context) {
+	var operator models.Employee
+	if err := models.DB.First(&operator, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "用户不存在",
+		})
+		return
+	}
+
+	query := visibleCalibrationSessions(models.DB.Preload("CreatedBy").Preload("Evaluations"), &operator)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var sessions []models.CalibrationSession
+	if err := query.Order("created_at DESC").Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取校准会议失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  sessions,
+		"total": len(sessions),
+	})
+}
+
+// 获取校准会议：包含按总分排名的校准评分表，已提交的会议同时返回校准前后汇总
+func GetCalibrationSession(c *gin.Context) {
+	session, operator, ok := loadCalibrationSession(c)
+	if !ok {
+		return
+	}
+
+	grid, err := buildCalibrationGrid(session, operator)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取校准评分表失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	response := gin.H{
+		"data": session,
+		"grid": grid,
+	}
+	if session.Status == "committed" {
+		response["summary"] = buildCalibrationSummary(session)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// 创建校准会议
+func CreateCalibrationSession(c *gin.Context) {
+	var req CreateCalibrationSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// 未指定评估时，按部门和考核周期选取可校准的评估
+	var evaluations []models.KPIEvaluation
+	query := models.DB.Model(&models.KPIEvaluation{})
+	if len(req.EvaluationIDs) > 0 {
+		query = query.Where("id IN ?", req.EvaluationIDs)
+	} else {
+		if req.DepartmentID == nil || req.Year == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "请指定评估，或指定部门和考核周期",
+			})
+			return
+		}
+		query = query.Where("employee_id IN (SELECT id FROM employees WHERE department_id = ? AND is_active = ?)", *req.DepartmentID, true).
+			Where("year = ? AND COALESCE(month, 0) = ? AND COALESCE(quarter, 0) = ?", req.Year, periodPart(req.Month), periodPart(req.Quarter)).
+			Where("status IN ?", []string{"manager_evaluated", "pending_confirm"})
+	}
+	if err := query.Order("id").Find(&evaluations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取评估失败",
+			"message": err.Error(),
+		})
+		return
+	}
+	if len(evaluations) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "没有可校准的评估",
+		})
+		return
+	}
+	if len(req.EvaluationIDs) > 0 && len(evaluations) != len(req.EvaluationIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "部分评估不存在",
+		})
+		return
+	}
+	for _, evaluation := range evaluations {
+		if !calibratableStatuses[evaluation.Status] {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("评估 %d 当前处于「%s」阶段，只有待HR审核或待确认的评估可以校准", evaluation.ID, getStatusText(evaluation.Status)),
+			})
+			return
+		}
+	}
+
+	session := models.CalibrationSession{
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Status:      "open",
+		CreatedByID: c.GetUint("user_id"),
+	}
+	for _, evaluation := range evaluations {
+		session.Evaluations = append(session.Evaluations, models.CalibrationEvaluation{EvaluationID: evaluation.ID})
+	}
+	if err := models.DB.Create(&session).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "创建校准会议失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "校准会议创建成功",
+		"data":    session,
+	})
+}
+
+// 取消校准会议，调整建议不会写入评分
+func CancelCalibrationSession(c *gin.Context) {
+	session, _, ok := loadCalibrationSession(c)
+	if !ok {
+		return
+	}
+	if !requireOpenSession(c, session) {
+		return
+	}
+
+	if err := models.DB.Model(session).Update("status", "cancelled").Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "取消校准会议失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "校准会议已取消",
+	})
+}
+
+// 提出或修改调整建议：每个考核项目保留一条建议，必须说明调整理由
+func SaveCalibrationAdjustment(c *gin.Context) {
+	session, operator, ok := loadCalibrationSession(c)
+	if !ok {
+		return
+	}
+	if !requireOpenSession(c, session) {
+		return
+	}
+
+	var req CalibrationAdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+	req.Justification = strings.TrimSpace(req.Justification)
+	if req.Justification == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请填写调整理由",
+		})
+		return
+	}
+
+	var score models.KPIScore
+	if err := models.DB.Preload("Evaluation.Employee").First(&score, req.ScoreID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "评分记录不存在",
+		})
+		return
+	}
+	inSession := false
+	for _, entry := range session.Evaluations {
+		inSession = inSession || entry.EvaluationID == score.EvaluationID
+	}
+	if !inSession {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "该评分记录不属于本次校准的评估",
+		})
+		return
+	}
+	if !canCalibrateEmployee(operator, &score.Evaluation.Employee) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "无权调整该员工的评分",
+		})
+		return
+	}
+	if !calibratableStatuses[score.Evaluation.Status] {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("评估当前处于「%s」阶段，不能校准", getStatusText(score.Evaluation.Status)),
+		})
+		return
+	}
+	if errs := validateScore(&score, "hr_score", req.ProposedScore, req.Justification); len(errs) > 0 {
+		respondScoreValidationErrors(c, errs)
+		return
+	}
+
+	adjustment := models.CalibrationAdjustment{
+		SessionID:    session.ID,
+		EvaluationID: score.EvaluationID,
+		ScoreID:      score.ID,
+	}
+	for _, existing := range session.Adjustments {
+		if existing.ScoreID == score.ID {
+			adjustment = existing
+			adjustment.ProposedBy = nil
+		}
+	}
+	adjustment.ProposedScore = *req.ProposedScore
+	adjustment.Justification = req.Justification
+	adjustment.ProposedByID = operator.ID
+	if err := models.DB.Save(&adjustment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "保存调整建议失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "调整建议已保存",
+		"data":    adjustment,
+	})
+}
+
+// 撤回调整建议：提出人或HR可撤回
+func DeleteCalibrationAdjustment(c *gin.Context) {
+	session, operator, ok := loadCalibrationSession(c)
+	if !ok {
+		return
+	}
+	if !requireOpenSession(c, session) {
+		return
+	}
+
+	adjustmentId, err := strconv.ParseUint(c.Param("adjustment_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的调整建议ID",
+		})
+		return
+	}
+	var adjustment *models.CalibrationAdjustment
+	for i := range session.Adjustments {
+		if session.Adjustments[i].ID == uint(adjustmentId) {
+			adjustment = &session.Adjustments[i]
+		}
+	}
+	if adjustment == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "调整建议不存在",
+		})
+		return
+	}
+	if adjustment.ProposedByID != operator.ID && operator.Role != "hr" {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "只能撤回自己提出的调整建议",
+		})
+		return
+	}
+
+	if err := models.DB.Delete(&models.CalibrationAdjustment{}, adjustment.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "撤回调整建议失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "调整建议已撤回",
+	})
+}
+
+// errCalibrationConflict 提交时评估已不在可校准阶段，或待确认的评估调整后超出硬性强制分布配额
+var errCalibrationConflict = errors.New("calibration conflict")
+
+// errCalibrationSessionClosed 提交时校准会议已被提交或取消（并发提交）
+var errCalibrationSessionClosed = errors.New("calibration session closed")
+
+// 提交校准会议：在同一事务中将全部调整建议写入HR评分并重新计算总分，记录变更历史和校准前后的总分、等级
+// 已处于待确认的评估按调整后的总分重新检查部门强制分布配额
+func CommitCalibrationSession(c *gin.Context) {
+	session, operator, ok := loadCalibrationSession(c)
+	if !ok {
+		return
+	}
+	if !requireOpenSession(c, session) {
+		return
+	}
+
+	adjustmentsByEvaluation := make(map[uint][]*models.CalibrationAdjustment)
+	for i := range session.Adjustments {
+		adjustment := &session.Adjustments[i]
+		adjustmentsByEvaluation[adjustment.EvaluationID] = append(adjustmentsByEvaluation[adjustment.EvaluationID], adjustment)
+	}
+
+	var conflicts, distributionWarnings []string
+	bandsByTemplate := make(map[uint][]models.GradeBand)
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		// 先将会议标记为已提交，并发提交时只有一个能成功
+		now := time.Now()
+		claimed := tx.Model(&models.CalibrationSession{}).Where("id = ? AND status = ?", session.ID, "open").Updates(map[string]interface{}{
+			"status":          "committed",
+			"committed_by_id": operator.ID,
+			"committed_at":    now,
+		})
+		if claimed.Error != nil {
+			return claimed.Error
+		}
+		if claimed.RowsAffected == 0 {
+			return errCalibrationSessionClosed
+		}
+
+		for i := range session.Evaluations {
+			entry := &session.Evaluations[i]
+			var evaluation models.KPIEvaluation
+			if err := tx.Preload("Employee").Preload("Scores").First(&evaluation, entry.EvaluationID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					continue
+				}
+				return err
+			}
+			applyItemSnapshots(evaluation.Scores)
+			adjustments := adjustmentsByEvaluation[evaluation.ID]
+			if len(adjustments) > 0 && !calibratableStatuses[evaluation.Status] {
+				conflicts = append(conflicts, fmt.Sprintf("%s 的评估当前处于「%s」阶段", evaluation.Employee.Name, getStatusText(evaluation.Status)))
+				continue
+			}
+
+			beforeScore := evaluation.TotalScore
+			entry.BeforeScore = &beforeScore
+			entry.BeforeGrade = evaluationGradeOf(&evaluation, beforeScore, bandsByTemplate)
+
+			history := newHistoryRecorder(evaluation.ID, operator.ID, historySourceCalibration)
+			for _, adjustment := range adjustments {
+				var score *models.KPIScore
+				for j := range evaluation.Scores {
+					if evaluation.Scores[j].ID == adjustment.ScoreID {
+						score = &evaluation.Scores[j]
+					}
+				}
+				if score == nil {
+					continue
+				}
+				value := adjustment.ProposedScore
+				history.scoreChange(score, "hr_score", score.HRScore, &value)
+				history.scoreChange(score, "hr_comment", score.HRComment, adjustment.Justification)
+				// 校准后的HR评分取代之前的最终评分
+				if score.FinalScore != nil {
+					history.scoreChange(score, "final_score", score.FinalScore, nil)
+				}
+				if err := tx.Model(&models.KPIScore{}).Where("id = ?", score.ID).Updates(map[string]interface{}{
+					"hr_score":    value,
+					"hr_comment":  adjustment.Justification,
+					"final_score": nil,
+				}).Error; err != nil {
+					return err
+				}
+				if err := tx.Model(adjustment).Update("previous_score", score.HRScore).Error; err != nil {
+					return err
+				}
+				score.HRScore = &value
+				score.FinalScore = nil
+				score.HRComment = adjustment.Justification
+			}
+
+			afterScore := beforeScore
+			if len(adjustments) > 0 {
+				var rawScore float64
+				afterScore, rawScore = evaluationTotalScore(&evaluation, evaluation.Scores)
+				if evaluation.Status == "pending_confirm" {
+					distribution, err := checkEvaluationDistribution(&evaluation, afterScore)
+					if err != nil {
+						return err
+					}
+					if distribution.Blocked {
+						conflicts = append(conflicts, fmt.Sprintf("%s 的评估调整后超出部门强制分布配额（%s）", evaluation.Employee.Name, strings.Join(distribution.Violations, "；")))
+						continue
+					}
+					distributionWarnings = append(distributionWarnings, distribution.Violations...)
+				}
+				history.change("total_score", evaluation.TotalScore, afterScore)
+				history.change("raw_score", evaluation.RawScore, rawScore)
+				history.change("calibration_session", "", session.Name)
+				if err := tx.Model(&models.KPIEvaluation{}).Where("id = ?", evaluation.ID).Updates(map[string]interface{}{
+					"total_score": afterScore,
+					"raw_score":   rawScore,
+				}).Error; err != nil {
+					return err
+				}
+				evaluation.TotalScore = afterScore
+			}
+			entry.AfterScore = &afterScore
+			entry.AfterGrade = evaluationGradeOf(&evaluation, afterScore, bandsByTemplate)
+
+			if err := tx.Model(entry).Updates(map[string]interface{}{
+				"before_score": entry.BeforeScore,
+				"before_grade": entry.BeforeGrade,
+				"after_score":  entry.AfterScore,
+				"after_grade":  entry.AfterGrade,
+			}).Error; err != nil {
+				return err
+			}
+			if err := history.save(tx); err != nil {
+				return err
+			}
+		}
+		if len(conflicts) > 0 {
+			return errCalibrationConflict
+		}
+
+		session.Status = "committed"
+		session.CommittedByID = &operator.ID
+		session.CommittedAt = &now
+		return nil
+	})
+	if errors.Is(err, errCalibrationSessionClosed) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "校准会议已提交或已取消",
+		})
+		return
+	}
+	if errors.Is(err, errCalibrationConflict) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "部分评估无法按调整建议校准，请撤回相关调整建议后再提交",
+			"message": strings.Join(conflicts, "；"),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "提交校准会议失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	response := gin.H{
+		"message": "校准结果已提交",
+		"data":    session,
+		"summary": buildCalibrationSummary(session),
+	}
+	if len(distributionWarnings) > 0 {
+		response["distribution_warnings"] = distributionWarnings
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -56,7 +56,7 @@ func GetEvaluationComments(c *gin.Context) {
 
 	// 分页查询，按创建时间倒序
 	offset := (page - 1) * pageSize
-	if err := query.Preload("User").Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&comments).Error; err != nil {
+	if err := query.Preload("User").Preload("OnBehalfOf").Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&comments).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取评论失败"})
 		return
 	}
@@ -100,18 +100,19 @@ func CreateEvaluationComment(c *gin.Context) {
 
 	// 验证评估记录是否存在
 	var evaluation models.KPIEvaluation
-	if err := models.DB.First(&evaluation, evaluationID).Error; err != nil {
+	if err := models.DB.Preload("Employee").First(&evaluation, evaluationID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "评估记录不存在"})
 		return
 	}
 
-	// 创建评论
+	// 创建评论（受托人或升级接收人评论时记录被代理的直属上级）
 	evalID, _ := strconv.ParseUint(evaluationID, 10, 32)
 	comment := models.EvaluationComment{
 		EvaluationID: uint(evalID),
 		UserID:       userID,
 		Content:      req.Content,
 		IsPrivate:    req.IsPrivate,
+		OnBehalfOfID: reviewOnBehalfOf(&evaluation, userID),
 	}
 
 	if err := models.DB.Create(&comment).Error; err != nil {
@@ -120,7 +121,7 @@ func CreateEvaluationComment(c *gin.Context) {
 	}
 
 	// 预加载用户信息后返回
-	models.DB.Preload("User").First(&comment, comment.ID)
+	models.DB.Preload("User").Preload("OnBehalfOf").First(&comment, comment.ID)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "评论创建成功",
@@ -173,7 +174,7 @@ func UpdateEvaluationComment(c *gin.Context) {
 	}
 
 	// 预加载用户信息后返回
-	models.DB.Preload("User").First(&comment, comment.ID)
+	models.DB.Preload("User").Preload("OnBehalfOf").First(&comment, comment.ID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "评论更新成功",
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"dootask-kpi-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// versionETag 生成版本号对应的 ETag
+func versionETag(version uint) string {
+	return fmt.Sprintf("\"%d\"", version)
+}
+
+// setVersionETag 在响应头中返回当前版本号
+func setVersionETag(c *gin.Context, version uint) {
+	c.Header("ETag", versionETag(version))
+}
+
+// ifMatchVersion 解析 If-Match 请求头中的版本号
+// 未提供或为 * 时返回 nil（不做并发检查），格式无效时返回错误
+func ifMatchVersion(c *gin.Context) (*uint, error) {
+	value := strings.TrimSpace(c.GetHeader("If-Match"))
+	if value == "" || value == "*" {
+		return nil, nil
+	}
+	value = strings.Trim(strings.TrimPrefix(value, "W/"), "\"")
+	version, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 If-Match 请求头：%s", c.GetHeader("If-Match"))
+	}
+	expected := uint(version)
+	return &expected, nil
+}
+
+// checkIfMatch 校验 If-Match 与当前版本是否一致
+// 不一致时返回409并附带当前数据，调用方应直接返回；一致时返回期望版本号供条件更新使用
+func checkIfMatch(c *gin.Context, currentVersion uint, current interface{}) (*uint, bool) {
+	expected, err := ifMatchVersion(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return nil, false
+	}
+	if expected != nil && *expected != currentVersion {
+		respondVersionConflict(c, currentVersion, current)
+		return nil, false
+	}
+	return expected, true
+}
+
+// whereVersion 为更新语句追加版本号条件，expected 为空时不追加
+func whereVersion(db *gorm.DB, expected *uint) *gorm.DB {
+	if expected == nil {
+		return db
+	}
+	return db.Where("version = ?", *expected)
+}
+
+// errVersionConflict 条件更新时版本号不一致，没有更新任何记录
+var errVersionConflict = errors.New("version conflict")
+
+// updateVersioned 在同一事务中按期望版本号更新记录并写入变更历史
+// 版本号不一致时返回 errVersionConflict，更新和变更历史一并回滚
+func updateVersioned(model interface{}, expected *uint, updates map[string]interface{}, history *historyRecorder) error {
+	return models.DB.Transaction(func(tx *gorm.DB) error {
+		result := whereVersion(tx.Model(model), expected).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errVersionConflict
+		}
+		return history.save(tx)
+	})
+}
+
+// respondVersionConflict 返回数据已被他人修改的冲突错误，附带当前数据和版本号
+func respondVersionConflict(c *gin.Context, currentVersion uint, current interface{}) {
+	setVersionETag(c, currentVersion)
+	c.JSON(http.StatusConflict, gin.H{
+		"error":   "数据已被他人修改",
+		"message": "请刷新后基于最新数据重新提交",
+		"version": currentVersion,
+		"data":    current,
+	})
+}
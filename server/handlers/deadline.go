@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"dootask-kpi-server/models"
+	"dootask-kpi-server/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 截止提醒类型
+const (
+	reminderKindBefore  = "before"  // 到期前提醒
+	reminderKindOverdue = "overdue" // 逾期提醒
+)
+
+// 截止提醒设置项
+const (
+	settingRemindBeforeHours  = "deadline_remind_before_hours"  // 到期前多少小时提醒，默认24
+	settingOverdueRemindHours = "deadline_overdue_remind_hours" // 逾期后每隔多少小时再次提醒，默认24
+)
+
+// stageDeadlineColumns 评估各阶段对应的截止时间字段及模板中的截止天数配置
+var stageDeadlineColumns = []struct {
+	status string
+	column string
+	days   func(template *models.KPITemplate) *int
+}{
+	{status: "pending", column: "self_deadline", days: func(t *models.KPITemplate) *int { return t.SelfDeadlineDays }},
+	{status: "self_evaluated", column: "manager_deadline", days: func(t *models.KPITemplate) *int { return t.ManagerDeadlineDays }},
+	{status: "manager_evaluated", column: "hr_deadline", days: func(t *models.KPITemplate) *int { return t.HRDeadlineDays }},
+	{status: "pending_confirm", column: "confirm_deadline", days: func(t *models.KPITemplate) *int { return t.ConfirmDeadlineDays }},
+}
+
+// evaluationStageDeadline 返回评估当前阶段的截止时间，未设置或已完成时返回 nil
+func evaluationStageDeadline(evaluation *models.KPIEvaluation) *time.Time {
+	return stageDeadline(evaluation, evaluation.Status)
+}
+
+// stageDeadline 返回评估指定阶段的截止时间，未设置或该阶段没有截止时间时返回 nil
+func stageDeadline(evaluation *models.KPIEvaluation, status string) *time.Time {
+	switch status {
+	case "pending":
+		return evaluation.SelfDeadline
+	case "self_evaluated":
+		return evaluation.ManagerDeadline
+	case "manager_evaluated":
+		return evaluation.HRDeadline
+	case "pending_confirm":
+		return evaluation.ConfirmDeadline
+	default:
+		return nil
+	}
+}
+
+// overdueEvaluationsCondition 构造“当前阶段已逾期”的查询条件
+func overdueEvaluationsCondition(now time.Time) (string, []interface{}) {
+	conditions := make([]string, 0, len(stageDeadlineColumns))
+	args := make([]interface{}, 0, len(stageDeadlineColumns)*2)
+	for _, stage := range stageDeadlineColumns {
+		conditions = append(conditions, fmt.Sprintf("(status = ? AND %s IS NOT NULL AND %s < ?)", stage.column, stage.column))
+		args = append(args, stage.status, now)
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// applyTemplateDeadlines 创建评估时按模板配置补全起始阶段的截止时间，from 为起算时间
+// 模板中各阶段的截止天数从该阶段开始时起算，之后的阶段在进入时由 scheduleStageDeadline 补全
+// 从目标设定开始的评估，自评截止时间在目标确认后起算
+func applyTemplateDeadlines(evaluation *models.KPIEvaluation, template *models.KPITemplate, from time.Time) {
+	status := evaluation.Status
+	if status == "" {
+		status = "pending"
+	}
+	if status != "pending" || evaluation.SelfDeadline != nil {
+		return
+	}
+	if days := template.SelfDeadlineDays; days != nil && *days > 0 {
+		t := from.AddDate(0, 0, *days)
+		evaluation.SelfDeadline = &t
+	}
+}
+
+// scheduleStageDeadline 评估进入 status 阶段时，按模板配置补全该阶段未设置的截止时间，from 为阶段开始时间
+// 已设置的截止时间（创建时指定或HR调整）保持不变
+func scheduleStageDeadline(tx *gorm.DB, evaluation *models.KPIEvaluation, status string, from time.Time) error {
+	for _, stage := range stageDeadlineColumns {
+		if stage.status != status {
+			continue
+		}
+		var template models.KPITemplate
+		if err := tx.First(&template, evaluation.TemplateID).Error; err != nil {
+			return err
+		}
+		days := stage.days(&template)
+		if days == nil || *days <= 0 {
+			return nil
+		}
+		return tx.Model(&models.KPIEvaluation{}).
+			Where(fmt.Sprintf("id = ? AND %s IS NULL", stage.column), evaluation.ID).
+			Update(stage.column, from.AddDate(0, 0, *days)).Error
+	}
+	return nil
+}
+
+// evaluationStageRecipients 返回评估当前阶段的负责人
+// evaluation 需预加载 Employee
+func evaluationStageRecipients(evaluation *models.KPIEvaluation) []uint {
+	switch evaluation.Status {
+	case "pending", "pending_confirm":
+		return []uint{evaluation.EmployeeID}
+	case "self_evaluated":
+		if evaluation.Employee.ManagerID != nil {
+			return []uint{*evaluation.Employee.ManagerID}
+		}
+		return GetNotificationService().GetAllHRUsers()
+	case "manager_evaluated":
+		if step := currentApprovalStep(evaluation.ID); step != nil {
+			return step.ApproverIDs
+		}
+		return GetNotificationService().GetAllHRUsers()
+	default:
+		return nil
+	}
+}
+
+// settingHours 读取以小时为单位的设置项，未设置或无效时返回默认值
+func settingHours(key string, defaultValue int) int {
+	value, err := GetSetting(key)
+	if err != nil {
+		return defaultValue
+	}
+	hours, err := strconv.Atoi(value)
+	if err != nil || hours <= 0 {
+		return defaultValue
+	}
+	return hours
+}
+
+// sendDeadlineReminders 为即将到期和已逾期的评估发送提醒
+func sendDeadlineReminders(now time.Time) {
+	remindBefore := time.Duration(settingHours(settingRemindBeforeHours, 24)) * time.Hour
+	overdueInterval := time.Duration(settingHours(settingOverdueRemindHours, 24)) * time.Hour
+
+	var evaluations []models.KPIEvaluation
+	err := models.DB.Preload("Employee").Preload("Template").
+		Where("status IN ?", []string{"pending", "self_evaluated", "manager_evaluated", "pending_confirm"}).
+		Where("self_deadline IS NOT NULL OR manager_deadline IS NOT NULL OR hr_deadline IS NOT NULL OR confirm_deadline IS NOT NULL").
+		Find(&evaluations).Error
+	if err != nil {
+		fmt.Printf("获取待提醒评估失败: %v\n", err)
+		return
+	}
+
+	for i := range evaluations {
+		evaluation := &evaluations[i]
+		deadline := evaluationStageDeadline(evaluation)
+		if deadline == nil {
+			continue
+		}
+
+		kind := reminderKindBefore
+		if now.Before(*deadline) {
+			if deadline.Sub(now) > remindBefore {
+				continue
+			}
+		} else {
+			kind = reminderKindOverdue
+		}
+
+		var last models.EvaluationReminder
+		lastQuery := models.DB.Where("evaluation_id = ? AND status = ? AND kind = ? AND deadline = ?", evaluation.ID, evaluation.Status, kind, *deadline).
+			Order("created_at DESC").Limit(1).Find(&last)
+		if lastQuery.Error != nil {
+			continue
+		}
+		// 到期前只提醒一次，逾期后按间隔重复提醒
+		if lastQuery.RowsAffected > 0 && (kind == reminderKindBefore || now.Sub(last.CreatedAt) < overdueInterval) {
+			continue
+		}
+
+		notifyEvaluationDeadline(os.Getenv(systemDooTaskTokenEnv), evaluation, *deadline, kind == reminderKindOverdue)
+
+		reminder := models.EvaluationReminder{
+			EvaluationID: evaluation.ID,
+			Status:       evaluation.Status,
+			Kind:         kind,
+			Deadline:     *deadline,
+		}
+		if err := models.DB.Create(&reminder).Error; err != nil {
+			fmt.Printf("记录截止提醒失败: %v\n", err)
+		}
+	}
+}
+
+// notifyEvaluationDeadline 向当前阶段负责人发送截止提醒（DooTask 机器人通知 + 实时通知）
+// evaluation 需预加载 Employee 和 Template
+func notifyEvaluationDeadline(dooTaskToken string, evaluation *models.KPIEvaluation, deadline time.Time, overdue bool) {
+	title := "绩效考核即将到期"
+	if overdue {
+		title = "绩效考核已逾期"
+	}
+
+	var recipients []models.Employee
+	if ids := evaluationStageRecipients(evaluation); len(ids) > 0 {
+		models.DB.Where("id IN ?", ids).Find(&recipients)
+	}
+
+	dooTaskClient := utils.NewDooTaskClient(dooTaskToken)
+	periodValue := utils.GetPeriodValue(evaluation.Period, evaluation.Year, evaluation.Month, evaluation.Quarter)
+	appConfigJSON := utils.BuildKPIAppConfig(evaluation.ID)
+	message := fmt.Sprintf(
+		"**%s**\n- 考核模板：%s\n- 考核周期：%s\n- 被评估员工：%s\n- 当前阶段：%s\n- 截止时间：%s\n\n> <div class=\"open-micro-app\" data-app-config='%s'>查看详情：点击查看详情</div>",
+		title,
+		evaluation.Template.Name,
+		periodValue,
+		evaluation.Employee.Name,
+		getStatusText(evaluation.Status),
+		deadline.Format("2006-01-02 15:04"),
+		appConfigJSON,
+	)
+	for _, recipient := range recipients {
+		if recipient.DooTaskUserID != nil {
+			_ = dooTaskClient.SendBotMessage(recipient.DooTaskUserID, message)
+		}
+	}
+
+	GetNotificationService().SendNotification(0, EventEvaluationDeadlineReminder, evaluation)
+}
+
+// 启动评估截止提醒任务：启动时检查一次，之后每30分钟检查一次
+func StartDeadlineReminderTask() {
+	go sendDeadlineReminders(time.Now())
+
+	ticker := time.NewTicker(30 * time.Minute)
+	go func() {
+		for now := range ticker.C {
+			sendDeadlineReminders(now)
+		}
+	}()
+}
+
+// 评估截止时间更新请求结构（整体替换，传空表示取消该阶段截止时间）
+type UpdateEvaluationDeadlinesRequest struct {
+	SelfDeadline    *time.Time `json:"self_deadline"`
+	ManagerDeadline *time.Time `json:"manager_deadline"`
+	HRDeadline      *time.Time `json:"hr_deadline"`
+	ConfirmDeadline *time.Time `json:"confirm_deadline"`
+}
+
+// 更新评估各阶段截止时间
+func UpdateEvaluationDeadlines(c *gin.Context) {
+	id := c.Param("id")
+	evaluationId, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的评估ID",
+		})
+		return
+	}
+
+	var req UpdateEvaluationDeadlinesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var evaluation models.KPIEvaluation
+	if err := models.DB.First(&evaluation, evaluationId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "评估不存在",
+		})
+		return
+	}
+
+	// 并发检查：If-Match 与当前版本不一致时拒绝
+	expectedVersion, ok := checkIfMatch(c, evaluation.Version, &evaluation)
+	if !ok {
+		return
+	}
+
+	history := newHistoryRecorder(evaluation.ID, c.GetUint("user_id"), historySourceEvaluation)
+	history.change("self_deadline", evaluation.SelfDeadline, req.SelfDeadline)
+	history.change("manager_deadline", evaluation.ManagerDeadline, req.ManagerDeadline)
+	history.change("hr_deadline", evaluation.HRDeadline, req.HRDeadline)
+	history.change("confirm_deadline", evaluation.ConfirmDeadline, req.ConfirmDeadline)
+
+	updateData := map[string]interface{}{
+		"self_deadline":    req.SelfDeadline,
+		"manager_deadline": req.ManagerDeadline,
+		"hr_deadline":      req.HRDeadline,
+		"confirm_deadline": req.ConfirmDeadline,
+	}
+	err = updateVersioned(&evaluation, expectedVersion, updateData, history)
+	if errors.Is(err, errVersionConflict) {
+		models.DB.First(&evaluation, evaluation.ID)
+		respondVersionConflict(c, evaluation.Version, &evaluation)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "更新截止时间失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	models.DB.Preload("Employee.Department").Preload("Template").First(&evaluation, evaluation.ID)
+	setVersionETag(c, evaluation.Version)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "截止时间更新成功",
+		"data":    evaluation,
+	})
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"dootask-kpi-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 评审委托创建请求结构
+type CreateDelegationRequest struct {
+	DelegatorID uint   `json:"delegator_id"`                   // 委托人，HR代主管创建时填写，默认为当前用户
+	DelegateID  uint   `json:"delegate_id" binding:"required"` // 受托人
+	StartDate   string `json:"start_date" binding:"required"`  // 开始日期 YYYY-MM-DD
+	EndDate     string `json:"end_date" binding:"required"`    // 结束日期 YYYY-MM-DD（含当天）
+	Reason      string `json:"reason"`
+}
+
+// activeReviewDelegation 查找委托人在指定时间委托给受托人的有效委托
+func activeReviewDelegation(delegatorID uint, delegateID uint, at time.Time) *models.ReviewDelegation {
+	var delegation models.ReviewDelegation
+	result := models.DB.Where("delegator_id = ? AND delegate_id = ? AND start_at <= ? AND end_at >= ?", delegatorID, delegateID, at, at).
+		Limit(1).Find(&delegation)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil
+	}
+	return &delegation
+}
+
+// activeDelegatesOf 返回委托人在指定时间的所有受托人
+func activeDelegatesOf(delegatorID uint, at time.Time) []models.Employee {
+	var delegates []models.Employee
+	models.DB.Where("id IN (SELECT delegate_id FROM review_delegations WHERE delegator_id = ? AND start_at <= ? AND end_at >= ?)", delegatorID, at, at).
+		Find(&delegates)
+	return delegates
+}
+
+// reviewOnBehalfOf 当用户以受托人或升级接收人身份处理评估时，返回被代理的直属上级ID
+// evaluation 需预加载 Employee
+func reviewOnBehalfOf(evaluation *models.KPIEvaluation, userID uint) *uint {
+	managerID := evaluation.Employee.ManagerID
+	if managerID == nil || *managerID == userID || evaluation.EmployeeID == userID {
+		return nil
+	}
+	if activeReviewDelegation(*managerID, userID, time.Now()) != nil {
+		return managerID
+	}
+	if evaluation.Status == "self_evaluated" && escalatedReviewer(evaluation.ID, userID) {
+		return managerID
+	}
+	return nil
+}
+
+// onBehalfOfText 生成“X 代 Y”形式的署名
+func onBehalfOfText(operatorName string, onBehalfOfID *uint) string {
+	if onBehalfOfID == nil {
+		return operatorName
+	}
+	var manager models.Employee
+	if err := models.DB.First(&manager, *onBehalfOfID).Error; err != nil {
+		return operatorName
+	}
+	return fmt.Sprintf("%s（代 %s）", operatorName, manager.Name)
+}
+
+// 获取评审委托列表：HR可以查看所有，其他用户查看自己委托或受托的记录
+func GetDelegations(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	query := models.DB.Preload("Delegator").Preload("Delegate").Preload("CreatedBy")
+	if c.GetString("user_role") != "hr" {
+		query = query.Where("delegator_id = ? OR delegate_id = ?", userID, userID)
+	}
+	if delegatorID := c.Query("delegator_id"); delegatorID != "" {
+		query = query.Where("delegator_id = ?", delegatorID)
+	}
+	if delegateID := c.Query("delegate_id"); delegateID != "" {
+		query = query.Where("delegate_id = ?", delegateID)
+	}
+	if c.Query("active") == "true" {
+		now := time.Now()
+		query = query.Where("start_at <= ? AND end_at >= ?", now, now)
+	}
+
+	var delegations []models.ReviewDelegation
+	if err := query.Order("start_at DESC, id DESC").Find(&delegations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取评审委托失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  delegations,
+		"total": len(delegations),
+	})
+}
+
+// 创建评审委托：主管为自己创建，HR可以为任意主管创建
+func CreateDelegation(c *gin.Context) {
+	var req CreateDelegationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	if req.DelegatorID == 0 {
+		req.DelegatorID = userID
+	}
+	if req.DelegatorID != userID && c.GetString("user_role") != "hr" {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "只有HR可以为其他主管设置委托",
+		})
+		return
+	}
+	if req.DelegatorID == req.DelegateID {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "不能委托给自己",
+		})
+		return
+	}
+
+	startAt, err := time.ParseInLocation("2006-01-02", req.StartDate, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的开始日期，格式应为 YYYY-MM-DD",
+		})
+		return
+	}
+	endDate, err := time.ParseInLocation("2006-01-02", req.EndDate, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的结束日期，格式应为 YYYY-MM-DD",
+		})
+		return
+	}
+	if endDate.Before(startAt) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "结束日期不能早于开始日期",
+		})
+		return
+	}
+	endAt := endDate.AddDate(0, 0, 1).Add(-time.Second)
+
+	var delegator models.Employee
+	if err := models.DB.First(&delegator, req.DelegatorID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "委托人不存在",
+		})
+		return
+	}
+	var delegate models.Employee
+	if err := models.DB.First(&delegate, req.DelegateID).Error; err != nil || !delegate.IsActive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "受托人不存在或已离职",
+		})
+		return
+	}
+
+	// 同一委托人的委托时间段不能重叠
+	var overlapCount int64
+	models.DB.Model(&models.ReviewDelegation{}).
+		Where("delegator_id = ? AND start_at <= ? AND end_at >= ?", req.DelegatorID, endAt, startAt).
+		Count(&overlapCount)
+	if overlapCount > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "该时间段内已存在委托",
+		})
+		return
+	}
+
+	delegation := models.ReviewDelegation{
+		DelegatorID: req.DelegatorID,
+		DelegateID:  req.DelegateID,
+		StartAt:     startAt,
+		EndAt:       endAt,
+		Reason:      req.Reason,
+		CreatedByID: userID,
+	}
+	if err := models.DB.Create(&delegation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "创建评审委托失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	models.DB.Preload("Delegator").Preload("Delegate").Preload("CreatedBy").First(&delegation, delegation.ID)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "评审委托创建成功",
+		"data":    delegation,
+	})
+}
+
+// 删除评审委托：委托人本人或HR可以删除
+func DeleteDelegation(c *gin.Context) {
+	id := c.Param("id")
+	delegationId, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的委托ID",
+		})
+		return
+	}
+
+	var delegation models.ReviewDelegation
+	if err := models.DB.First(&delegation, delegationId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "委托不存在",
+		})
+		return
+	}
+
+	if delegation.DelegatorID != c.GetUint("user_id") && c.GetString("user_role") != "hr" {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "无权删除此委托",
+		})
+		return
+	}
+
+	if err := models.DB.Delete(&delegation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "删除评审委托失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "评审委托删除成功",
+	})
+}
@@ -0,0 +1,547 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"dootask-kpi-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 强制分布配额执行方式
+const (
+	distributionEnforcementWarn  = "warn"  // 超出配额时提示HR，不影响流程
+	distributionEnforcementBlock = "block" // 超出配额时禁止进入待确认
+)
+
+// 强制分布配额请求结构
+type DistributionQuotaRequest struct {
+	Name         string                     `json:"name"`
+	DepartmentID *uint                      `json:"department_id"`
+	Period       string                     `json:"period"`
+	Year         *int                       `json:"year"`
+	Month        *int                       `json:"month"`
+	Quarter      *int                       `json:"quarter"`
+	Limits       []models.DistributionLimit `json:"limits"`
+	Enforcement  string                     `json:"enforcement"`
+}
+
+// 单个绩效等级的分布情况
+type DistributionGradeStat struct {
+	Grade      string   `json:"grade"`
+	Label      string   `json:"label"`
+	Count      int      `json:"count"`     // 已确定等级（待确认或已完成）的人数
+	Projected  int      `json:"projected"` // 加上待HR审核的评估按当前总分预估的人数
+	Percent    float64  `json:"percent"`   // 已确定人数占部门评估总数的比例
+	MaxPercent *float64 `json:"max_percent,omitempty"`
+	MinPercent *float64 `json:"min_percent,omitempty"`
+	MaxCount   *int     `json:"max_count,omitempty"`
+	MinCount   *int     `json:"min_count,omitempty"`
+	Status     string   `json:"status"` // ok, exceeded: 超出最多占比, insufficient: 低于最少占比, pending: 仍有评估未确定等级，暂不检查最少占比
+}
+
+// 部门强制分布检查结果
+type DistributionCheckResult struct {
+	DepartmentID   uint                      `json:"department_id"`
+	Year           int                       `json:"year"`
+	Month          *int                      `json:"month,omitempty"`
+	Quarter        *int                      `json:"quarter,omitempty"`
+	Quota          *models.DistributionQuota `json:"quota"`     // 适用的配额，为空表示未配置
+	Total          int                       `json:"total"`     // 部门该周期的评估总数（在职员工）
+	Confirmed      int                       `json:"confirmed"` // 已确定等级的评估数
+	Pending        int                       `json:"pending"`   // 尚未确定等级的评估数
+	Grades         []DistributionGradeStat   `json:"grades"`
+	Violations     []string                  `json:"violations"`
+	CandidateGrade string                    `json:"candidate_grade,omitempty"` // 即将进入待确认的评估的等级
+	Blocked        bool                      `json:"blocked"`                   // 按配额禁止该评估进入待确认
+}
+
+// distributionPeriodType 根据月份和季度推断考核周期类型
+func distributionPeriodType(month *int, quarter *int) string {
+	if month != nil {
+		return "monthly"
+	}
+	if quarter != nil {
+		return "quarterly"
+	}
+	return "yearly"
+}
+
+// intMatches 配额的周期条件为空时匹配任意值
+func intMatches(condition *int, value *int) bool {
+	return condition == nil || (value != nil && *condition == *value)
+}
+
+// resolveDistributionQuota 返回部门在该考核周期适用的配额：部门配置优先于全局配置，指定周期优先于所有周期
+func resolveDistributionQuota(departmentID uint, year int, month *int, quarter *int) (*models.DistributionQuota, error) {
+	var quotas []models.DistributionQuota
+	if err := models.DB.Where("department_id = ? OR department_id IS NULL", departmentID).Order("id DESC").Find(&quotas).Error; err != nil {
+		return nil, err
+	}
+
+	periodType := distributionPeriodType(month, quarter)
+	var best *models.DistributionQuota
+	bestRank := -1
+	for i := range quotas {
+		quota := &quotas[i]
+		if quota.Period != "" && quota.Period != periodType {
+			continue
+		}
+		if !intMatches(quota.Year, &year) || !intMatches(quota.Month, month) || !intMatches(quota.Quarter, quarter) {
+			continue
+		}
+		rank := 0
+		if quota.DepartmentID != nil {
+			rank += 8
+		}
+		if quota.Year != nil {
+			rank += 4
+		}
+		if quota.Month != nil || quota.Quarter != nil {
+			rank += 2
+		}
+		if quota.Period != "" {
+			rank++
+		}
+		if rank > bestRank {
+			best, bestRank = quota, rank
+		}
+	}
+	return best, nil
+}
+
+// checkDepartmentDistribution 统计部门在该考核周期的等级分布并与配额比较
+// 已完成的评估使用完成时确定的等级，待确认的评估按当前总分和等级区间预估；candidate 为即将进入待确认的评估，按 candidateScore 计入
+func checkDepartmentDistribution(departmentID uint, year int, month *int, quarter *int, candidate *models.KPIEvaluation, candidateScore float64) (*DistributionCheckResult, error) {
+	quota, err := resolveDistributionQuota(departmentID, year, month, quarter)
+	if err != nil {
+		return nil, err
+	}
+
+	var evaluations []models.KPIEvaluation
+	if err := models.DB.Model(&models.KPIEvaluation{}).
+		Joins("JOIN employees ON kpi_evaluations.employee_id = employees.id").
+		Where("employees.department_id = ? AND employees.is_active = ?", departmentID, true).
+		Where("kpi_evaluations.year = ? AND COALESCE(kpi_evaluations.month, 0) = ? AND COALESCE(kpi_evaluations.quarter, 0) = ?", year, periodPart(month), periodPart(quarter)).
+		Find(&evaluations).Error; err != nil {
+		return nil, err
+	}
+
+	result := &DistributionCheckResult{
+		DepartmentID: departmentID,
+		Year:         year,
+		Month:        month,
+		Quarter:      quarter,
+		Quota:        quota,
+		Total:        len(evaluations),
+		Violations:   []string{},
+	}
+
+	// 等级按组织默认等级排序，模板单独配置的等级和配额中的等级追加在后面
+	orgBands, err := resolveGradeBands(models.DB, 0)
+	if err != nil {
+		return nil, err
+	}
+	stats := make(map[string]*DistributionGradeStat)
+	order := make([]string, 0)
+	statOf := func(grade, label string) *DistributionGradeStat {
+		if stat, ok := stats[grade]; ok {
+			if stat.Label == "" {
+				stat.Label = label
+			}
+			return stat
+		}
+		stats[grade] = &DistributionGradeStat{Grade: grade, Label: label, Status: "ok"}
+		order = append(order, grade)
+		return stats[grade]
+	}
+	for _, band := range orgBands {
+		statOf(band.Grade, band.Label)
+	}
+	if quota != nil {
+		for _, limit := range quota.Limits {
+			statOf(limit.Grade, "")
+		}
+	}
+
+	bandsByTemplate := make(map[uint][]models.GradeBand)
+	projectGrade := func(evaluation *models.KPIEvaluation, score float64) (string, string, error) {
+		bands, ok := bandsByTemplate[evaluation.TemplateID]
+		if !ok {
+			bands, err = resolveGradeBands(models.DB, evaluation.TemplateID)
+			if err != nil {
+				return "", "", err
+			}
+			bandsByTemplate[evaluation.TemplateID] = bands
+		}
+		if band := matchGrade(bands, score); band != nil {
+			return band.Grade, band.Label, nil
+		}
+		return "", "", nil
+	}
+
+	for i := range evaluations {
+		evaluation := &evaluations[i]
+		status, score := evaluation.Status, evaluation.TotalScore
+		if candidate != nil && evaluation.ID == candidate.ID {
+			status, score = "pending_confirm", candidateScore
+		}
+
+		var grade, label string
+		switch status {
+		case "completed", "pending_confirm", "manager_evaluated":
+			grade, label = evaluation.Grade, evaluation.GradeLabel
+			if status != "completed" || grade == "" {
+				if grade, label, err = projectGrade(evaluation, score); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if candidate != nil && evaluation.ID == candidate.ID {
+			result.CandidateGrade = grade
+		}
+
+		if status == "completed" || status == "pending_confirm" {
+			result.Confirmed++
+		} else {
+			result.Pending++
+		}
+		if grade == "" {
+			continue
+		}
+		stat := statOf(grade, label)
+		stat.Projected++
+		if status == "completed" || status == "pending_confirm" {
+			stat.Count++
+		}
+	}
+
+	for _, grade := range order {
+		stat := stats[grade]
+		if result.Total > 0 {
+			stat.Percent = math.Round(float64(stat.Count)/float64(result.Total)*10000) / 100
+		}
+	}
+
+	// 与配额比较：最多占比按已确定人数检查，最少占比在全部评估确定等级后检查
+	exceeded := make(map[string]bool)
+	insufficient := false
+	if quota != nil {
+		for _, limit := range quota.Limits {
+			stat := stats[limit.Grade]
+			stat.MaxPercent = limit.MaxPercent
+			stat.MinPercent = limit.MinPercent
+			name := limit.Grade
+			if stat.Label != "" {
+				name = fmt.Sprintf("%s（%s）", limit.Grade, stat.Label)
+			}
+			if limit.MaxPercent != nil {
+				maxCount := int(math.Floor(float64(result.Total)**limit.MaxPercent/100 + 1e-9))
+				stat.MaxCount = &maxCount
+				if stat.Count > maxCount {
+					stat.Status = "exceeded"
+					exceeded[limit.Grade] = true
+					result.Violations = append(result.Violations, fmt.Sprintf("等级「%s」已有 %d 人，超出配额（最多 %s%%，即 %d 人）", name, stat.Count, formatScore(*limit.MaxPercent), maxCount))
+				}
+			}
+			if limit.MinPercent != nil {
+				minCount := int(math.Ceil(float64(result.Total)**limit.MinPercent/100 - 1e-9))
+				stat.MinCount = &minCount
+				if stat.Count < minCount && stat.Status == "ok" {
+					if result.Pending > 0 {
+						stat.Status = "pending"
+					} else {
+						stat.Status = "insufficient"
+						insufficient = true
+						result.Violations = append(result.Violations, fmt.Sprintf("等级「%s」仅 %d 人，低于配额（最少 %s%%，即 %d 人）", name, stat.Count, formatScore(*limit.MinPercent), minCount))
+					}
+				}
+			}
+		}
+	}
+
+	result.Grades = make([]DistributionGradeStat, 0, len(order))
+	for _, grade := range order {
+		result.Grades = append(result.Grades, *stats[grade])
+	}
+
+	// 硬性配额下，只拦截使超出的等级继续增加、或使最后确定时仍低于最少占比的评估
+	if candidate != nil && quota != nil && quota.Enforcement == distributionEnforcementBlock {
+		result.Blocked = exceeded[result.CandidateGrade] || insufficient
+	}
+	return result, nil
+}
+
+// checkEvaluationDistribution 评估进入待确认前，按其总分检查所在部门的强制分布配额
+func checkEvaluationDistribution(evaluation *models.KPIEvaluation, totalScore float64) (*DistributionCheckResult, error) {
+	var employee models.Employee
+	if err := models.DB.First(&employee, evaluation.EmployeeID).Error; err != nil {
+		return nil, err
+	}
+	return checkDepartmentDistribution(employee.DepartmentID, evaluation.Year, evaluation.Month, evaluation.Quarter, evaluation, totalScore)
+}
+
+// respondDistributionBlocked 按硬性配额拒绝进入待确认
+func respondDistributionBlocked(c *gin.Context, result *DistributionCheckResult) {
+	c.JSON(http.StatusConflict, gin.H{
+		"error":        "超出部门强制分布配额，不能进入待确认",
+		"message":      strings.Join(result.Violations, "；"),
+		"distribution": result,
+	})
+}
+
+// validateDistributionQuota 校验配额的适用范围和各等级占比
+func validateDistributionQuota(req *DistributionQuotaRequest) error {
+	switch req.Period {
+	case "", "monthly", "quarterly", "yearly":
+	default:
+		return fmt.Errorf("无效的考核周期类型：%s", req.Period)
+	}
+	if req.Month != nil && (req.Period != "monthly" || *req.Month < 1 || *req.Month > 12) {
+		return fmt.Errorf("指定月份时周期类型须为月度，月份须在1-12之间")
+	}
+	if req.Quarter != nil && (req.Period != "quarterly" || *req.Quarter < 1 || *req.Quarter > 4) {
+		return fmt.Errorf("指定季度时周期类型须为季度，季度须在1-4之间")
+	}
+
+	if req.Enforcement == "" {
+		req.Enforcement = distributionEnforcementWarn
+	}
+	if req.Enforcement != distributionEnforcementWarn && req.Enforcement != distributionEnforcementBlock {
+		return fmt.Errorf("无效的执行方式：%s", req.Enforcement)
+	}
+
+	if len(req.Limits) == 0 {
+		return fmt.Errorf("至少需要配置一个等级的占比限制")
+	}
+	seen := make(map[string]bool, len(req.Limits))
+	for i := range req.Limits {
+		limit := &req.Limits[i]
+		limit.Grade = strings.TrimSpace(limit.Grade)
+		if limit.Grade == "" {
+			return fmt.Errorf("等级代码不能为空")
+		}
+		if seen[limit.Grade] {
+			return fmt.Errorf("等级「%s」重复", limit.Grade)
+		}
+		seen[limit.Grade] = true
+		if limit.MaxPercent == nil && limit.MinPercent == nil {
+			return fmt.Errorf("等级「%s」至少需要设置最多占比或最少占比", limit.Grade)
+		}
+		if limit.MaxPercent != nil {
+			if err := validatePercentageValue(fmt.Sprintf("等级「%s」的最多占比", limit.Grade), *limit.MaxPercent); err != nil {
+				return err
+			}
+		}
+		if limit.MinPercent != nil {
+			if err := validatePercentageValue(fmt.Sprintf("等级「%s」的最少占比", limit.Grade), *limit.MinPercent); err != nil {
+				return err
+			}
+		}
+		if limit.MaxPercent != nil && limit.MinPercent != nil && *limit.MinPercent > *limit.MaxPercent {
+			return fmt.Errorf("等级「%s」的最少占比不能大于最多占比", limit.Grade)
+		}
+	}
+
+	if req.DepartmentID != nil {
+		var department models.Department
+		if err := models.DB.First(&department, *req.DepartmentID).Error; err != nil {
+			return fmt.Errorf("部门不存在")
+		}
+	}
+	return nil
+}
+
+// applyDistributionQuotaRequest 将请求写入配额
+func applyDistributionQuotaRequest(quota *models.DistributionQuota, req *DistributionQuotaRequest) {
+	quota.Name = strings.TrimSpace(req.Name)
+	quota.DepartmentID = req.DepartmentID
+	quota.Period = req.Period
+	quota.Year = req.Year
+	quota.Month = req.Month
+	quota.Quarter = req.Quarter
+	quota.Limits = req.Limits
+	quota.Enforcement = req.Enforcement
+}
+
+// 获取强制分布配额列表
+func GetDistributionQuotas(c *gin.Context) {
+	query := models.DB.Preload("Department")
+	if departmentID := c.Query("department_id"); departmentID != "" {
+		query = query.Where("department_id = ? OR department_id IS NULL", departmentID)
+	}
+
+	var quotas []models.DistributionQuota
+	if err := query.Order("id").Find(&quotas).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取强制分布配额失败",
+			"message": err.Error(),
+		})
+		return
+	}
+	sort.SliceStable(quotas, func(i, j int) bool {
+		return quotas[i].DepartmentID == nil && quotas[j].DepartmentID != nil
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  quotas,
+		"total": len(quotas),
+	})
+}
+
+// 创建强制分布配额
+func CreateDistributionQuota(c *gin.Context) {
+	var req DistributionQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := validateDistributionQuota(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var quota models.DistributionQuota
+	applyDistributionQuotaRequest(&quota, &req)
+	if err := models.DB.Create(&quota).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "创建强制分布配额失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "强制分布配额创建成功",
+		"data":    quota,
+	})
+}
+
+// 更新强制分布配额
+func UpdateDistributionQuota(c *gin.Context) {
+	quotaId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的配额ID",
+		})
+		return
+	}
+
+	var quota models.DistributionQuota
+	if err := models.DB.First(&quota, quotaId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "配额不存在",
+		})
+		return
+	}
+
+	var req DistributionQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := validateDistributionQuota(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	applyDistributionQuotaRequest(&quota, &req)
+	if err := models.DB.Save(&quota).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "更新强制分布配额失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "强制分布配额更新成功",
+		"data":    quota,
+	})
+}
+
+// 删除强制分布配额
+func DeleteDistributionQuota(c *gin.Context) {
+	quotaId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的配额ID",
+		})
+		return
+	}
+
+	result := models.DB.Delete(&models.DistributionQuota{}, quotaId)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "删除强制分布配额失败",
+			"message": result.Error.Error(),
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "配额不存在",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "强制分布配额删除成功",
+	})
+}
+
+// 检查部门在某个考核周期的等级分布是否符合配额
+func CheckDistribution(c *gin.Context) {
+	var query struct {
+		DepartmentID uint   `form:"department_id" binding:"required"`
+		Period       string `form:"period"`
+		Year         int    `form:"year" binding:"required"`
+		Month        *int   `form:"month"`
+		Quarter      *int   `form:"quarter"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+	if query.Period == "" {
+		query.Period = distributionPeriodType(query.Month, query.Quarter)
+	}
+	month, quarter, err := normalizeEvaluationPeriod(query.Period, query.Year, query.Month, query.Quarter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	result, err := checkDepartmentDistribution(query.DepartmentID, query.Year, month, quarter, nil, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "检查强制分布失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": result,
+	})
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"dootask-kpi-server/models"
+	"dootask-kpi-server/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 升级策略设置项
+const (
+	settingEscalationDays        = "escalation_days"         // 待主管评估超过多少天后升级，0表示不升级
+	settingEscalationAllowReview = "escalation_allow_review" // 升级接收人是否可以代为完成主管评分
+)
+
+// escalationSettings 读取升级策略设置
+func escalationSettings() (days int, allowReview bool) {
+	if value, err := GetSetting(settingEscalationDays); err == nil {
+		days, _ = strconv.Atoi(value)
+	}
+	if value, err := GetSetting(settingEscalationAllowReview); err == nil {
+		allowReview = value == "true"
+	}
+	return days, allowReview
+}
+
+// stageEnteredAt 返回评估进入当前状态的时间，没有状态变更历史时使用最后更新时间
+func stageEnteredAt(evaluation *models.KPIEvaluation) time.Time {
+	var history models.EvaluationHistory
+	result := models.DB.Where("evaluation_id = ? AND field = ? AND new_value = ?", evaluation.ID, "status", evaluation.Status).
+		Order("created_at DESC").Limit(1).Find(&history)
+	if result.Error == nil && result.RowsAffected > 0 {
+		return history.CreatedAt
+	}
+	return evaluation.UpdatedAt
+}
+
+// skipLevelManagers 沿 ManagerID 向上查找直属上级之上的各级上级，跳过已离职员工
+func skipLevelManagers(employee *models.Employee) []models.Employee {
+	chain := []models.Employee{}
+	if employee.ManagerID == nil {
+		return chain
+	}
+
+	visited := map[uint]bool{employee.ID: true, *employee.ManagerID: true}
+	var manager models.Employee
+	if err := models.DB.First(&manager, *employee.ManagerID).Error; err != nil {
+		return chain
+	}
+
+	nextID := manager.ManagerID
+	for nextID != nil && !visited[*nextID] {
+		visited[*nextID] = true
+		var next models.Employee
+		if err := models.DB.First(&next, *nextID).Error; err != nil {
+			break
+		}
+		if next.IsActive {
+			chain = append(chain, next)
+		}
+		nextID = next.ManagerID
+	}
+	return chain
+}
+
+// currentEscalationCondition 升级记录产生于评估最近一次进入待主管评估阶段之后
+// 评估被退回或重新打开后再次进入该阶段时，之前的升级不再有效
+const currentEscalationCondition = `evaluation_escalations.created_at >= COALESCE((SELECT MAX(h.created_at) FROM evaluation_histories h
+	WHERE h.evaluation_id = evaluation_escalations.evaluation_id AND h.field = 'status' AND h.new_value = 'self_evaluated'), evaluation_escalations.created_at)`
+
+// escalatedReviewer 判断用户是否因当前阶段的升级获得了该评估的主管评分权限
+func escalatedReviewer(evaluationID uint, userID uint) bool {
+	var count int64
+	models.DB.Model(&models.EvaluationEscalation{}).
+		Where("evaluation_id = ? AND escalated_to_id = ? AND status = ? AND can_review = ?", evaluationID, userID, "self_evaluated", true).
+		Where(currentEscalationCondition).
+		Count(&count)
+	return count > 0
+}
+
+// escalateStalledReviews 将待主管评估超时的评估逐级升级给上级的上级
+// 每超过一个升级周期上升一级，同一阶段每一级只升级一次
+func escalateStalledReviews(now time.Time) {
+	days, allowReview := escalationSettings()
+	if days <= 0 {
+		return
+	}
+	period := time.Duration(days) * 24 * time.Hour
+
+	var evaluations []models.KPIEvaluation
+	if err := models.DB.Preload("Employee").Preload("Template").Where("status = ?", "self_evaluated").Find(&evaluations).Error; err != nil {
+		fmt.Printf("获取待升级评估失败: %v\n", err)
+		return
+	}
+
+	for i := range evaluations {
+		evaluation := &evaluations[i]
+		if evaluation.Employee.ManagerID == nil {
+			continue
+		}
+
+		enteredAt := stageEnteredAt(evaluation)
+		dueLevel := int(now.Sub(enteredAt) / period)
+		if dueLevel < 1 {
+			continue
+		}
+
+		var escalatedLevel int
+		models.DB.Model(&models.EvaluationEscalation{}).
+			Where("evaluation_id = ? AND status = ? AND created_at >= ?", evaluation.ID, evaluation.Status, enteredAt).
+			Select("COALESCE(MAX(level), 0)").Scan(&escalatedLevel)
+		if escalatedLevel >= dueLevel {
+			continue
+		}
+
+		chain := skipLevelManagers(&evaluation.Employee)
+		for level := escalatedLevel + 1; level <= dueLevel && level <= len(chain); level++ {
+			target := chain[level-1]
+			escalation := models.EvaluationEscalation{
+				EvaluationID:    evaluation.ID,
+				Status:          evaluation.Status,
+				Level:           level,
+				DirectManagerID: evaluation.Employee.ManagerID,
+				EscalatedToID:   target.ID,
+				CanReview:       allowReview,
+			}
+			history := newHistoryRecorder(evaluation.ID, 0, historySourceEscalation)
+			history.change("escalated_to", "", target.Name)
+			if err := models.DB.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Create(&escalation).Error; err != nil {
+					return err
+				}
+				return history.save(tx)
+			}); err != nil {
+				fmt.Printf("记录评估升级失败: %v\n", err)
+				break
+			}
+
+			notifyEvaluationEscalated(os.Getenv(systemDooTaskTokenEnv), evaluation, &escalation, &target, int(now.Sub(enteredAt).Hours()/24))
+		}
+	}
+}
+
+// notifyEvaluationEscalated 通知升级接收人（DooTask 机器人通知 + 实时通知）
+// evaluation 需预加载 Employee 和 Template
+func notifyEvaluationEscalated(dooTaskToken string, evaluation *models.KPIEvaluation, escalation *models.EvaluationEscalation, target *models.Employee, waitedDays int) {
+	if target.DooTaskUserID != nil {
+		managerName := ""
+		var manager models.Employee
+		if escalation.DirectManagerID != nil && models.DB.First(&manager, *escalation.DirectManagerID).Error == nil {
+			managerName = manager.Name
+		}
+
+		action := "请督促直属上级尽快完成评分"
+		if escalation.CanReview {
+			action = "你可以督促直属上级尽快完成评分，或代为完成主管评分"
+		}
+
+		dooTaskClient := utils.NewDooTaskClient(dooTaskToken)
+		periodValue := utils.GetPeriodValue(evaluation.Period, evaluation.Year, evaluation.Month, evaluation.Quarter)
+		appConfigJSON := utils.BuildKPIAppConfig(evaluation.ID)
+		message := fmt.Sprintf(
+			"**绩效考核主管评分已超时**\n- 考核模板：%s\n- 考核周期：%s\n- 被评估员工：%s\n- 直属上级：%s\n- 已等待：%d 天\n- %s\n\n> <div class=\"open-micro-app\" data-app-config='%s'>查看详情：点击查看详情</div>",
+			evaluation.Template.Name,
+			periodValue,
+			evaluation.Employee.Name,
+			managerName,
+			waitedDays,
+			action,
+			appConfigJSON,
+		)
+		_ = dooTaskClient.SendBotMessage(target.DooTaskUserID, message)
+	}
+
+	GetNotificationService().SendNotification(0, EventEvaluationEscalated, evaluation)
+}
+
+// 启动评估升级任务：启动时检查一次，之后每小时检查一次
+func StartEscalationTask() {
+	go escalateStalledReviews(time.Now())
+
+	ticker := time.NewTicker(1 * time.Hour)
+	go func() {
+		for now := range ticker.C {
+			escalateStalledReviews(now)
+		}
+	}()
+}
+
+// 获取评估升级记录
+func GetEvaluationEscalations(c *gin.Context) {
+	id := c.Param("id")
+	evaluationId, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的评估ID",
+		})
+		return
+	}
+
+	var evaluation models.KPIEvaluation
+	if err := models.DB.Preload("Employee").First(&evaluation, evaluationId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "评估不存在",
+		})
+		return
+	}
+
+	var escalations []models.EvaluationEscalation
+	if err := models.DB.Preload("DirectManager").Preload("EscalatedTo").Where("evaluation_id = ?", evaluationId).
+		Order("created_at ASC, id ASC").Find(&escalations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取升级记录失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// 权限检查：HR、被评估员工本人、直属上级及升级接收人可以查看
+	userID := c.GetUint("user_id")
+	allowed := c.GetString("user_role") == "hr" || evaluation.EmployeeID == userID ||
+		(evaluation.Employee.ManagerID != nil && *evaluation.Employee.ManagerID == userID)
+	for _, escalation := range escalations {
+		if escalation.EscalatedToID == userID {
+			allowed = true
+		}
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "无权查看此评估的升级记录",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  escalations,
+		"total": len(escalations),
+	})
+}
@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"dootask-kpi-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 批量创建评估请求结构
+type BatchCreateEvaluationRequest struct {
+	TemplateID    uint   `json:"template_id" binding:"required"`
+	Period        string `json:"period" binding:"required,oneof=monthly quarterly yearly"`
+	Year          int    `json:"year" binding:"required"`
+	Month         *int   `json:"month"`
+	Quarter       *int   `json:"quarter"`
+	DepartmentIDs []uint `json:"department_ids"` // 按部门选择员工
+	EmployeeIDs   []uint `json:"employee_ids"`   // 按员工选择
+	AllActive     bool   `json:"all_active"`     // 所有在职员工
+}
+
+// 批量创建结果状态
+const (
+	batchResultCreated = "created"
+	batchResultSkipped = "skipped"
+	batchResultFailed  = "failed"
+)
+
+// 批量创建中单个员工的处理结果
+type BatchEvaluationResult struct {
+	EmployeeID   uint   `json:"employee_id"`
+	EmployeeName string `json:"employee_name"`
+	Status       string `json:"status"` // created, skipped, failed
+	EvaluationID uint   `json:"evaluation_id,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+// normalizeEvaluationPeriod 校验考核周期参数，并清理与周期类型无关的月份/季度
+func normalizeEvaluationPeriod(period string, year int, month *int, quarter *int) (*int, *int, error) {
+	if year < 2000 || year > 2100 {
+		return nil, nil, fmt.Errorf("无效的年份：%d", year)
+	}
+
+	switch period {
+	case "monthly":
+		if month == nil || *month < 1 || *month > 12 {
+			return nil, nil, fmt.Errorf("月度考核需要指定1-12之间的月份")
+		}
+		return month, nil, nil
+	case "quarterly":
+		if quarter == nil || *quarter < 1 || *quarter > 4 {
+			return nil, nil, fmt.Errorf("季度考核需要指定1-4之间的季度")
+		}
+		return nil, quarter, nil
+	default:
+		return nil, nil, nil
+	}
+}
+
+// samePeriodEvaluations 构造同一模板、同一考核周期的评估查询
+// 与评估唯一索引保持一致：未设置的月份和季度按 0 比较
+func samePeriodEvaluations(db *gorm.DB, templateID uint, year int, month *int, quarter *int) *gorm.DB {
+	return db.Model(&models.KPIEvaluation{}).
+		Where("template_id = ? AND year = ? AND COALESCE(month, 0) = ? AND COALESCE(quarter, 0) = ?", templateID, year, periodPart(month), periodPart(quarter))
+}
+
+// periodPart 返回月份或季度的取值，未设置时为 0
+func periodPart(value *int) int {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
+
+// 批量创建评估
+func BatchCreateEvaluations(c *gin.Context) {
+	var req BatchCreateEvaluationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if !req.AllActive && len(req.DepartmentIDs) == 0 && len(req.EmployeeIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请选择部门、员工或所有在职员工",
+		})
+		return
+	}
+
+	month, quarter, err := normalizeEvaluationPeriod(req.Period, req.Year, req.Month, req.Quarter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var template models.KPITemplate
+	if err := models.DB.First(&template, req.TemplateID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "模板不存在",
+		})
+		return
+	}
+	if !template.IsActive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "模板已停用",
+		})
+		return
+	}
+
+	source, err := templateEvaluationSource(models.DB, &template)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取KPI项目失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// 解析目标员工（只包含在职员工）
+	var employees []models.Employee
+	employeeQuery := models.DB.Where("is_active = ?", true)
+	if !req.AllActive {
+		employeeQuery = employeeQuery.Where("department_id IN ? OR id IN ?", append([]uint{0}, req.DepartmentIDs...), append([]uint{0}, req.EmployeeIDs...))
+	}
+	if err := employeeQuery.Order("id").Find(&employees).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取员工列表失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	results := make([]BatchEvaluationResult, 0, len(employees))
+
+	// 直接指定但不存在或已离职的员工
+	found := make(map[uint]bool, len(employees))
+	for _, employee := range employees {
+		found[employee.ID] = true
+	}
+	for _, employeeID := range req.EmployeeIDs {
+		if !found[employeeID] {
+			found[employeeID] = true
+			results = append(results, BatchEvaluationResult{
+				EmployeeID: employeeID,
+				Status:     batchResultFailed,
+				Reason:     "员工不存在或已离职",
+			})
+		}
+	}
+
+	created, err := createEvaluationsForEmployees(&template, source, req.Period, req.Year, month, quarter, employees)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "批量创建评估失败",
+			"message": err.Error(),
+		})
+		return
+	}
+	results = append(results, created...)
+
+	// 为每个新建的评估发送 DooTask 机器人通知和实时通知
+	notifyBatchCreatedEvaluations(c.GetHeader("DooTaskAuth"), c.GetUint("user_id"), created)
+
+	summary := gin.H{batchResultCreated: 0, batchResultSkipped: 0, batchResultFailed: 0}
+	for _, result := range results {
+		summary[result.Status] = summary[result.Status].(int) + 1
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": fmt.Sprintf("批量创建完成：新建 %d，跳过 %d，失败 %d", summary[batchResultCreated], summary[batchResultSkipped], summary[batchResultFailed]),
+		"data":    results,
+		"summary": summary,
+	})
+}
+
+// createEvaluationsForEmployees 为员工批量创建同一模板、同一周期的评估
+// 在同一事务中创建，已存在同周期评估的员工跳过，单个员工失败时回滚到保存点，不影响其他员工
+func createEvaluationsForEmployees(template *models.KPITemplate, source evaluationTemplate, period string, year int, month *int, quarter *int, employees []models.Employee) ([]BatchEvaluationResult, error) {
+	var existingEmployeeIDs []uint
+	if err := samePeriodEvaluations(models.DB, template.ID, year, month, quarter).Pluck("employee_id", &existingEmployeeIDs).Error; err != nil {
+		return nil, err
+	}
+	existing := make(map[uint]bool, len(existingEmployeeIDs))
+	for _, employeeID := range existingEmployeeIDs {
+		existing[employeeID] = true
+	}
+
+	tx := models.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	results := make([]BatchEvaluationResult, 0, len(employees))
+	for _, employee := range employees {
+		result := BatchEvaluationResult{
+			EmployeeID:   employee.ID,
+			EmployeeName: employee.Name,
+		}
+
+		if existing[employee.ID] {
+			result.Status = batchResultSkipped
+			result.Reason = "该周期已存在相同模板的考核"
+			results = append(results, result)
+			continue
+		}
+
+		savepoint := fmt.Sprintf("batch_employee_%d", employee.ID)
+		tx.SavePoint(savepoint)
+
+		evaluation := models.KPIEvaluation{
+			EmployeeID: employee.ID,
+			TemplateID: template.ID,
+			Period:     period,
+			Year:       year,
+			Month:      month,
+			Quarter:    quarter,
+			Status:     "pending",
+		}
+		source.apply(&evaluation)
+		applyGoalSetting(&evaluation, template)
+		applyTemplateDeadlines(&evaluation, template, time.Now())
+		if err := tx.Create(&evaluation).Error; err != nil {
+			tx.RollbackTo(savepoint)
+			result.Status = batchResultFailed
+			result.Reason = err.Error()
+			results = append(results, result)
+			continue
+		}
+		if err := createEvaluationScores(tx, &evaluation, source.Items); err != nil {
+			tx.RollbackTo(savepoint)
+			result.Status = batchResultFailed
+			result.Reason = err.Error()
+			results = append(results, result)
+			continue
+		}
+
+		result.Status = batchResultCreated
+		result.EvaluationID = evaluation.ID
+		results = append(results, result)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// notifyBatchCreatedEvaluations 为批量创建成功的评估逐个发送通知
+func notifyBatchCreatedEvaluations(dooTaskToken string, operatorID uint, results []BatchEvaluationResult) {
+	for _, result := range results {
+		if result.Status != batchResultCreated {
+			continue
+		}
+		var evaluation models.KPIEvaluation
+		if err := models.DB.Preload("Employee.Department").Preload("Template").Preload("Scores").First(&evaluation, result.EvaluationID).Error; err != nil {
+			continue
+		}
+		notifyEvaluationCreated(dooTaskToken, operatorID, &evaluation)
+	}
+}
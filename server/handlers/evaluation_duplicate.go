@@ -0,0 +1,417 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"dootask-kpi-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 重复评估处理方式
+const (
+	duplicateActionMerge  = "merge"  // 将重复评估中已填写的评分合并到保留的评估后删除
+	duplicateActionDelete = "delete" // 直接删除重复评估及其评分
+)
+
+// 重复评估分组（同一员工、同一模板、同一考核周期存在多份评估）
+type DuplicateEvaluationGroup struct {
+	EmployeeID      uint                   `json:"employee_id"`
+	TemplateID      uint                   `json:"template_id"`
+	Year            int                    `json:"year"`
+	Month           *int                   `json:"month,omitempty"`
+	Quarter         *int                   `json:"quarter,omitempty"`
+	Employee        models.Employee        `json:"employee"`
+	Template        models.KPITemplate     `json:"template"`
+	Evaluations     []models.KPIEvaluation `json:"evaluations"`
+	SuggestedKeepID uint                   `json:"suggested_keep_id"` // 建议保留的评估：流程最靠后、已填写评分最多、创建最早
+}
+
+// 处理重复评估请求结构
+type ResolveDuplicateEvaluationsRequest struct {
+	KeepID    uint   `json:"keep_id" binding:"required"`
+	RemoveIDs []uint `json:"remove_ids" binding:"required,min=1"`
+	Action    string `json:"action" binding:"required,oneof=merge delete"`
+}
+
+// findSamePeriodEvaluation 查找员工在同一模板、同一考核周期已有的评估，excludeID 不为0时排除该评估
+func findSamePeriodEvaluation(employeeID uint, templateID uint, year int, month *int, quarter *int, excludeID uint) *models.KPIEvaluation {
+	query := samePeriodEvaluations(models.DB, templateID, year, month, quarter).Where("employee_id = ?", employeeID)
+	if excludeID > 0 {
+		query = query.Where("id <> ?", excludeID)
+	}
+	var existing models.KPIEvaluation
+	result := query.Order("id ASC").Limit(1).Find(&existing)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil
+	}
+	return &existing
+}
+
+// isUniqueConstraintError 判断数据库错误是否由唯一索引冲突引起
+func isUniqueConstraintError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// respondEvaluationConflict 返回评估重复的冲突错误，existing 为空时不附带已有评估信息
+func respondEvaluationConflict(c *gin.Context, existing *models.KPIEvaluation) {
+	response := gin.H{
+		"error": "该员工在此考核周期已存在相同模板的评估",
+	}
+	if existing != nil {
+		response["message"] = fmt.Sprintf("已存在评估 #%d（%s）", existing.ID, getStatusText(existing.Status))
+		response["evaluation_id"] = existing.ID
+	}
+	c.JSON(http.StatusConflict, response)
+}
+
+// filledScoreCount 统计评估中已填写的评分数量
+func filledScoreCount(evaluation *models.KPIEvaluation) int {
+	count := 0
+	for _, score := range evaluation.Scores {
+		for _, value := range []*float64{score.SelfScore, score.ManagerScore, score.HRScore, score.FinalScore} {
+			if value != nil {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// 获取重复评估检测报告（仅HR）
+func GetDuplicateEvaluations(c *gin.Context) {
+	var keys []struct {
+		EmployeeID uint
+		TemplateID uint
+		Year       int
+		Month      int
+		Quarter    int
+	}
+	err := models.DB.Model(&models.KPIEvaluation{}).
+		Select("employee_id, template_id, year, COALESCE(month, 0) AS month, COALESCE(quarter, 0) AS quarter").
+		Group("employee_id, template_id, year, COALESCE(month, 0), COALESCE(quarter, 0)").
+		Having("COUNT(*) > 1").
+		Order("year DESC, month DESC, quarter DESC, template_id ASC, employee_id ASC").
+		Scan(&keys).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "检测重复评估失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	groups := make([]DuplicateEvaluationGroup, 0, len(keys))
+	redundant := 0
+	for _, key := range keys {
+		month, quarter := key.Month, key.Quarter
+		group := DuplicateEvaluationGroup{
+			EmployeeID: key.EmployeeID,
+			TemplateID: key.TemplateID,
+			Year:       key.Year,
+		}
+		if month > 0 {
+			group.Month = &month
+		}
+		if quarter > 0 {
+			group.Quarter = &quarter
+		}
+
+		err := samePeriodEvaluations(models.DB, key.TemplateID, key.Year, group.Month, group.Quarter).
+			Preload("Scores").Where("employee_id = ?", key.EmployeeID).Order("id ASC").Find(&group.Evaluations).Error
+		if err != nil || len(group.Evaluations) < 2 {
+			continue
+		}
+		models.DB.First(&group.Employee, key.EmployeeID)
+		models.DB.First(&group.Template, key.TemplateID)
+
+		suggested := group.Evaluations[0]
+		for _, evaluation := range group.Evaluations[1:] {
+			stage, suggestedStage := evaluationStageIndex(evaluation.Status), evaluationStageIndex(suggested.Status)
+			if stage > suggestedStage || (stage == suggestedStage && filledScoreCount(&evaluation) > filledScoreCount(&suggested)) {
+				suggested = evaluation
+			}
+		}
+		group.SuggestedKeepID = suggested.ID
+
+		redundant += len(group.Evaluations) - 1
+		groups = append(groups, group)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":                 groups,
+		"total":                len(groups),
+		"redundant":            redundant,
+		"unique_index_enabled": models.EvaluationUniqueIndexExists(),
+	})
+}
+
+// 处理重复评估（仅HR）：保留一份评估，合并或删除其余评估
+func ResolveDuplicateEvaluations(c *gin.Context) {
+	var req ResolveDuplicateEvaluationsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var keep models.KPIEvaluation
+	if err := models.DB.Preload("Scores").First(&keep, req.KeepID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "保留的评估不存在",
+		})
+		return
+	}
+
+	removed := make([]models.KPIEvaluation, 0, len(req.RemoveIDs))
+	seen := map[uint]bool{keep.ID: true}
+	for _, id := range req.RemoveIDs {
+		if seen[id] {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("评估 #%d 重复或与保留的评估相同", id),
+			})
+			return
+		}
+		seen[id] = true
+
+		var evaluation models.KPIEvaluation
+		if err := models.DB.Preload("Employee").Preload("Scores").First(&evaluation, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": fmt.Sprintf("评估 #%d 不存在", id),
+			})
+			return
+		}
+		if evaluation.EmployeeID != keep.EmployeeID || evaluation.TemplateID != keep.TemplateID || evaluation.Year != keep.Year ||
+			periodPart(evaluation.Month) != periodPart(keep.Month) || periodPart(evaluation.Quarter) != periodPart(keep.Quarter) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("评估 #%d 与保留的评估不属于同一员工、模板和考核周期", id),
+			})
+			return
+		}
+		removed = append(removed, evaluation)
+	}
+
+	operatorID := c.GetUint("user_id")
+	history := newHistoryRecorder(keep.ID, operatorID, historySourceDuplicate)
+	removedLabels := make([]string, 0, len(removed))
+	removedIDs := make([]uint, 0, len(removed))
+	for _, evaluation := range removed {
+		removedLabels = append(removedLabels, fmt.Sprintf("#%d", evaluation.ID))
+		removedIDs = append(removedIDs, evaluation.ID)
+	}
+	if req.Action == duplicateActionMerge {
+		history.change("merged_duplicates", "", strings.Join(removedLabels, ", "))
+	} else {
+		history.change("deleted_duplicates", "", strings.Join(removedLabels, ", "))
+	}
+
+	tx := models.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if req.Action == duplicateActionMerge {
+		if err := mergeDuplicateEvaluations(tx, &keep, removed, history); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "合并重复评估失败",
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+
+	if err := deleteEvaluationRecords(tx, removedIDs); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "删除重复评估失败",
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := history.save(tx); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "记录变更历史失败",
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "处理重复评估失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// 重复评估处理完后尝试补建唯一索引
+	indexEnabled := models.EnsureEvaluationUniqueIndex() == nil
+
+	models.DB.Preload("Employee.Department").Preload("Template").Preload("Scores.Item").First(&keep, keep.ID)
+	applyItemSnapshots(keep.Scores)
+
+	// 发送实时通知
+	for i := range removed {
+		GetNotificationService().SendNotification(operatorID, EventEvaluationDeleted, &removed[i])
+	}
+	GetNotificationService().SendNotification(operatorID, EventEvaluationUpdated, &keep)
+
+	message := "重复评估已删除"
+	if req.Action == duplicateActionMerge {
+		message = "重复评估已合并"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":              message,
+		"data":                 keep,
+		"removed_ids":          removedIDs,
+		"unique_index_enabled": indexEnabled,
+	})
+}
+
+// mergeDuplicateEvaluations 将重复评估中已填写的内容补充到保留的评估
+// 保留评估中已有的评分不会被覆盖；按 removed 的顺序取第一个有值的评分
+// 保留评估中缺少的评分项直接转移过来，评论和邀请也一并转移
+func mergeDuplicateEvaluations(tx *gorm.DB, keep *models.KPIEvaluation, removed []models.KPIEvaluation, history *historyRecorder) error {
+	scoreByItem := make(map[uint]*models.KPIScore, len(keep.Scores))
+	for _, score := range keep.Scores {
+		score := score
+		scoreByItem[score.ItemID] = &score
+	}
+
+	scoresChanged := false
+	for _, evaluation := range removed {
+		for _, source := range evaluation.Scores {
+			target, ok := scoreByItem[source.ItemID]
+			if !ok {
+				if err := tx.Model(&models.KPIScore{}).Where("id = ?", source.ID).Update("evaluation_id", keep.ID).Error; err != nil {
+					return err
+				}
+				moved := source
+				moved.EvaluationID = keep.ID
+				scoreByItem[moved.ItemID] = &moved
+				history.scoreChange(&moved, "merged_from", "", fmt.Sprintf("#%d", evaluation.ID))
+				scoresChanged = true
+				continue
+			}
+
+			updates := map[string]interface{}{}
+			if target.SelfScore == nil && source.SelfScore != nil {
+				history.scoreChange(target, "self_score", target.SelfScore, source.SelfScore)
+				history.scoreChange(target, "self_comment", target.SelfComment, source.SelfComment)
+				updates["self_score"] = source.SelfScore
+				updates["self_comment"] = source.SelfComment
+				target.SelfScore, target.SelfComment = source.SelfScore, source.SelfComment
+			}
+			if target.ManagerScore == nil && source.ManagerScore != nil {
+				history.scoreChange(target, "manager_score", target.ManagerScore, source.ManagerScore)
+				history.scoreChange(target, "manager_comment", target.ManagerComment, source.ManagerComment)
+				updates["manager_score"] = source.ManagerScore
+				updates["manager_comment"] = source.ManagerComment
+				updates["manager_auto"] = source.ManagerAuto
+				updates["manager_reviewer_id"] = source.ManagerReviewerID
+				updates["manager_on_behalf_of_id"] = source.ManagerOnBehalfOfID
+				target.ManagerScore, target.ManagerComment = source.ManagerScore, source.ManagerComment
+			}
+			if target.HRScore == nil && source.HRScore != nil {
+				history.scoreChange(target, "hr_score", target.HRScore, source.HRScore)
+				history.scoreChange(target, "hr_comment", target.HRComment, source.HRComment)
+				updates["hr_score"] = source.HRScore
+				updates["hr_comment"] = source.HRComment
+				target.HRScore, target.HRComment = source.HRScore, source.HRComment
+			}
+			if target.FinalScore == nil && source.FinalScore != nil {
+				history.scoreChange(target, "final_score", target.FinalScore, source.FinalScore)
+				history.scoreChange(target, "final_comment", target.FinalComment, source.FinalComment)
+				updates["final_score"] = source.FinalScore
+				updates["final_comment"] = source.FinalComment
+				target.FinalScore, target.FinalComment = source.FinalScore, source.FinalComment
+			}
+			if len(updates) > 0 {
+				if err := tx.Model(&models.KPIScore{}).Where("id = ?", target.ID).Updates(updates).Error; err != nil {
+					return err
+				}
+				scoresChanged = true
+			}
+		}
+
+		if keep.FinalComment == "" && evaluation.FinalComment != "" {
+			history.change("final_comment", keep.FinalComment, evaluation.FinalComment)
+			if err := tx.Model(&models.KPIEvaluation{}).Where("id = ?", keep.ID).Update("final_comment", evaluation.FinalComment).Error; err != nil {
+				return err
+			}
+			keep.FinalComment = evaluation.FinalComment
+		}
+
+		// 评论和邀请转移到保留的评估
+		if err := tx.Model(&models.EvaluationComment{}).Where("evaluation_id = ?", evaluation.ID).Update("evaluation_id", keep.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.EvaluationInvitation{}).Where("evaluation_id = ?", evaluation.ID).Update("evaluation_id", keep.ID).Error; err != nil {
+			return err
+		}
+	}
+
+	if !scoresChanged {
+		return nil
+	}
+
+	scores := make([]models.KPIScore, 0, len(scoreByItem))
+	for _, score := range scoreByItem {
+		scores = append(scores, *score)
+	}
+	totalScore, rawScore := evaluationTotalScore(keep, scores)
+	history.change("total_score", keep.TotalScore, totalScore)
+	history.change("raw_score", keep.RawScore, rawScore)
+	if err := tx.Model(&models.KPIEvaluation{}).Where("id = ?", keep.ID).Updates(map[string]interface{}{
+		"total_score": totalScore,
+		"raw_score":   rawScore,
+	}).Error; err != nil {
+		return err
+	}
+	keep.TotalScore = totalScore
+	keep.RawScore = rawScore
+	if keep.Status == "completed" {
+		return assignEvaluationGrade(tx, keep, history)
+	}
+	return nil
+}
+
+// deleteEvaluationRecords 删除评估及其评分、目标、邀请、评论、提醒、升级、审批和校准记录（变更历史保留备查）
+// 目标设定时为评估额外增加的考核项目（template_id 为0）一并删除
+func deleteEvaluationRecords(tx *gorm.DB, evaluationIDs []uint) error {
+	if len(evaluationIDs) == 0 {
+		return nil
+	}
+	itemIDs := tx.Model(&models.KPIScore{}).Select("item_id").Where("evaluation_id IN ?", evaluationIDs)
+	if err := tx.Where("template_id = 0 AND id IN (?)", itemIDs).Delete(&models.KPIItem{}).Error; err != nil {
+		return err
+	}
+	invitationIDs := tx.Model(&models.EvaluationInvitation{}).Select("id").Where("evaluation_id IN ?", evaluationIDs)
+	if err := tx.Where("invitation_id IN (?)", invitationIDs).Delete(&models.InvitedScore{}).Error; err != nil {
+		return err
+	}
+	for _, model := range []interface{}{
+		&models.KPIScore{},
+		&models.EvaluationGoal{},
+		&models.EvaluationInvitation{},
+		&models.EvaluationComment{},
+		&models.EvaluationReminder{},
+		&models.EvaluationEscalation{},
+		&models.EvaluationApproval{},
+		&models.CalibrationEvaluation{},
+		&models.CalibrationAdjustment{},
+	} {
+		if err := tx.Where("evaluation_id IN ?", evaluationIDs).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Delete(&models.KPIEvaluation{}, evaluationIDs).Error
+}
@@ -0,0 +1,476 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"dootask-kpi-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 周期考核运行记录的触发方式与结果
+const (
+	scheduleTriggerSchedule = "schedule" // 按计划开启
+	scheduleTriggerCatchUp  = "catch_up" // 服务重启后补开
+
+	scheduleRunSuccess = "success"
+	scheduleRunPartial = "partial" // 部分员工创建失败，下次检查时重试
+	scheduleRunFailed  = "failed"
+)
+
+// 定时任务没有请求上下文，DooTask 机器人通知使用此环境变量中的令牌，未配置时仅发送实时通知
+const systemDooTaskTokenEnv = "DOOTASK_SYSTEM_TOKEN"
+
+var scheduleMutex sync.Mutex
+
+// EvaluationSchedulePayload 周期考核配置请求结构
+type EvaluationSchedulePayload struct {
+	Enabled     bool `json:"enabled"`
+	DayOfPeriod int  `json:"day_of_period" binding:"required,min=1,max=366"`
+}
+
+// scheduledPeriod 某个模板在某个考核周期的开启计划
+type scheduledPeriod struct {
+	Template   models.KPITemplate `json:"template"`
+	Period     string             `json:"period"`
+	Year       int                `json:"year"`
+	Month      *int               `json:"month,omitempty"`
+	Quarter    *int               `json:"quarter,omitempty"`
+	PeriodFrom time.Time          `json:"period_from"`
+	DueAt      time.Time          `json:"due_at"` // 计划开启时间
+	Opened     bool               `json:"opened"` // 本周期是否已开启
+}
+
+// currentEvaluationPeriod 计算 now 所在的考核周期及其起止时间（结束时间不含）
+func currentEvaluationPeriod(period string, now time.Time) (year int, month *int, quarter *int, from time.Time, to time.Time, ok bool) {
+	year = now.Year()
+	switch period {
+	case "monthly":
+		m := int(now.Month())
+		month = &m
+		from = time.Date(year, now.Month(), 1, 0, 0, 0, 0, now.Location())
+		to = from.AddDate(0, 1, 0)
+	case "quarterly":
+		q := (int(now.Month())-1)/3 + 1
+		quarter = &q
+		from = time.Date(year, time.Month((q-1)*3+1), 1, 0, 0, 0, 0, now.Location())
+		to = from.AddDate(0, 3, 0)
+	case "yearly":
+		from = time.Date(year, time.January, 1, 0, 0, 0, 0, now.Location())
+		to = from.AddDate(1, 0, 0)
+	default:
+		return 0, nil, nil, time.Time{}, time.Time{}, false
+	}
+	return year, month, quarter, from, to, true
+}
+
+// periodStart 返回考核周期（年 + 月/季度）的开始时间
+func periodStart(period string, year int, month *int, quarter *int, loc *time.Location) time.Time {
+	switch {
+	case period == "monthly" && month != nil:
+		return time.Date(year, time.Month(*month), 1, 0, 0, 0, 0, loc)
+	case period == "quarterly" && quarter != nil:
+		return time.Date(year, time.Month((*quarter-1)*3+1), 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+	}
+}
+
+// scheduleRunStatus 按创建结果确定运行状态：全部失败为失败，部分失败为部分成功
+func scheduleRunStatus(run *models.EvaluationScheduleRun) string {
+	switch {
+	case run.FailedCount == 0:
+		return scheduleRunSuccess
+	case run.CreatedCount+run.SkippedCount == 0:
+		return scheduleRunFailed
+	default:
+		return scheduleRunPartial
+	}
+}
+
+// scheduleDueAt 计算周期内的计划开启时间，天数超出周期长度时取周期最后一天
+func scheduleDueAt(from, to time.Time, dayOfPeriod int) time.Time {
+	if dayOfPeriod < 1 {
+		dayOfPeriod = 1
+	}
+	dueAt := from.AddDate(0, 0, dayOfPeriod-1)
+	if !dueAt.Before(to) {
+		dueAt = to.AddDate(0, 0, -1)
+	}
+	return dueAt
+}
+
+// loadEvaluationSchedule 获取周期考核配置，不存在时返回默认配置
+func loadEvaluationSchedule() (models.EvaluationSchedule, error) {
+	var schedule models.EvaluationSchedule
+	result := models.DB.First(&schedule)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return models.DefaultEvaluationSchedule(), nil
+	}
+	return schedule, result.Error
+}
+
+// firstPendingPeriodFrom 返回模板需要开启的第一个考核周期的开始时间
+// 从最近一次成功开启的下一个周期开始，补开服务停机期间错过的周期；不早于周期考核配置最后保存时所在的周期
+func firstPendingPeriodFrom(template *models.KPITemplate, schedule models.EvaluationSchedule, now time.Time) (time.Time, error) {
+	_, _, _, from, _, _ := currentEvaluationPeriod(template.Period, now)
+	if !schedule.UpdatedAt.IsZero() {
+		_, _, _, from, _, _ = currentEvaluationPeriod(template.Period, schedule.UpdatedAt.In(now.Location()))
+	}
+
+	var last models.EvaluationScheduleRun
+	err := models.DB.Where("template_id = ? AND period = ? AND status = ?", template.ID, template.Period, scheduleRunSuccess).
+		Order("year DESC, COALESCE(month, 0) DESC, COALESCE(quarter, 0) DESC").First(&last).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return from, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	_, _, _, _, next, _ := currentEvaluationPeriod(template.Period, periodStart(last.Period, last.Year, last.Month, last.Quarter, now.Location()))
+	if next.After(from) {
+		from = next
+	}
+	return from, nil
+}
+
+// buildScheduledPeriods 计算所有启用模板从第一个待开启周期到 now 所在周期的开启计划
+func buildScheduledPeriods(schedule models.EvaluationSchedule, now time.Time) ([]scheduledPeriod, error) {
+	var templates []models.KPITemplate
+	if err := models.DB.Where("is_active = ?", true).Order("id").Find(&templates).Error; err != nil {
+		return nil, err
+	}
+
+	plans := []scheduledPeriod{}
+	for _, template := range templates {
+		if _, _, _, _, _, ok := currentEvaluationPeriod(template.Period, now); !ok {
+			continue
+		}
+		start, err := firstPendingPeriodFrom(&template, schedule, now)
+		if err != nil {
+			return nil, err
+		}
+
+		for cursor := start; !cursor.After(now); {
+			year, month, quarter, from, to, _ := currentEvaluationPeriod(template.Period, cursor)
+			cursor = to
+
+			var successCount int64
+			runQuery := models.DB.Model(&models.EvaluationScheduleRun{}).
+				Where("template_id = ? AND year = ? AND status = ?", template.ID, year, scheduleRunSuccess)
+			if month != nil {
+				runQuery = runQuery.Where("month = ?", *month)
+			}
+			if quarter != nil {
+				runQuery = runQuery.Where("quarter = ?", *quarter)
+			}
+			if err := runQuery.Count(&successCount).Error; err != nil {
+				return nil, err
+			}
+
+			plans = append(plans, scheduledPeriod{
+				Template:   template,
+				Period:     template.Period,
+				Year:       year,
+				Month:      month,
+				Quarter:    quarter,
+				PeriodFrom: from,
+				DueAt:      scheduleDueAt(from, to, schedule.DayOfPeriod),
+				Opened:     successCount > 0,
+			})
+		}
+	}
+	return plans, nil
+}
+
+// runEvaluationSchedule 开启所有已到期且尚未开启的周期考核
+func runEvaluationSchedule(now time.Time, trigger string) {
+	scheduleMutex.Lock()
+	defer scheduleMutex.Unlock()
+
+	schedule, err := loadEvaluationSchedule()
+	if err != nil {
+		fmt.Printf("获取周期考核配置失败: %v\n", err)
+		return
+	}
+	if !schedule.Enabled {
+		return
+	}
+
+	plans, err := buildScheduledPeriods(schedule, now)
+	if err != nil {
+		fmt.Printf("计算周期考核计划失败: %v\n", err)
+		return
+	}
+
+	for _, plan := range plans {
+		if plan.Opened || now.Before(plan.DueAt) {
+			continue
+		}
+
+		employees, err := templateAssignedEmployees(plan.Template.ID)
+		if err != nil {
+			fmt.Printf("获取模板 %d 适用员工失败: %v\n", plan.Template.ID, err)
+			continue
+		}
+		// 未设置适用范围的模板不自动开启
+		if len(employees) == 0 {
+			continue
+		}
+
+		run := models.EvaluationScheduleRun{
+			TemplateID: plan.Template.ID,
+			Period:     plan.Period,
+			Year:       plan.Year,
+			Month:      plan.Month,
+			Quarter:    plan.Quarter,
+			Trigger:    trigger,
+		}
+
+		results := []BatchEvaluationResult{}
+		source, err := templateEvaluationSource(models.DB, &plan.Template)
+		if err == nil {
+			results, err = createEvaluationsForEmployees(&plan.Template, source, plan.Period, plan.Year, plan.Month, plan.Quarter, employees)
+		}
+		if err != nil {
+			run.Status = scheduleRunFailed
+			run.Message = err.Error()
+		} else {
+			for _, result := range results {
+				switch result.Status {
+				case batchResultCreated:
+					run.CreatedCount++
+				case batchResultSkipped:
+					run.SkippedCount++
+				case batchResultFailed:
+					run.FailedCount++
+				}
+			}
+			run.Status = scheduleRunStatus(&run)
+			run.Message = fmt.Sprintf("新建 %d，跳过 %d，失败 %d", run.CreatedCount, run.SkippedCount, run.FailedCount)
+		}
+
+		if err := models.DB.Create(&run).Error; err != nil {
+			fmt.Printf("记录周期考核运行日志失败: %v\n", err)
+		}
+
+		notifyBatchCreatedEvaluations(os.Getenv(systemDooTaskTokenEnv), 0, results)
+	}
+}
+
+// 启动周期考核定时任务：启动时先补开错过的周期，之后每小时检查一次（未成功开启的周期会再次尝试）
+func StartEvaluationScheduler() {
+	go runEvaluationSchedule(time.Now(), scheduleTriggerCatchUp)
+
+	ticker := time.NewTicker(1 * time.Hour)
+	go func() {
+		for now := range ticker.C {
+			runEvaluationSchedule(now, scheduleTriggerSchedule)
+		}
+	}()
+}
+
+// GetEvaluationSchedule 获取周期考核配置
+func GetEvaluationSchedule(c *gin.Context) {
+	schedule, err := loadEvaluationSchedule()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取周期考核配置失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": schedule,
+	})
+}
+
+// UpdateEvaluationSchedule 更新周期考核配置
+func UpdateEvaluationSchedule(c *gin.Context) {
+	var payload EvaluationSchedulePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	schedule, err := loadEvaluationSchedule()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取周期考核配置失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	schedule.Enabled = payload.Enabled
+	schedule.DayOfPeriod = payload.DayOfPeriod
+
+	if err := models.DB.Save(&schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "更新周期考核配置失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// 配置变更后立即检查一次，开启已到期的周期
+	if schedule.Enabled {
+		go runEvaluationSchedule(time.Now(), scheduleTriggerSchedule)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "周期考核配置更新成功",
+		"data":    schedule,
+	})
+}
+
+// PreviewEvaluationSchedule 预览周期考核（不创建数据），可通过 date 参数预览指定日期
+func PreviewEvaluationSchedule(c *gin.Context) {
+	now := time.Now()
+	if date := c.Query("date"); date != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", date, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "无效的日期，格式应为 YYYY-MM-DD",
+			})
+			return
+		}
+		now = parsed.Add(24*time.Hour - time.Second)
+	}
+
+	schedule, err := loadEvaluationSchedule()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取周期考核配置失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	plans, err := buildScheduledPeriods(schedule, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "计算周期考核计划失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	type previewEmployee struct {
+		EmployeeID   uint   `json:"employee_id"`
+		EmployeeName string `json:"employee_name"`
+		Status       string `json:"status"` // created: 将新建, skipped: 已存在将跳过
+	}
+	type previewPlan struct {
+		scheduledPeriod
+		Due       bool              `json:"due"` // 是否已到开启时间
+		Employees []previewEmployee `json:"employees"`
+	}
+
+	previews := make([]previewPlan, 0, len(plans))
+	for _, plan := range plans {
+		employees, err := templateAssignedEmployees(plan.Template.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "获取模板适用员工失败",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		var existingEmployeeIDs []uint
+		samePeriodEvaluations(models.DB, plan.Template.ID, plan.Year, plan.Month, plan.Quarter).Pluck("employee_id", &existingEmployeeIDs)
+		existing := make(map[uint]bool, len(existingEmployeeIDs))
+		for _, employeeID := range existingEmployeeIDs {
+			existing[employeeID] = true
+		}
+
+		preview := previewPlan{
+			scheduledPeriod: plan,
+			Due:             !now.Before(plan.DueAt),
+			Employees:       make([]previewEmployee, 0, len(employees)),
+		}
+		for _, employee := range employees {
+			status := batchResultCreated
+			if existing[employee.ID] {
+				status = batchResultSkipped
+			}
+			preview.Employees = append(preview.Employees, previewEmployee{
+				EmployeeID:   employee.ID,
+				EmployeeName: employee.Name,
+				Status:       status,
+			})
+		}
+		previews = append(previews, preview)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"schedule": schedule,
+			"date":     now.Format("2006-01-02"),
+			"plans":    previews,
+		},
+	})
+}
+
+// GetEvaluationScheduleRuns 获取周期考核运行记录
+func GetEvaluationScheduleRuns(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	query := models.DB.Model(&models.EvaluationScheduleRun{})
+	if templateID := c.Query("template_id"); templateID != "" {
+		query = query.Where("template_id = ?", templateID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取运行记录总数失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var runs []models.EvaluationScheduleRun
+	offset := (page - 1) * pageSize
+	if err := query.Preload("Template").Offset(offset).Limit(pageSize).Order("created_at DESC, id DESC").Find(&runs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取运行记录失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	totalPages := int((total + int64(pageSize) - 1) / int64(pageSize))
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       runs,
+		"total":      total,
+		"page":       page,
+		"pageSize":   pageSize,
+		"totalPages": totalPages,
+		"hasNext":    page < totalPages,
+		"hasPrev":    page > 1,
+	})
+}
@@ -73,6 +73,7 @@ func ExportEvaluationToExcel(c *gin.Context) {
 		})
 		return
 	}
+	applyItemSnapshots(evaluation.Scores)
 
 	// 创建Excel文件
 	f := excelize.NewFile()
@@ -123,6 +124,16 @@ func ExportEvaluationToExcel(c *gin.Context) {
 	f.SetCellValue(sheetName, "D"+strconv.Itoa(row), "状态:")
 	f.SetCellValue(sheetName, "E"+strconv.Itoa(row), getStatusText(evaluation.Status))
 
+	row++
+	f.SetCellValue(sheetName, "A"+strconv.Itoa(row), "计分方式:")
+	f.SetCellValue(sheetName, "B"+strconv.Itoa(row), getScoringModeText(evaluation.ScoringMode))
+	f.SetCellValue(sheetName, "D"+strconv.Itoa(row), "原始得分:")
+	f.SetCellValue(sheetName, "E"+strconv.Itoa(row), evaluation.RawScore)
+
+	row++
+	f.SetCellValue(sheetName, "A"+strconv.Itoa(row), "绩效等级:")
+	f.SetCellValue(sheetName, "B"+strconv.Itoa(row), formatGrade(&evaluation))
+
 	// 设置表头
 	row += 2
 	headers := []string{"考核项目", "满分", "自评分", "自评说明", "主管评分", "主管说明", "最终得分"}
@@ -156,21 +167,21 @@ func ExportEvaluationToExcel(c *gin.Context) {
 	// 设置数据
 	for _, score := range evaluation.Scores {
 		row++
-		f.SetCellValue(sheetName, "A"+strconv.Itoa(row), score.Item.Name)
-		f.SetCellValue(sheetName, "B"+strconv.Itoa(row), score.Item.MaxScore)
+		f.SetCellValue(sheetName, "A"+strconv.Itoa(row), exportItemName(&evaluation, &score))
+		f.SetCellValue(sheetName, "B"+strconv.Itoa(row), exportItemMaxScore(&score.Item))
 
 		if score.SelfScore != nil {
-			f.SetCellValue(sheetName, "C"+strconv.Itoa(row), *score.SelfScore)
+			f.SetCellValue(sheetName, "C"+strconv.Itoa(row), exportItemScore(&score.Item, *score.SelfScore))
 		}
 		f.SetCellValue(sheetName, "D"+strconv.Itoa(row), score.SelfComment)
 
 		if score.ManagerScore != nil {
-			f.SetCellValue(sheetName, "E"+strconv.Itoa(row), *score.ManagerScore)
+			f.SetCellValue(sheetName, "E"+strconv.Itoa(row), exportItemScore(&score.Item, *score.ManagerScore))
 		}
 		f.SetCellValue(sheetName, "F"+strconv.Itoa(row), score.ManagerComment)
 
 		if score.FinalScore != nil {
-			f.SetCellValue(sheetName, "G"+strconv.Itoa(row), *score.FinalScore)
+			f.SetCellValue(sheetName, "G"+strconv.Itoa(row), exportItemScore(&score.Item, *score.FinalScore))
 		}
 
 		// 设置数据行样式
@@ -306,7 +317,7 @@ func ExportDepartmentToExcel(c *gin.Context) {
 
 	// 设置标题
 	f.SetCellValue(sheetName, "A1", fmt.Sprintf("%s 评估汇总报告", department.Name))
-	f.MergeCell(sheetName, "A1", "H1")
+	f.MergeCell(sheetName, "A1", "I1")
 
 	// 设置标题样式
 	titleStyle, _ := f.NewStyle(&excelize.Style{
@@ -319,11 +330,11 @@ func ExportDepartmentToExcel(c *gin.Context) {
 			Vertical:   "center",
 		},
 	})
-	f.SetCellStyle(sheetName, "A1", "H1", titleStyle)
+	f.SetCellStyle(sheetName, "A1", "I1", titleStyle)
 
 	// 设置表头
 	row := 3
-	headers := []string{"序号", "员工姓名", "考核模板", "考核周期", "总分", "状态", "创建时间", "最后更新"}
+	headers := []string{"序号", "员工姓名", "考核模板", "考核周期", "总分", "绩效等级", "状态", "创建时间", "最后更新"}
 	for i, header := range headers {
 		cell := string(rune('A'+i)) + strconv.Itoa(row)
 		f.SetCellValue(sheetName, cell, header)
@@ -359,9 +370,10 @@ func ExportDepartmentToExcel(c *gin.Context) {
 		f.SetCellValue(sheetName, "C"+strconv.Itoa(row), evaluation.Template.Name)
 		f.SetCellValue(sheetName, "D"+strconv.Itoa(row), evaluation.Period)
 		f.SetCellValue(sheetName, "E"+strconv.Itoa(row), evaluation.TotalScore)
-		f.SetCellValue(sheetName, "F"+strconv.Itoa(row), getStatusText(evaluation.Status))
-		f.SetCellValue(sheetName, "G"+strconv.Itoa(row), evaluation.CreatedAt.Format("2006-01-02 15:04:05"))
-		f.SetCellValue(sheetName, "H"+strconv.Itoa(row), evaluation.UpdatedAt.Format("2006-01-02 15:04:05"))
+		f.SetCellValue(sheetName, "F"+strconv.Itoa(row), formatGrade(&evaluation))
+		f.SetCellValue(sheetName, "G"+strconv.Itoa(row), getStatusText(evaluation.Status))
+		f.SetCellValue(sheetName, "H"+strconv.Itoa(row), evaluation.CreatedAt.Format("2006-01-02 15:04:05"))
+		f.SetCellValue(sheetName, "I"+strconv.Itoa(row), evaluation.UpdatedAt.Format("2006-01-02 15:04:05"))
 
 		// 设置数据行样式
 		dataStyle, _ := f.NewStyle(&excelize.Style{
@@ -384,9 +396,10 @@ func ExportDepartmentToExcel(c *gin.Context) {
 	f.SetColWidth(sheetName, "C", "C", 25)
 	f.SetColWidth(sheetName, "D", "D", 15)
 	f.SetColWidth(sheetName, "E", "E", 10)
-	f.SetColWidth(sheetName, "F", "F", 15)
-	f.SetColWidth(sheetName, "G", "G", 20)
+	f.SetColWidth(sheetName, "F", "F", 12)
+	f.SetColWidth(sheetName, "G", "G", 15)
 	f.SetColWidth(sheetName, "H", "H", 20)
+	f.SetColWidth(sheetName, "I", "I", 20)
 
 	// 创建公共导出目录
 	if err := os.MkdirAll(ExportDir, 0755); err != nil {
@@ -481,6 +494,16 @@ func ExportPeriodToExcel(c *gin.Context) {
 			Find(&invitations)
 	}
 
+	// 考核项目名称和满分使用评估创建时的快照
+	itemSnapshots := make(map[uint]map[uint]models.KPIItem, len(evaluations))
+	for i := range evaluations {
+		applyItemSnapshots(evaluations[i].Scores)
+		itemSnapshots[evaluations[i].ID] = itemSnapshotsOf(evaluations[i].Scores)
+	}
+	for i := range invitations {
+		applyInvitedItemSnapshots(itemSnapshots[invitations[i].EvaluationID], invitations[i].Scores)
+	}
+
 	// 创建Excel文件
 	f := excelize.NewFile()
 	defer func() {
@@ -621,7 +644,7 @@ func DownloadFile(c *gin.Context) {
 func createOverviewSheet(f *excelize.File, sheetName, title string, evaluations []models.KPIEvaluation) {
 	// 设置标题
 	f.SetCellValue(sheetName, "A1", title)
-	f.MergeCell(sheetName, "A1", "J1")
+	f.MergeCell(sheetName, "A1", "K1")
 
 	// 设置标题样式
 	titleStyle, _ := f.NewStyle(&excelize.Style{
@@ -634,11 +657,11 @@ func createOverviewSheet(f *excelize.File, sheetName, title string, evaluations
 			Vertical:   "center",
 		},
 	})
-	f.SetCellStyle(sheetName, "A1", "J1", titleStyle)
+	f.SetCellStyle(sheetName, "A1", "K1", titleStyle)
 
 	// 设置表头
 	row := 3
-	headers := []string{"序号", "员工姓名", "部门", "考核模板", "考核周期", "员工自评", "主管评分", "邀请评分", "最终得分", "状态"}
+	headers := []string{"序号", "员工姓名", "部门", "考核模板", "考核周期", "员工自评", "主管评分", "邀请评分", "最终得分", "绩效等级", "状态"}
 	for i, header := range headers {
 		cell := string(rune('A'+i)) + strconv.Itoa(row)
 		f.SetCellValue(sheetName, cell, header)
@@ -678,16 +701,13 @@ func createOverviewSheet(f *excelize.File, sheetName, title string, evaluations
 		periodDisplay := formatPeriodDisplay(evaluation.Period, evaluation.Year, evaluation.Month, evaluation.Quarter)
 		f.SetCellValue(sheetName, "E"+strconv.Itoa(row), periodDisplay)
 
-		// 计算员工自评和主管评分
-		var selfTotalScore, managerTotalScore float64
-		for _, score := range evaluation.Scores {
-			if score.SelfScore != nil {
-				selfTotalScore += *score.SelfScore
-			}
-			if score.ManagerScore != nil {
-				managerTotalScore += *score.ManagerScore
-			}
-		}
+		// 按计分方式计算员工自评和主管评分的折算总分
+		selfTotalScore, _ := calculateTotalScore(evaluation.ScoringMode, evaluation.Scores, func(score *models.KPIScore) float64 {
+			return scoreValue(score.SelfScore)
+		})
+		managerTotalScore, _ := calculateTotalScore(evaluation.ScoringMode, evaluation.Scores, func(score *models.KPIScore) float64 {
+			return scoreValue(score.ManagerScore)
+		})
 
 		f.SetCellValue(sheetName, "F"+strconv.Itoa(row), fmt.Sprintf("%.2f", selfTotalScore))
 		f.SetCellValue(sheetName, "G"+strconv.Itoa(row), fmt.Sprintf("%.2f", managerTotalScore))
@@ -719,7 +739,8 @@ func createOverviewSheet(f *excelize.File, sheetName, title string, evaluations
 
 		f.SetCellValue(sheetName, "H"+strconv.Itoa(row), invitationScoreText)
 		f.SetCellValue(sheetName, "I"+strconv.Itoa(row), evaluation.TotalScore)
-		f.SetCellValue(sheetName, "J"+strconv.Itoa(row), getStatusText(evaluation.Status))
+		f.SetCellValue(sheetName, "J"+strconv.Itoa(row), formatGrade(&evaluation))
+		f.SetCellValue(sheetName, "K"+strconv.Itoa(row), getStatusText(evaluation.Status))
 
 		// 设置数据行样式
 		dataStyle, _ := f.NewStyle(&excelize.Style{
@@ -746,7 +767,8 @@ func createOverviewSheet(f *excelize.File, sheetName, title string, evaluations
 	f.SetColWidth(sheetName, "G", "G", 12)
 	f.SetColWidth(sheetName, "H", "H", 18)
 	f.SetColWidth(sheetName, "I", "I", 12)
-	f.SetColWidth(sheetName, "J", "J", 15)
+	f.SetColWidth(sheetName, "J", "J", 12)
+	f.SetColWidth(sheetName, "K", "K", 15)
 }
 
 // 创建详细工作表
@@ -790,6 +812,16 @@ func createDetailSheet(f *excelize.File, sheetName string, evaluation models.KPI
 	f.SetCellValue(sheetName, "B"+strconv.Itoa(currentRow), getStatusText(evaluation.Status))
 	f.SetCellValue(sheetName, "D"+strconv.Itoa(currentRow), "最终得分:")
 	f.SetCellValue(sheetName, "E"+strconv.Itoa(currentRow), evaluation.TotalScore)
+	currentRow++
+
+	f.SetCellValue(sheetName, "A"+strconv.Itoa(currentRow), "计分方式:")
+	f.SetCellValue(sheetName, "B"+strconv.Itoa(currentRow), getScoringModeText(evaluation.ScoringMode))
+	f.SetCellValue(sheetName, "D"+strconv.Itoa(currentRow), "原始得分:")
+	f.SetCellValue(sheetName, "E"+strconv.Itoa(currentRow), evaluation.RawScore)
+	currentRow++
+
+	f.SetCellValue(sheetName, "A"+strconv.Itoa(currentRow), "绩效等级:")
+	f.SetCellValue(sheetName, "B"+strconv.Itoa(currentRow), formatGrade(&evaluation))
 	currentRow += 2
 
 	// 考核指标详细表
@@ -811,6 +843,14 @@ func createDetailSheet(f *excelize.File, sheetName string, evaluation models.KPI
 
 	// 考核指标表头
 	headers := []string{"考核项目", "满分", "自评分", "自评说明", "主管评分", "主管说明", "HR评分", "HR说明", "最终得分"}
+	// 经过目标设定阶段的评估增加约定目标列
+	hasGoals := false
+	for _, score := range evaluation.Scores {
+		hasGoals = hasGoals || score.Goal != ""
+	}
+	if hasGoals {
+		headers = append(headers, "约定目标")
+	}
 	for i, header := range headers {
 		cell := string(rune('A'+i)) + strconv.Itoa(currentRow)
 		f.SetCellValue(sheetName, cell, header)
@@ -842,31 +882,34 @@ func createDetailSheet(f *excelize.File, sheetName string, evaluation models.KPI
 	// 考核指标数据
 	var totalMaxScore, totalSelfScore, totalManagerScore, totalHRScore, totalFinalScore float64
 	for _, score := range evaluation.Scores {
-		f.SetCellValue(sheetName, "A"+strconv.Itoa(currentRow), score.Item.Name)
-		f.SetCellValue(sheetName, "B"+strconv.Itoa(currentRow), score.Item.MaxScore)
+		f.SetCellValue(sheetName, "A"+strconv.Itoa(currentRow), exportItemName(&evaluation, &score))
+		f.SetCellValue(sheetName, "B"+strconv.Itoa(currentRow), exportItemMaxScore(&score.Item))
 		totalMaxScore += score.Item.MaxScore
 
 		if score.SelfScore != nil {
-			f.SetCellValue(sheetName, "C"+strconv.Itoa(currentRow), *score.SelfScore)
-			totalSelfScore += *score.SelfScore
+			f.SetCellValue(sheetName, "C"+strconv.Itoa(currentRow), exportItemScore(&score.Item, *score.SelfScore))
+			totalSelfScore += itemPoints(&score.Item, *score.SelfScore)
 		}
 		f.SetCellValue(sheetName, "D"+strconv.Itoa(currentRow), score.SelfComment)
 
 		if score.ManagerScore != nil {
-			f.SetCellValue(sheetName, "E"+strconv.Itoa(currentRow), *score.ManagerScore)
-			totalManagerScore += *score.ManagerScore
+			f.SetCellValue(sheetName, "E"+strconv.Itoa(currentRow), exportItemScore(&score.Item, *score.ManagerScore))
+			totalManagerScore += itemPoints(&score.Item, *score.ManagerScore)
 		}
 		f.SetCellValue(sheetName, "F"+strconv.Itoa(currentRow), score.ManagerComment)
 
 		if score.HRScore != nil {
-			f.SetCellValue(sheetName, "G"+strconv.Itoa(currentRow), *score.HRScore)
-			totalHRScore += *score.HRScore
+			f.SetCellValue(sheetName, "G"+strconv.Itoa(currentRow), exportItemScore(&score.Item, *score.HRScore))
+			totalHRScore += itemPoints(&score.Item, *score.HRScore)
 		}
 		f.SetCellValue(sheetName, "H"+strconv.Itoa(currentRow), score.HRComment)
 
 		if score.FinalScore != nil {
-			f.SetCellValue(sheetName, "I"+strconv.Itoa(currentRow), *score.FinalScore)
-			totalFinalScore += *score.FinalScore
+			f.SetCellValue(sheetName, "I"+strconv.Itoa(currentRow), exportItemScore(&score.Item, *score.FinalScore))
+			totalFinalScore += itemPoints(&score.Item, *score.FinalScore)
+		}
+		if hasGoals {
+			f.SetCellValue(sheetName, "J"+strconv.Itoa(currentRow), score.Goal)
 		}
 
 		// 设置数据行样式
@@ -927,6 +970,34 @@ func createDetailSheet(f *excelize.File, sheetName string, evaluation models.KPI
 	}
 	currentRow++
 
+	// 按计分方式折算到0-100的总分
+	f.SetCellValue(sheetName, "A"+strconv.Itoa(currentRow), "折算总分")
+	normalizedColumns := []struct {
+		column string
+		raw    float64
+		value  func(score *models.KPIScore) *float64
+	}{
+		{"C", totalSelfScore, func(score *models.KPIScore) *float64 { return score.SelfScore }},
+		{"E", totalManagerScore, func(score *models.KPIScore) *float64 { return score.ManagerScore }},
+		{"G", totalHRScore, func(score *models.KPIScore) *float64 { return score.HRScore }},
+		{"I", totalFinalScore, func(score *models.KPIScore) *float64 { return score.FinalScore }},
+	}
+	for _, column := range normalizedColumns {
+		if column.raw <= 0 {
+			continue
+		}
+		value := column.value
+		normalized, _ := calculateTotalScore(evaluation.ScoringMode, evaluation.Scores, func(score *models.KPIScore) float64 {
+			return scoreValue(value(score))
+		})
+		f.SetCellValue(sheetName, column.column+strconv.Itoa(currentRow), normalized)
+	}
+	for i := 0; i < len(headers); i++ {
+		cell := string(rune('A'+i)) + strconv.Itoa(currentRow)
+		f.SetCellStyle(sheetName, cell, cell, totalStyle)
+	}
+	currentRow++
+
 	// 邀请评分部分
 	if len(invitations) > 0 {
 		currentRow += 2
@@ -960,12 +1031,12 @@ func createDetailSheet(f *excelize.File, sheetName string, evaluation models.KPI
 			var invTotalMaxScore, invTotalScore float64
 			for _, invScore := range invitation.Scores {
 				f.SetCellValue(sheetName, "A"+strconv.Itoa(currentRow), invScore.Item.Name)
-				f.SetCellValue(sheetName, "B"+strconv.Itoa(currentRow), invScore.Item.MaxScore)
+				f.SetCellValue(sheetName, "B"+strconv.Itoa(currentRow), exportItemMaxScore(&invScore.Item))
 				invTotalMaxScore += invScore.Item.MaxScore
 
 				if invScore.Score != nil {
-					f.SetCellValue(sheetName, "C"+strconv.Itoa(currentRow), *invScore.Score)
-					invTotalScore += *invScore.Score
+					f.SetCellValue(sheetName, "C"+strconv.Itoa(currentRow), exportItemScore(&invScore.Item, *invScore.Score))
+					invTotalScore += itemPoints(&invScore.Item, *invScore.Score)
 				}
 				f.SetCellValue(sheetName, "D"+strconv.Itoa(currentRow), invScore.Comment)
 
@@ -1039,6 +1110,58 @@ func createDetailSheet(f *excelize.File, sheetName string, evaluation models.KPI
 	f.SetColWidth(sheetName, "G", "G", 10)
 	f.SetColWidth(sheetName, "H", "H", 25)
 	f.SetColWidth(sheetName, "I", "I", 10)
+	f.SetColWidth(sheetName, "J", "J", 30)
+}
+
+// formatGrade 绩效等级显示文本，如「A（优秀）」，尚未确定等级时为空
+func formatGrade(evaluation *models.KPIEvaluation) string {
+	if evaluation.Grade == "" || evaluation.GradeLabel == "" {
+		return evaluation.Grade
+	}
+	return fmt.Sprintf("%s（%s）", evaluation.Grade, evaluation.GradeLabel)
+}
+
+// exportItemName 导出时的考核项目名称，加权计分时附带权重，量化指标附带实际完成值和自动得分
+func exportItemName(evaluation *models.KPIEvaluation, score *models.KPIScore) string {
+	item := &score.Item
+	name := item.Name
+	if evaluation.ScoringMode == scoringModeWeighted && item.Weight > 0 {
+		name = fmt.Sprintf("%s（权重%s）", name, formatScore(item.Weight))
+	}
+	if itemScoreType(item) == scoreTypeQuantitative && score.ActualValue != nil {
+		name = fmt.Sprintf("%s（实际%s%s，自动得分%s）", name, formatScore(*score.ActualValue), item.Unit, formatScore(scoreValue(score.AutoScore)))
+	}
+	return name
+}
+
+// exportItemScore 导出时的评分，数值和量化指标保留数字，其他类型按评分类型显示（如「4/5（良好）」「通过」）
+func exportItemScore(item *models.KPIItem, value float64) interface{} {
+	if scoreType := itemScoreType(item); scoreType == scoreTypeNumeric || scoreType == scoreTypeQuantitative {
+		return value
+	}
+	return formatItemScore(item, value)
+}
+
+// exportItemMaxScore 导出时的满分，等级量表附带级数，文字评价显示不计分
+func exportItemMaxScore(item *models.KPIItem) interface{} {
+	switch itemScoreType(item) {
+	case scoreTypeScale:
+		return fmt.Sprintf("%s（%d级）", formatScore(item.MaxScore), item.ScalePoints)
+	case scoreTypeText:
+		return "不计分"
+	case scoreTypeQuantitative:
+		return fmt.Sprintf("%s（目标%s%s）", formatScore(item.MaxScore), formatScore(item.TargetValue), item.Unit)
+	default:
+		return item.MaxScore
+	}
+}
+
+// scoreValue 返回评分值，未评分时为0
+func scoreValue(value *float64) float64 {
+	if value == nil {
+		return 0
+	}
+	return *value
 }
 
 // 获取邀请状态文本
@@ -1060,6 +1183,10 @@ func getInvitationStatusText(status string) string {
 // 获取状态文本
 func getStatusText(status string) string {
 	switch status {
+	case "goal_setting":
+		return "目标设定中"
+	case "goal_review":
+		return "目标待确认"
 	case "pending":
 		return "待自评"
 	case "self_evaluated":
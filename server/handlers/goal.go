@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"dootask-kpi-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 目标条目
+type EvaluationGoalEntry struct {
+	ScoreID  *uint   `json:"score_id"` // 针对模板考核项目的目标填写评分记录ID，为空表示新增额外考核项目
+	Title    string  `json:"title"`    // 额外考核项目名称
+	Target   string  `json:"target"`   // 目标内容
+	MaxScore float64 `json:"max_score"`
+	Weight   float64 `json:"weight"`
+}
+
+// 保存目标请求结构：整体替换评估的全部目标
+type UpdateEvaluationGoalsRequest struct {
+	Goals []EvaluationGoalEntry `json:"goals"`
+}
+
+// goalSettingEnabled 模板是否启用目标设定阶段
+func goalSettingEnabled(template *models.KPITemplate) bool {
+	return template.GoalSetting != nil && *template.GoalSetting
+}
+
+// applyGoalSetting 模板启用目标设定时，评估从目标设定阶段开始
+func applyGoalSetting(evaluation *models.KPIEvaluation, template *models.KPITemplate) {
+	if goalSettingEnabled(template) {
+		evaluation.Status = "goal_setting"
+	}
+}
+
+// goalEditorAllowed 当前身份能否修改目标：目标设定中由员工提出，待确认时由直属上级修改，HR均可修改
+func goalEditorAllowed(evaluation *models.KPIEvaluation, actors map[string]bool) bool {
+	switch evaluation.Status {
+	case "goal_setting":
+		return actors[evaluationActorEmployee] || actors[evaluationActorHR]
+	case "goal_review":
+		return actors[evaluationActorManager] || actors[evaluationActorHR]
+	default:
+		return false
+	}
+}
+
+// formatGoals 将目标格式化为文本，用于变更历史
+func formatGoals(goals []models.EvaluationGoal, itemNames map[uint]string) string {
+	parts := make([]string, 0, len(goals))
+	for _, goal := range goals {
+		name := goal.Title
+		if goal.ScoreID != nil && !goal.Extra {
+			name = itemNames[*goal.ScoreID]
+		}
+		parts = append(parts, fmt.Sprintf("%s：%s", name, goal.Target))
+	}
+	return strings.Join(parts, "；")
+}
+
+// lockEvaluationGoals 目标审批通过时锁定目标：写入评分记录的约定目标，额外考核项目创建考核项目和评分记录
+// 额外考核项目不属于任何模板（template_id 为0），仅用于该评估
+func lockEvaluationGoals(tx *gorm.DB, evaluation *models.KPIEvaluation) error {
+	var goals []models.EvaluationGoal
+	if err := tx.Where("evaluation_id = ?", evaluation.ID).Order("id").Find(&goals).Error; err != nil {
+		return err
+	}
+
+	var maxOrder int
+	if err := tx.Model(&models.KPIScore{}).Where("evaluation_id = ?", evaluation.ID).Select("COALESCE(MAX(item_order), 0)").Scan(&maxOrder).Error; err != nil {
+		return err
+	}
+
+	// 退回到目标阶段后重新审批时，已删除的额外考核项目连同评分记录一并移除
+	lockedScoreIDs := []uint{0}
+	for _, goal := range goals {
+		if goal.Extra && goal.ScoreID != nil {
+			lockedScoreIDs = append(lockedScoreIDs, *goal.ScoreID)
+		}
+	}
+	extraItems := tx.Model(&models.KPIItem{}).Select("id").Where("template_id = 0")
+	staleScores := tx.Model(&models.KPIScore{}).Select("item_id").
+		Where("evaluation_id = ? AND item_id IN (?) AND id NOT IN ?", evaluation.ID, extraItems, lockedScoreIDs)
+	if err := tx.Where("id IN (?)", staleScores).Delete(&models.KPIItem{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("evaluation_id = ? AND item_id IN (?) AND id NOT IN ?", evaluation.ID, extraItems, lockedScoreIDs).Delete(&models.KPIScore{}).Error; err != nil {
+		return err
+	}
+
+	for _, goal := range goals {
+		if !goal.Extra {
+			if err := tx.Model(&models.KPIScore{}).Where("id = ? AND evaluation_id = ?", *goal.ScoreID, evaluation.ID).Update("goal", goal.Target).Error; err != nil {
+				return err
+			}
+			continue
+		}
+
+		// 之前审批时已创建过考核项目的额外目标，只同步项目内容，不重复创建
+		if goal.ScoreID != nil {
+			if err := syncExtraGoalItem(tx, evaluation.ID, &goal); err != nil {
+				return err
+			}
+			continue
+		}
+
+		maxOrder++
+		item := models.KPIItem{
+			Name:        goal.Title,
+			Description: goal.Target,
+			MaxScore:    goal.MaxScore,
+			Weight:      goal.Weight,
+			Order:       maxOrder,
+			ScoreType:   scoreTypeNumeric,
+		}
+		if err := tx.Create(&item).Error; err != nil {
+			return err
+		}
+		score := models.KPIScore{
+			EvaluationID: evaluation.ID,
+			ItemID:       item.ID,
+			Goal:         goal.Target,
+		}
+		setItemSnapshot(&score, &item)
+		if err := tx.Create(&score).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&goal).Update("score_id", score.ID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncExtraGoalItem 将额外目标的名称、满分和权重同步到已创建的考核项目及评分记录快照
+func syncExtraGoalItem(tx *gorm.DB, evaluationID uint, goal *models.EvaluationGoal) error {
+	var score models.KPIScore
+	if err := tx.Where("id = ? AND evaluation_id = ?", *goal.ScoreID, evaluationID).First(&score).Error; err != nil {
+		return err
+	}
+	var item models.KPIItem
+	if err := tx.First(&item, score.ItemID).Error; err != nil {
+		return err
+	}
+	item.Name = goal.Title
+	item.Description = goal.Target
+	item.MaxScore = goal.MaxScore
+	item.Weight = goal.Weight
+	if err := tx.Save(&item).Error; err != nil {
+		return err
+	}
+	score.Goal = goal.Target
+	setItemSnapshot(&score, &item)
+	return tx.Save(&score).Error
+}
+
+// 获取评估的目标
+func GetEvaluationGoals(c *gin.Context) {
+	evaluationId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的评估ID",
+		})
+		return
+	}
+
+	var evaluation models.KPIEvaluation
+	if err := models.DB.First(&evaluation, evaluationId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "评估不存在",
+		})
+		return
+	}
+
+	var goals []models.EvaluationGoal
+	if err := models.DB.Preload("UpdatedBy").Where("evaluation_id = ?", evaluation.ID).Order("id").Find(&goals).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取目标失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":   goals,
+		"locked": evaluation.GoalsApprovedAt != nil,
+	})
+}
+
+// 保存评估的目标：目标设定中由员工提出，待确认时由直属上级修改，审批通过后锁定
+func UpdateEvaluationGoals(c *gin.Context) {
+	evaluationId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的评估ID",
+		})
+		return
+	}
+
+	var req UpdateEvaluationGoalsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var evaluation models.KPIEvaluation
+	if err := models.DB.Preload("Employee").Preload("Scores").First(&evaluation, evaluationId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "评估不存在",
+		})
+		return
+	}
+
+	var operator models.Employee
+	if err := models.DB.First(&operator, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "用户不存在",
+		})
+		return
+	}
+
+	if evaluation.Status != "goal_setting" && evaluation.Status != "goal_review" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("评估当前处于「%s」阶段，目标已锁定", getStatusText(evaluation.Status)),
+		})
+		return
+	}
+	if !goalEditorAllowed(&evaluation, resolveEvaluationActors(&evaluation, &operator)) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": fmt.Sprintf("评估当前处于「%s」阶段，无权修改目标", getStatusText(evaluation.Status)),
+		})
+		return
+	}
+
+	var previous []models.EvaluationGoal
+	models.DB.Where("evaluation_id = ?", evaluation.ID).Order("id").Find(&previous)
+
+	// 校验目标：每个模板考核项目最多一个目标，额外考核项目需填写名称和满分
+	// 退回到目标阶段后，之前审批时已创建评分记录的额外目标仍按额外考核项目处理
+	itemNames := make(map[uint]string, len(evaluation.Scores))
+	for _, score := range evaluation.Scores {
+		itemNames[score.ID] = score.ItemName
+	}
+	extraScoreIDs := make(map[uint]bool)
+	for _, goal := range previous {
+		if goal.Extra && goal.ScoreID != nil {
+			extraScoreIDs[*goal.ScoreID] = true
+		}
+	}
+	seen := make(map[uint]bool)
+	goals := make([]models.EvaluationGoal, 0, len(req.Goals))
+	for _, entry := range req.Goals {
+		goal := models.EvaluationGoal{
+			EvaluationID: evaluation.ID,
+			Target:       strings.TrimSpace(entry.Target),
+			UpdatedByID:  operator.ID,
+		}
+		if entry.ScoreID != nil && !extraScoreIDs[*entry.ScoreID] {
+			name, ok := itemNames[*entry.ScoreID]
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": fmt.Sprintf("评分记录 %d 不属于该评估", *entry.ScoreID),
+				})
+				return
+			}
+			if seen[*entry.ScoreID] {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": fmt.Sprintf("「%s」的目标重复", name),
+				})
+				return
+			}
+			if goal.Target == "" {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": fmt.Sprintf("「%s」的目标内容不能为空", name),
+				})
+				return
+			}
+			seen[*entry.ScoreID] = true
+			goal.ScoreID = entry.ScoreID
+		} else {
+			if entry.ScoreID != nil {
+				if seen[*entry.ScoreID] {
+					c.JSON(http.StatusBadRequest, gin.H{
+						"error": fmt.Sprintf("「%s」的目标重复", itemNames[*entry.ScoreID]),
+					})
+					return
+				}
+				seen[*entry.ScoreID] = true
+				goal.ScoreID = entry.ScoreID
+			}
+			goal.Extra = true
+			goal.Title = strings.TrimSpace(entry.Title)
+			goal.MaxScore = entry.MaxScore
+			goal.Weight = entry.Weight
+			if goal.Title == "" {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "额外考核项目的名称不能为空",
+				})
+				return
+			}
+			if goal.MaxScore <= 0 || goal.Weight < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": fmt.Sprintf("额外考核项目「%s」的满分必须大于0，权重不能为负数", goal.Title),
+				})
+				return
+			}
+		}
+		goals = append(goals, goal)
+	}
+
+	history := newHistoryRecorder(evaluation.ID, operator.ID, historySourceGoal)
+	history.change("goals", formatGoals(previous, itemNames), formatGoals(goals, itemNames))
+
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("evaluation_id = ?", evaluation.ID).Delete(&models.EvaluationGoal{}).Error; err != nil {
+			return err
+		}
+		if len(goals) > 0 {
+			if err := tx.Create(&goals).Error; err != nil {
+				return err
+			}
+		}
+		return history.save(tx)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "保存目标失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "目标保存成功",
+		"data":    goals,
+	})
+}
+
+// markGoalsApproved 目标审批通过时记录审批人和时间
+func markGoalsApproved(updateData *models.KPIEvaluation, approverID uint) {
+	now := time.Now()
+	updateData.GoalsApprovedAt = &now
+	updateData.GoalsApprovedByID = &approverID
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"dootask-kpi-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 绩效等级区间条目
+type GradeBandEntry struct {
+	Grade    string  `json:"grade"`
+	Label    string  `json:"label"`
+	MinScore float64 `json:"min_score"`
+	MaxScore float64 `json:"max_score"`
+}
+
+// 保存绩效等级区间请求结构：整体替换组织默认或某个模板的等级区间
+type UpdateGradeBandsRequest struct {
+	TemplateID *uint            `json:"template_id"` // 为空表示组织默认等级
+	Bands      []GradeBandEntry `json:"bands"`
+}
+
+// 等级分布统计
+type GradeCount struct {
+	Grade string `json:"grade"`
+	Label string `json:"label"`
+	Count int64  `json:"count"`
+}
+
+// resolveGradeBands 返回模板适用的等级区间（从高到低）：模板配置了等级区间时使用模板的，否则使用组织默认等级
+func resolveGradeBands(db *gorm.DB, templateID uint) ([]models.GradeBand, error) {
+	var bands []models.GradeBand
+	if templateID != 0 {
+		if err := db.Where("template_id = ?", templateID).Order("min_score DESC").Find(&bands).Error; err != nil {
+			return nil, err
+		}
+		if len(bands) > 0 {
+			return bands, nil
+		}
+	}
+	if err := db.Where("template_id IS NULL").Order("min_score DESC").Find(&bands).Error; err != nil {
+		return nil, err
+	}
+	if len(bands) == 0 {
+		bands = models.DefaultGradeBands()
+	}
+	return bands, nil
+}
+
+// matchGrade 返回得分所在的等级区间，区间为左闭右开，最高等级包含上限
+func matchGrade(bands []models.GradeBand, score float64) *models.GradeBand {
+	var top float64
+	for _, band := range bands {
+		if band.MaxScore > top {
+			top = band.MaxScore
+		}
+	}
+	for i := range bands {
+		band := &bands[i]
+		if score >= band.MinScore && (score < band.MaxScore || (band.MaxScore == top && score == top)) {
+			return band
+		}
+	}
+	return nil
+}
+
+// assignEvaluationGrade 按评估当前总分确定绩效等级并保存，得分不在任何区间内时等级为空
+func assignEvaluationGrade(db *gorm.DB, evaluation *models.KPIEvaluation, history *historyRecorder) error {
+	bands, err := resolveGradeBands(db, evaluation.TemplateID)
+	if err != nil {
+		return err
+	}
+
+	var grade, label string
+	if band := matchGrade(bands, evaluation.TotalScore); band != nil {
+		grade, label = band.Grade, band.Label
+	}
+	if history != nil {
+		history.change("grade", evaluation.Grade, grade)
+	}
+	if err := db.Model(&models.KPIEvaluation{}).Where("id = ?", evaluation.ID).Updates(map[string]interface{}{
+		"grade":       grade,
+		"grade_label": label,
+	}).Error; err != nil {
+		return err
+	}
+	evaluation.Grade = grade
+	evaluation.GradeLabel = label
+	return nil
+}
+
+// gradeDistribution 统计已确定等级的评估在各等级的人数，按等级平均分从高到低排列
+func gradeDistribution(query *gorm.DB) ([]GradeCount, error) {
+	distribution := make([]GradeCount, 0)
+	err := query.Where("kpi_evaluations.grade <> ''").
+		Select("kpi_evaluations.grade as grade, MAX(kpi_evaluations.grade_label) as label, COUNT(*) as count").
+		Group("kpi_evaluations.grade").
+		Order("AVG(kpi_evaluations.total_score) DESC").
+		Scan(&distribution).Error
+	return distribution, err
+}
+
+// validateGradeBands 校验等级区间：等级代码不能为空且不能重复，区间不能重叠
+func validateGradeBands(entries []GradeBandEntry) ([]models.GradeBand, error) {
+	bands := make([]models.GradeBand, 0, len(entries))
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		grade := strings.TrimSpace(entry.Grade)
+		if grade == "" {
+			return nil, fmt.Errorf("等级代码不能为空")
+		}
+		if seen[grade] {
+			return nil, fmt.Errorf("等级「%s」重复", grade)
+		}
+		seen[grade] = true
+		if entry.MinScore < 0 || entry.MaxScore > 100 || entry.MinScore >= entry.MaxScore {
+			return nil, fmt.Errorf("等级「%s」的分数区间无效，须满足 0 ≤ 最低分 < 最高分 ≤ 100", grade)
+		}
+		bands = append(bands, models.GradeBand{
+			Grade:    grade,
+			Label:    strings.TrimSpace(entry.Label),
+			MinScore: entry.MinScore,
+			MaxScore: entry.MaxScore,
+		})
+	}
+
+	sort.Slice(bands, func(i, j int) bool {
+		return bands[i].MinScore > bands[j].MinScore
+	})
+	for i := range bands {
+		bands[i].Order = i + 1
+		if i > 0 && bands[i].MaxScore > bands[i-1].MinScore {
+			return nil, fmt.Errorf("等级「%s」与「%s」的分数区间重叠", bands[i].Grade, bands[i-1].Grade)
+		}
+	}
+	return bands, nil
+}
+
+// 获取绩效等级区间：指定 template_id 时返回模板适用的等级区间，并标明是否为模板单独配置
+func GetGradeBands(c *gin.Context) {
+	var templateID uint
+	if value := c.Query("template_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "无效的模板ID",
+			})
+			return
+		}
+		templateID = uint(id)
+	}
+
+	bands, err := resolveGradeBands(models.DB, templateID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取绩效等级失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       bands,
+		"customized": len(bands) > 0 && bands[0].TemplateID != nil,
+	})
+}
+
+// 保存绩效等级区间：组织默认等级不能为空；模板提交空列表表示取消单独配置，改用组织默认等级
+// 已完成的评估保留完成时确定的等级
+func UpdateGradeBands(c *gin.Context) {
+	var req UpdateGradeBandsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if req.TemplateID != nil {
+		var template models.KPITemplate
+		if err := models.DB.First(&template, *req.TemplateID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "模板不存在",
+			})
+			return
+		}
+	} else if len(req.Bands) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "组织默认等级至少需要一个等级",
+		})
+		return
+	}
+
+	bands, err := validateGradeBands(req.Bands)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	for i := range bands {
+		bands[i].TemplateID = req.TemplateID
+	}
+
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		scope := tx.Where("template_id IS NULL")
+		if req.TemplateID != nil {
+			scope = tx.Where("template_id = ?", *req.TemplateID)
+		}
+		if err := scope.Delete(&models.GradeBand{}).Error; err != nil {
+			return err
+		}
+		if len(bands) > 0 {
+			return tx.Create(&bands).Error
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "保存绩效等级失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "绩效等级保存成功",
+		"data":    bands,
+	})
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"dootask-kpi-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 变更历史来源
+const (
+	historySourceSelfScore       = "self_score"
+	historySourceManagerScore    = "manager_score"
+	historySourceHRScore         = "hr_score"
+	historySourceFinalScore      = "final_score"
+	historySourceEvaluation      = "evaluation"
+	historySourceObjection       = "objection"
+	historySourceInvitation      = "invitation"
+	historySourcePerformanceRule = "performance_rule"
+	historySourceEscalation      = "escalation"
+	historySourceRollback        = "rollback"
+	historySourceDuplicate       = "duplicate"
+	historySourceActualValue     = "actual_value"
+	historySourceGoal            = "goal"
+	historySourceCalibration     = "calibration"
+	historySourceApproval        = "approval"
+)
+
+// historyRecorder 收集一次操作产生的变更，统一写入变更历史
+type historyRecorder struct {
+	evaluationID uint
+	actorID      uint
+	source       string
+	entries      []models.EvaluationHistory
+}
+
+// newHistoryRecorder 创建变更历史收集器，actorID 为0表示系统自动操作
+func newHistoryRecorder(evaluationID uint, actorID uint, source string) *historyRecorder {
+	return &historyRecorder{
+		evaluationID: evaluationID,
+		actorID:      actorID,
+		source:       source,
+	}
+}
+
+// change 记录评估级别的字段变更，值未变化时忽略
+func (r *historyRecorder) change(field string, oldValue, newValue interface{}) {
+	r.add(models.EvaluationHistory{Field: field}, oldValue, newValue)
+}
+
+// scoreChange 记录评分记录的字段变更，值未变化时忽略
+func (r *historyRecorder) scoreChange(score *models.KPIScore, field string, oldValue, newValue interface{}) {
+	scoreID := score.ID
+	itemID := score.ItemID
+	r.add(models.EvaluationHistory{ScoreID: &scoreID, ItemID: &itemID, Field: field}, oldValue, newValue)
+}
+
+// invitationChange 记录邀请相关的变更，itemID 为0表示邀请本身的变更
+func (r *historyRecorder) invitationChange(invitationID uint, itemID uint, field string, oldValue, newValue interface{}) {
+	entry := models.EvaluationHistory{InvitationID: &invitationID, Field: field}
+	if itemID > 0 {
+		entry.ItemID = &itemID
+	}
+	r.add(entry, oldValue, newValue)
+}
+
+func (r *historyRecorder) add(entry models.EvaluationHistory, oldValue, newValue interface{}) {
+	oldText := formatHistoryValue(oldValue)
+	newText := formatHistoryValue(newValue)
+	if oldText == newText {
+		return
+	}
+	entry.EvaluationID = r.evaluationID
+	entry.ActorID = r.actorID
+	entry.Source = r.source
+	entry.OldValue = oldText
+	entry.NewValue = newText
+	r.entries = append(r.entries, entry)
+}
+
+// save 写入收集到的变更历史
+func (r *historyRecorder) save(db *gorm.DB) error {
+	if len(r.entries) == 0 {
+		return nil
+	}
+	return db.Create(&r.entries).Error
+}
+
+// formatHistoryValue 将变更值格式化为字符串，空指针返回空字符串
+func formatHistoryValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case *float64:
+		if v == nil {
+			return ""
+		}
+		return formatScore(*v)
+	case float64:
+		return formatScore(v)
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case *uint:
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatUint(uint64(*v), 10)
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return v.Format("2006-01-02 15:04")
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// 获取评估变更历史
+func GetEvaluationHistory(c *gin.Context) {
+	id := c.Param("id")
+	evaluationId, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的评估ID",
+		})
+		return
+	}
+
+	var evaluation models.KPIEvaluation
+	if err := models.DB.Preload("Employee").First(&evaluation, evaluationId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "评估不存在",
+		})
+		return
+	}
+
+	// 权限检查：HR、被评估员工本人及其直属上级可以查看
+	userID := c.GetUint("user_id")
+	isManager := evaluation.Employee.ManagerID != nil && *evaluation.Employee.ManagerID == userID
+	if c.GetString("user_role") != "hr" && evaluation.EmployeeID != userID && !isManager {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "无权查看此评估的变更历史",
+		})
+		return
+	}
+
+	query := models.DB.Preload("Actor").Preload("Item").Where("evaluation_id = ?", evaluationId)
+	if source := c.Query("source"); source != "" {
+		query = query.Where("source = ?", source)
+	}
+	if itemID := c.Query("item_id"); itemID != "" {
+		query = query.Where("item_id = ?", itemID)
+	}
+
+	var histories []models.EvaluationHistory
+	if err := query.Order("created_at ASC, id ASC").Find(&histories).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取变更历史失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  histories,
+		"total": len(histories),
+	})
+}
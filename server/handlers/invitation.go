@@ -9,6 +9,7 @@ import (
 	"dootask-kpi-server/utils"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // 邀请评分相关API
@@ -75,9 +76,9 @@ func CreateInvitation(c *gin.Context) {
 		}
 	}
 
-	// 获取评估的KPI项目
-	var items []models.KPIItem
-	if err := models.DB.Where("template_id = ?", evaluation.TemplateID).Find(&items).Error; err != nil {
+	// 获取评估的KPI项目（与评估创建时的考核项目保持一致）
+	var evaluationScores []models.KPIScore
+	if err := models.DB.Where("evaluation_id = ?", evalID).Find(&evaluationScores).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取评估项目失败"})
 		return
 	}
@@ -117,10 +118,10 @@ func CreateInvitation(c *gin.Context) {
 		}
 
 		// 为每个KPI项目创建评分记录
-		for _, item := range items {
+		for _, score := range evaluationScores {
 			invitedScore := models.InvitedScore{
 				InvitationID: invitation.ID,
-				ItemID:       item.ID,
+				ItemID:       score.ItemID,
 			}
 			if err := tx.Create(&invitedScore).Error; err != nil {
 				tx.Rollback()
@@ -132,6 +133,17 @@ func CreateInvitation(c *gin.Context) {
 		createdInvitations = append(createdInvitations, invitation)
 	}
 
+	// 记录变更历史
+	history := newHistoryRecorder(uint(evalID), inviterID, historySourceInvitation)
+	for _, invitation := range createdInvitations {
+		history.invitationChange(invitation.ID, 0, "invitee_id", nil, invitation.InviteeID)
+	}
+	if err := history.save(tx); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "记录变更历史失败"})
+		return
+	}
+
 	tx.Commit()
 
 	// 为每个被邀请人发送 DooTask 机器人通知
@@ -408,9 +420,16 @@ func AcceptInvitation(c *gin.Context) {
 		return
 	}
 
-	// 更新邀请状态
+	// 更新邀请状态，并在同一事务中记录变更历史
 	invitation.Status = "accepted"
-	if err := models.DB.Save(&invitation).Error; err != nil {
+	history := newHistoryRecorder(invitation.EvaluationID, userID, historySourceInvitation)
+	history.invitationChange(invitation.ID, 0, "status", "pending", invitation.Status)
+	if err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&invitation).Error; err != nil {
+			return err
+		}
+		return history.save(tx)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新邀请状态失败"})
 		return
 	}
@@ -459,9 +478,16 @@ func DeclineInvitation(c *gin.Context) {
 		return
 	}
 
-	// 更新邀请状态
+	// 更新邀请状态，并在同一事务中记录变更历史
 	invitation.Status = "declined"
-	if err := models.DB.Save(&invitation).Error; err != nil {
+	history := newHistoryRecorder(invitation.EvaluationID, userID, historySourceInvitation)
+	history.invitationChange(invitation.ID, 0, "status", "pending", invitation.Status)
+	if err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&invitation).Error; err != nil {
+			return err
+		}
+		return history.save(tx)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新邀请状态失败"})
 		return
 	}
@@ -474,19 +500,7 @@ func DeclineInvitation(c *gin.Context) {
 	var evaluation models.KPIEvaluation
 	if err := models.DB.First(&evaluation, invitation.EvaluationID).Error; err == nil {
 		if evaluation.Status == "manager_evaluated" {
-			// 检查绩效规则是否启用
-			var rule models.PerformanceRule
-			if err := models.DB.First(&rule).Error; err == nil && rule.Enabled {
-				// 检查是否所有邀请都已完成
-				allCompleted, err := areAllInvitationsCompleted(invitation.EvaluationID)
-				if err == nil && allCompleted {
-					// 所有邀请都已完成，自动计算HR评分
-					if err := applyPerformanceRuleForEvaluation(invitation.EvaluationID); err == nil {
-						// 如果绩效规则应用成功，自动将状态推进到pending_confirm
-						models.DB.Model(&evaluation).Update("status", "pending_confirm")
-					}
-				}
-			}
+			tryAutoConfirmEvaluation(invitation.EvaluationID)
 		}
 	}
 
@@ -543,6 +557,7 @@ func GetInvitationScores(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取评分记录失败"})
 		return
 	}
+	applyInvitedItemSnapshots(evaluationItemSnapshots(invitation.EvaluationID), scores)
 
 	c.JSON(http.StatusOK, gin.H{
 		"data": scores,
@@ -595,11 +610,26 @@ func UpdateInvitedScore(c *gin.Context) {
 		return
 	}
 
-	// 更新评分
-	if err := models.DB.Model(&score).Updates(map[string]interface{}{
-		"score":   updateData.Score,
-		"comment": updateData.Comment,
-	}).Error; err != nil {
+	// 校验分数范围、小数位数和评价说明
+	if errs := validateInvitedScore(&score, updateData.Score, updateData.Comment); len(errs) > 0 {
+		respondScoreValidationErrors(c, errs)
+		return
+	}
+
+	history := newHistoryRecorder(score.Invitation.EvaluationID, userID, historySourceInvitation)
+	history.invitationChange(score.InvitationID, score.ItemID, "score", score.Score, updateData.Score)
+	history.invitationChange(score.InvitationID, score.ItemID, "comment", score.Comment, updateData.Comment)
+
+	// 更新评分，并在同一事务中记录变更历史
+	if err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&score).Updates(map[string]interface{}{
+			"score":   updateData.Score,
+			"comment": updateData.Comment,
+		}).Error; err != nil {
+			return err
+		}
+		return history.save(tx)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新评分失败"})
 		return
 	}
@@ -661,9 +691,16 @@ func CompleteInvitation(c *gin.Context) {
 		return
 	}
 
-	// 更新邀请状态为已完成
+	// 更新邀请状态为已完成，并在同一事务中记录变更历史
 	invitation.Status = "completed"
-	if err := models.DB.Save(&invitation).Error; err != nil {
+	history := newHistoryRecorder(invitation.EvaluationID, userID, historySourceInvitation)
+	history.invitationChange(invitation.ID, 0, "status", "accepted", invitation.Status)
+	if err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&invitation).Error; err != nil {
+			return err
+		}
+		return history.save(tx)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新邀请状态失败"})
 		return
 	}
@@ -671,10 +708,13 @@ func CompleteInvitation(c *gin.Context) {
 	// 计算邀请评分总分并创建自动评论
 	var invitedScores []models.InvitedScore
 	if err := models.DB.Where("invitation_id = ?", inviteID).Find(&invitedScores).Error; err == nil {
+		// 按考核项目快照的评分类型换算为分数
+		items := evaluationItemSnapshots(invitation.EvaluationID)
 		totalInvitedScore := 0.0
 		for _, score := range invitedScores {
 			if score.Score != nil {
-				totalInvitedScore += *score.Score
+				item := items[score.ItemID]
+				totalInvitedScore += itemPoints(&item, *score.Score)
 			}
 		}
 
@@ -704,19 +744,7 @@ func CompleteInvitation(c *gin.Context) {
 	var evaluation models.KPIEvaluation
 	if err := models.DB.First(&evaluation, invitation.EvaluationID).Error; err == nil {
 		if evaluation.Status == "manager_evaluated" {
-			// 检查绩效规则是否启用
-			var rule models.PerformanceRule
-			if err := models.DB.First(&rule).Error; err == nil && rule.Enabled {
-				// 检查是否所有邀请都已完成
-				allCompleted, err := areAllInvitationsCompleted(invitation.EvaluationID)
-				if err == nil && allCompleted {
-					// 所有邀请都已完成，自动计算HR评分
-					if err := applyPerformanceRuleForEvaluation(invitation.EvaluationID); err == nil {
-						// 如果绩效规则应用成功，自动将状态推进到pending_confirm
-						models.DB.Model(&evaluation).Update("status", "pending_confirm")
-					}
-				}
-			}
+			tryAutoConfirmEvaluation(invitation.EvaluationID)
 		}
 	}
 
@@ -769,6 +797,7 @@ func GetInvitationDetails(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取评分记录失败"})
 		return
 	}
+	applyInvitedItemSnapshots(evaluationItemSnapshots(invitation.EvaluationID), scores)
 
 	invitation.Scores = scores
 
@@ -820,8 +849,15 @@ func CancelInvitation(c *gin.Context) {
 		return
 	}
 
-	// 更新邀请状态为已撤销
-	if err := models.DB.Model(&invitation).Update("status", "cancelled").Error; err != nil {
+	// 更新邀请状态为已撤销，并在同一事务中记录变更历史
+	history := newHistoryRecorder(invitation.EvaluationID, userID, historySourceInvitation)
+	history.invitationChange(invitation.ID, 0, "status", "pending", "cancelled")
+	if err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&invitation).Update("status", "cancelled").Error; err != nil {
+			return err
+		}
+		return history.save(tx)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "撤销邀请失败"})
 		return
 	}
@@ -833,19 +869,7 @@ func CancelInvitation(c *gin.Context) {
 	var evaluation models.KPIEvaluation
 	if err := models.DB.First(&evaluation, invitation.EvaluationID).Error; err == nil {
 		if evaluation.Status == "manager_evaluated" {
-			// 检查绩效规则是否启用
-			var rule models.PerformanceRule
-			if err := models.DB.First(&rule).Error; err == nil && rule.Enabled {
-				// 检查是否所有邀请都已完成
-				allCompleted, err := areAllInvitationsCompleted(invitation.EvaluationID)
-				if err == nil && allCompleted {
-					// 所有邀请都已完成，自动计算HR评分
-					if err := applyPerformanceRuleForEvaluation(invitation.EvaluationID); err == nil {
-						// 如果绩效规则应用成功，自动将状态推进到pending_confirm
-						models.DB.Model(&evaluation).Update("status", "pending_confirm")
-					}
-				}
-			}
+			tryAutoConfirmEvaluation(invitation.EvaluationID)
 		}
 	}
 
@@ -902,8 +926,15 @@ func ReinviteInvitation(c *gin.Context) {
 		return
 	}
 
-	// 更新邀请状态为待接受
-	if err := models.DB.Model(&invitation).Update("status", "pending").Error; err != nil {
+	// 更新邀请状态为待接受，并在同一事务中记录变更历史
+	history := newHistoryRecorder(invitation.EvaluationID, userID, historySourceInvitation)
+	history.invitationChange(invitation.ID, 0, "status", "declined", "pending")
+	if err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&invitation).Update("status", "pending").Error; err != nil {
+			return err
+		}
+		return history.save(tx)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "重新邀请失败"})
 		return
 	}
@@ -998,6 +1029,15 @@ func DeleteInvitation(c *gin.Context) {
 		return
 	}
 
+	// 记录变更历史（邀请删除后历史仍然保留）
+	history := newHistoryRecorder(evaluationID, userID, historySourceInvitation)
+	history.invitationChange(invitation.ID, 0, "status", invitation.Status, "deleted")
+	if err := history.save(tx); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "记录变更历史失败"})
+		return
+	}
+
 	// 提交事务
 	if err := tx.Commit().Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交事务失败"})
@@ -1006,9 +1046,8 @@ func DeleteInvitation(c *gin.Context) {
 
 	// 如果删除的是已完成的邀请，且评估处于pending_confirm状态，且启用了绩效规则，需要重新计算HR评分
 	if wasCompleted && evaluationStatus == "pending_confirm" {
-		// 检查绩效规则是否启用
-		var rule models.PerformanceRule
-		if err := models.DB.First(&rule).Error; err == nil && rule.Enabled {
+		// 检查评估是否有已启用的适用绩效规则
+		if rule, _, err := resolvePerformanceRuleForEvaluation(evaluationID); err == nil && rule != nil {
 			// 重新计算HR评分
 			if err := applyPerformanceRuleForEvaluation(evaluationID); err != nil {
 				// 重新计算失败不影响删除操作，仅记录错误
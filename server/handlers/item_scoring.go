@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"dootask-kpi-server/models"
+)
+
+// 考核项目评分类型
+const (
+	scoreTypeNumeric  = "numeric"   // 数值：0 到满分
+	scoreTypeScale    = "scale"     // 等级量表：1 到 N 级，得分 = 级数 / N × 满分
+	scoreTypePassFail = "pass_fail" // 通过/不通过：1 为通过得满分，0 为不通过得0分
+	scoreTypeText     = "text"      // 文字评价：只填写评价，不打分、不计入总分
+
+	scoreTypeQuantitative = "quantitative" // 量化指标：按实际完成值自动计算得分，评分人可在此基础上调整
+)
+
+// 量化指标计分曲线
+const (
+	scoringCurveLinear = "linear" // 线性：得分 = 完成率 × 满分，最高为满分
+	scoringCurveSteps  = "steps"  // 阶梯：按完成率达到的最高档位计分
+	scoringCurveCapped = "capped" // 超额封顶：超额完成按比例加分，完成率最高按封顶值计
+)
+
+// 等级量表级数范围
+const (
+	minScalePoints = 2
+	maxScalePoints = 10
+)
+
+// itemScoreType 返回考核项目的评分类型，未设置时为数值
+func itemScoreType(item *models.KPIItem) string {
+	if item.ScoreType == "" {
+		return scoreTypeNumeric
+	}
+	return item.ScoreType
+}
+
+// getScoreTypeText 评分类型显示文本
+func getScoreTypeText(scoreType string) string {
+	switch scoreType {
+	case scoreTypeScale:
+		return "等级量表"
+	case scoreTypePassFail:
+		return "通过/不通过"
+	case scoreTypeText:
+		return "文字评价"
+	case scoreTypeQuantitative:
+		return "量化指标"
+	default:
+		return "数值"
+	}
+}
+
+// normalizeItemScoring 校验考核项目的评分类型配置，并按类型整理相关字段
+func normalizeItemScoring(item *models.KPIItem) error {
+	if itemScoreType(item) != scoreTypeQuantitative {
+		item.QuantitativeTarget = models.QuantitativeTarget{}
+	}
+
+	switch itemScoreType(item) {
+	case scoreTypeNumeric, scoreTypePassFail:
+		item.ScalePoints = 0
+		item.ScaleAnchors = nil
+	case scoreTypeQuantitative:
+		item.ScalePoints = 0
+		item.ScaleAnchors = nil
+		return normalizeQuantitativeTarget(item)
+	case scoreTypeScale:
+		if item.ScalePoints < minScalePoints || item.ScalePoints > maxScalePoints {
+			return fmt.Errorf("等级量表的级数必须在 %d 到 %d 之间", minScalePoints, maxScalePoints)
+		}
+		seen := make(map[int]bool, len(item.ScaleAnchors))
+		for _, anchor := range item.ScaleAnchors {
+			if anchor.Value < 1 || anchor.Value > item.ScalePoints {
+				return fmt.Errorf("等级量表锚点的分值必须在 1 到 %d 之间", item.ScalePoints)
+			}
+			if seen[anchor.Value] {
+				return fmt.Errorf("等级量表锚点的分值 %d 重复", anchor.Value)
+			}
+			seen[anchor.Value] = true
+		}
+	case scoreTypeText:
+		if item.MaxScore != 0 {
+			return fmt.Errorf("文字评价项目不计分，满分应为0")
+		}
+		item.ScalePoints = 0
+		item.ScaleAnchors = nil
+	default:
+		return fmt.Errorf("无效的评分类型：%s", item.ScoreType)
+	}
+	return nil
+}
+
+// normalizeQuantitativeTarget 校验量化指标的目标值和计分曲线
+func normalizeQuantitativeTarget(item *models.KPIItem) error {
+	target := &item.QuantitativeTarget
+	if target.TargetValue <= 0 {
+		return fmt.Errorf("量化指标的目标值必须大于0")
+	}
+	if item.MaxScore <= 0 {
+		return fmt.Errorf("量化指标的满分必须大于0")
+	}
+	if target.ScoringCurve == "" {
+		target.ScoringCurve = scoringCurveLinear
+	}
+
+	switch target.ScoringCurve {
+	case scoringCurveLinear:
+		target.CapPercent = 0
+		target.CurveSteps = nil
+	case scoringCurveCapped:
+		if target.CapPercent < 100 {
+			return fmt.Errorf("超额封顶的最高完成率不能低于100%%")
+		}
+		target.CurveSteps = nil
+	case scoringCurveSteps:
+		if len(target.CurveSteps) == 0 {
+			return fmt.Errorf("阶梯计分至少需要一个档位")
+		}
+		for _, step := range target.CurveSteps {
+			if step.MinPercent < 0 || step.ScorePercent < 0 {
+				return fmt.Errorf("阶梯计分的完成率和得分比例不能为负数")
+			}
+		}
+		sort.Slice(target.CurveSteps, func(i, j int) bool {
+			return target.CurveSteps[i].MinPercent < target.CurveSteps[j].MinPercent
+		})
+		target.CapPercent = 0
+	default:
+		return fmt.Errorf("无效的计分曲线：%s", target.ScoringCurve)
+	}
+	return nil
+}
+
+// quantitativeScore 按计分曲线由实际完成值计算得分
+func quantitativeScore(item *models.KPIItem, actual float64) float64 {
+	target := &item.QuantitativeTarget
+	if target.TargetValue <= 0 {
+		return 0
+	}
+	ratio := math.Max(actual/target.TargetValue, 0)
+
+	var score float64
+	switch target.ScoringCurve {
+	case scoringCurveSteps:
+		percent := ratio * 100
+		for _, step := range target.CurveSteps {
+			if percent >= step.MinPercent {
+				score = step.ScorePercent / 100 * item.MaxScore
+			}
+		}
+	case scoringCurveCapped:
+		score = math.Min(ratio, math.Max(target.CapPercent/100, 1)) * item.MaxScore
+	default:
+		score = math.Min(ratio, 1) * item.MaxScore
+	}
+	return math.Round(score*100) / 100
+}
+
+// itemMaxPoints 考核项目可获得的最高分，量化指标超额完成时可能超过满分
+func itemMaxPoints(item *models.KPIItem) float64 {
+	if itemScoreType(item) != scoreTypeQuantitative {
+		return item.MaxScore
+	}
+	switch item.ScoringCurve {
+	case scoringCurveCapped:
+		return item.MaxScore * math.Max(item.CapPercent/100, 1)
+	case scoringCurveSteps:
+		maxPercent := 100.0
+		for _, step := range item.CurveSteps {
+			maxPercent = math.Max(maxPercent, step.ScorePercent)
+		}
+		return item.MaxScore * maxPercent / 100
+	default:
+		return item.MaxScore
+	}
+}
+
+// itemPoints 将评分换算为计入总分的分数
+// 评分按类型存储原始值（数值分、等级、通过为1），汇总时统一换算；自动计算的加权平均值按比例换算
+func itemPoints(item *models.KPIItem, value float64) float64 {
+	switch itemScoreType(item) {
+	case scoreTypeScale:
+		if item.ScalePoints <= 0 {
+			return 0
+		}
+		return value / float64(item.ScalePoints) * item.MaxScore
+	case scoreTypePassFail:
+		return value * item.MaxScore
+	case scoreTypeText:
+		return 0
+	default:
+		return value
+	}
+}
+
+// scaleAnchorLabel 返回等级对应的锚点名称
+func scaleAnchorLabel(item *models.KPIItem, value float64) string {
+	for _, anchor := range item.ScaleAnchors {
+		if float64(anchor.Value) == value {
+			return anchor.Label
+		}
+	}
+	return ""
+}
+
+// formatScaleAnchors 将等级量表锚点格式化为文本，用于版本对比
+func formatScaleAnchors(anchors []models.ScaleAnchor) string {
+	parts := make([]string, 0, len(anchors))
+	for _, anchor := range anchors {
+		parts = append(parts, fmt.Sprintf("%d:%s:%s", anchor.Value, anchor.Label, anchor.Description))
+	}
+	return strings.Join(parts, "；")
+}
+
+// formatCurveSteps 将阶梯计分档位格式化为文本，用于版本对比
+func formatCurveSteps(steps []models.CurveStep) string {
+	parts := make([]string, 0, len(steps))
+	for _, step := range steps {
+		parts = append(parts, fmt.Sprintf("≥%s%%:%s%%", formatScore(step.MinPercent), formatScore(step.ScorePercent)))
+	}
+	return strings.Join(parts, "；")
+}
+
+// formatItemScore 按评分类型格式化评分，用于导出和评论
+func formatItemScore(item *models.KPIItem, value float64) string {
+	switch itemScoreType(item) {
+	case scoreTypeScale:
+		text := fmt.Sprintf("%s/%d", formatScore(value), item.ScalePoints)
+		if label := scaleAnchorLabel(item, value); label != "" {
+			text += "（" + label + "）"
+		}
+		return text
+	case scoreTypePassFail:
+		if value >= 1 {
+			return "通过"
+		} else if value <= 0 {
+			return "不通过"
+		}
+		return fmt.Sprintf("通过率%s%%", formatScore(math.Round(value*10000)/100))
+	default:
+		return formatScore(value)
+	}
+}
+
+// validateTypedScore 按评分类型校验评分取值，校验通过或数值类型时返回空错误码
+func validateTypedScore(item *models.KPIItem, value float64) (code string, message string) {
+	switch itemScoreType(item) {
+	case scoreTypeScale:
+		if value != math.Trunc(value) || value < 1 || value > float64(item.ScalePoints) {
+			return scoreErrorOutOfRange, fmt.Sprintf("的评分必须为 1 到 %d 之间的整数", item.ScalePoints)
+		}
+	case scoreTypePassFail:
+		if value != 0 && value != 1 {
+			return scoreErrorOutOfRange, "的评分只能为通过（1）或不通过（0）"
+		}
+	case scoreTypeText:
+		return scoreErrorNotScored, "为文字评价项目，只需填写评价，不能打分"
+	}
+	return "", ""
+}
+
+// itemScoreMissing 提交时考核项目是否缺少评分：文字评价项目检查评价内容，其他类型检查分数
+func itemScoreMissing(item *models.KPIItem, value *float64, comment string) bool {
+	if itemScoreType(item) == scoreTypeText {
+		return strings.TrimSpace(comment) == ""
+	}
+	return value == nil
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"testing"
+
+	"dootask-kpi-server/models"
+)
+
+// quantitativeItem 构造量化指标考核项目
+func quantitativeItem(maxScore float64, target models.QuantitativeTarget) models.KPIItem {
+	return models.KPIItem{MaxScore: maxScore, ScoreType: scoreTypeQuantitative, QuantitativeTarget: target}
+}
+
+func TestQuantitativeScore(t *testing.T) {
+	steps := []models.CurveStep{
+		{MinPercent: 60, ScorePercent: 50},
+		{MinPercent: 80, ScorePercent: 80},
+		{MinPercent: 100, ScorePercent: 100},
+		{MinPercent: 120, ScorePercent: 130},
+	}
+
+	tests := []struct {
+		name   string
+		item   models.KPIItem
+		actual float64
+		want   float64
+	}{
+		{"线性按完成率计分", quantitativeItem(20, models.QuantitativeTarget{TargetValue: 200, ScoringCurve: scoringCurveLinear}), 150, 15},
+		{"线性超额按满分封顶", quantitativeItem(20, models.QuantitativeTarget{TargetValue: 200, ScoringCurve: scoringCurveLinear}), 300, 20},
+		{"未设置曲线按线性计分", quantitativeItem(10, models.QuantitativeTarget{TargetValue: 3}), 1, 3.33},
+		{"实际值为负按0计分", quantitativeItem(10, models.QuantitativeTarget{TargetValue: 100}), -50, 0},
+		{"目标值无效时得分为0", quantitativeItem(10, models.QuantitativeTarget{}), 100, 0},
+		{"超额封顶按比例加分", quantitativeItem(10, models.QuantitativeTarget{TargetValue: 100, ScoringCurve: scoringCurveCapped, CapPercent: 150}), 130, 13},
+		{"超额封顶不超过封顶完成率", quantitativeItem(10, models.QuantitativeTarget{TargetValue: 100, ScoringCurve: scoringCurveCapped, CapPercent: 150}), 200, 15},
+		{"超额封顶未完成按完成率计分", quantitativeItem(10, models.QuantitativeTarget{TargetValue: 100, ScoringCurve: scoringCurveCapped, CapPercent: 150}), 40, 4},
+		{"超额封顶低于100%时按100%封顶", quantitativeItem(10, models.QuantitativeTarget{TargetValue: 100, ScoringCurve: scoringCurveCapped, CapPercent: 80}), 120, 10},
+		{"阶梯未达最低档为0", quantitativeItem(10, models.QuantitativeTarget{TargetValue: 100, ScoringCurve: scoringCurveSteps, CurveSteps: steps}), 59, 0},
+		{"阶梯恰好达到档位", quantitativeItem(10, models.QuantitativeTarget{TargetValue: 100, ScoringCurve: scoringCurveSteps, CurveSteps: steps}), 80, 8},
+		{"阶梯按达到的最高档计分", quantitativeItem(10, models.QuantitativeTarget{TargetValue: 100, ScoringCurve: scoringCurveSteps, CurveSteps: steps}), 99, 8},
+		{"阶梯超额档位可超过满分", quantitativeItem(10, models.QuantitativeTarget{TargetValue: 100, ScoringCurve: scoringCurveSteps, CurveSteps: steps}), 150, 13},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := quantitativeScore(&tt.item, tt.actual); got != tt.want {
+				t.Errorf("quantitativeScore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestItemMaxPoints(t *testing.T) {
+	tests := []struct {
+		name string
+		item models.KPIItem
+		want float64
+	}{
+		{"数值项目为满分", models.KPIItem{MaxScore: 100, ScoreType: scoreTypeNumeric}, 100},
+		{"等级量表为满分", models.KPIItem{MaxScore: 20, ScoreType: scoreTypeScale, ScalePoints: 5}, 20},
+		{"线性量化指标为满分", quantitativeItem(30, models.QuantitativeTarget{TargetValue: 10, ScoringCurve: scoringCurveLinear}), 30},
+		{"超额封顶按封顶完成率", quantitativeItem(30, models.QuantitativeTarget{TargetValue: 10, ScoringCurve: scoringCurveCapped, CapPercent: 120}), 36},
+		{"超额封顶低于100%时为满分", quantitativeItem(30, models.QuantitativeTarget{TargetValue: 10, ScoringCurve: scoringCurveCapped, CapPercent: 50}), 30},
+		{"阶梯按最高档得分比例", quantitativeItem(100, models.QuantitativeTarget{TargetValue: 10, ScoringCurve: scoringCurveSteps, CurveSteps: []models.CurveStep{{MinPercent: 100, ScorePercent: 100}, {MinPercent: 150, ScorePercent: 125}}}), 125},
+		{"阶梯最高档不足100%时为满分", quantitativeItem(100, models.QuantitativeTarget{TargetValue: 10, ScoringCurve: scoringCurveSteps, CurveSteps: []models.CurveStep{{MinPercent: 50, ScorePercent: 60}}}), 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := itemMaxPoints(&tt.item); got != tt.want {
+				t.Errorf("itemMaxPoints() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestItemPoints(t *testing.T) {
+	tests := []struct {
+		name  string
+		item  models.KPIItem
+		value float64
+		want  float64
+	}{
+		{"数值按原值计分", models.KPIItem{MaxScore: 100}, 87.5, 87.5},
+		{"满分为100的数值项目", models.KPIItem{MaxScore: 100, ScoreType: scoreTypeNumeric}, 100, 100},
+		{"等级量表按级数换算", models.KPIItem{MaxScore: 20, ScoreType: scoreTypeScale, ScalePoints: 4}, 3, 15},
+		{"等级量表自动加权平均值按比例换算", models.KPIItem{MaxScore: 100, ScoreType: scoreTypeScale, ScalePoints: 5}, 3.5, 70},
+		{"等级量表级数无效时为0", models.KPIItem{MaxScore: 20, ScoreType: scoreTypeScale}, 3, 0},
+		{"通过得满分", models.KPIItem{MaxScore: 100, ScoreType: scoreTypePassFail}, 1, 100},
+		{"不通过得0分", models.KPIItem{MaxScore: 100, ScoreType: scoreTypePassFail}, 0, 0},
+		{"文字评价不计分", models.KPIItem{ScoreType: scoreTypeText}, 5, 0},
+		{"量化指标按得分计分", quantitativeItem(10, models.QuantitativeTarget{TargetValue: 100}), 12, 12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := itemPoints(&tt.item, tt.value); got != tt.want {
+				t.Errorf("itemPoints() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"dootask-kpi-server/models"
+)
+
+// setItemSnapshot 将考核项目的名称、说明、满分、权重、排序和评分类型记录到评分记录中
+func setItemSnapshot(score *models.KPIScore, item *models.KPIItem) {
+	score.ItemName = item.Name
+	score.ItemDescription = item.Description
+	score.ItemMaxScore = item.MaxScore
+	score.ItemWeight = item.Weight
+	score.ItemOrder = item.Order
+	score.ItemScoreType = item.ScoreType
+	score.ItemScalePoints = item.ScalePoints
+	score.ItemScaleAnchors = item.ScaleAnchors
+	score.ItemTarget = item.QuantitativeTarget
+}
+
+// snapshotItem 返回评分记录创建时的考核项目，没有快照（快照功能上线前创建且考核项目已删除）时返回 false
+func snapshotItem(score *models.KPIScore) (models.KPIItem, bool) {
+	if score.ItemName == "" {
+		return models.KPIItem{}, false
+	}
+	return models.KPIItem{
+		ID:          score.ItemID,
+		TemplateID:  score.Item.TemplateID,
+		Name:        score.ItemName,
+		Description: score.ItemDescription,
+		MaxScore:    score.ItemMaxScore,
+		Weight:      score.ItemWeight,
+		Order:       score.ItemOrder,
+
+		ScoreType:    score.ItemScoreType,
+		ScalePoints:  score.ItemScalePoints,
+		ScaleAnchors: score.ItemScaleAnchors,
+
+		QuantitativeTarget: score.ItemTarget,
+	}, true
+}
+
+// applyItemSnapshots 用快照覆盖评分记录中预加载的考核项目，使详情、导出和统计不受考核项目后续修改影响
+func applyItemSnapshots(scores []models.KPIScore) {
+	for i := range scores {
+		if item, ok := snapshotItem(&scores[i]); ok {
+			scores[i].Item = item
+		}
+	}
+}
+
+// itemSnapshotsOf 返回评分记录中各考核项目的快照，按考核项目ID索引
+func itemSnapshotsOf(scores []models.KPIScore) map[uint]models.KPIItem {
+	items := make(map[uint]models.KPIItem, len(scores))
+	for i := range scores {
+		if item, ok := snapshotItem(&scores[i]); ok {
+			items[item.ID] = item
+		}
+	}
+	return items
+}
+
+// evaluationItemSnapshots 返回评估中各考核项目的快照，按考核项目ID索引
+func evaluationItemSnapshots(evaluationID uint) map[uint]models.KPIItem {
+	var scores []models.KPIScore
+	models.DB.Where("evaluation_id = ?", evaluationID).Find(&scores)
+	return itemSnapshotsOf(scores)
+}
+
+// applyInvitedItemSnapshots 用评估的考核项目快照覆盖邀请评分中预加载的考核项目
+func applyInvitedItemSnapshots(items map[uint]models.KPIItem, scores []models.InvitedScore) {
+	for i := range scores {
+		if item, ok := items[scores[i].ItemID]; ok {
+			scores[i].Item = item
+		}
+	}
+}
+
+// scoreItem 返回评分记录对应的考核项目，优先使用快照
+func scoreItem(score *models.KPIScore) (models.KPIItem, bool) {
+	if item, ok := snapshotItem(score); ok {
+		return item, true
+	}
+	var item models.KPIItem
+	if err := models.DB.First(&item, score.ItemID).Error; err != nil {
+		return item, false
+	}
+	return item, true
+}
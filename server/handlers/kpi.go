@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"dootask-kpi-server/models"
 	"dootask-kpi-server/utils"
@@ -28,6 +29,18 @@ func CreateItem(c *gin.Context) {
 		})
 		return
 	}
+	if item.Weight < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "权重不能为负数",
+		})
+		return
+	}
+	if err := normalizeItemScoring(&item); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 
 	result := models.DB.Create(&item)
 	if result.Error != nil {
@@ -97,6 +110,46 @@ func UpdateItem(c *gin.Context) {
 		})
 		return
 	}
+	if updateData.Weight < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "权重不能为负数",
+		})
+		return
+	}
+
+	// 按更新后的评分类型配置校验，未提交的评分类型字段保持原值（满分未提交时按原逻辑清零）
+	scoring := item
+	if updateData.ScoreType != "" {
+		scoring.ScoreType = updateData.ScoreType
+	}
+	if updateData.ScalePoints != 0 {
+		scoring.ScalePoints = updateData.ScalePoints
+	}
+	if updateData.ScaleAnchors != nil {
+		scoring.ScaleAnchors = updateData.ScaleAnchors
+	}
+	if updateData.TargetValue != 0 {
+		scoring.TargetValue = updateData.TargetValue
+	}
+	if updateData.Unit != "" {
+		scoring.Unit = updateData.Unit
+	}
+	if updateData.ScoringCurve != "" {
+		scoring.ScoringCurve = updateData.ScoringCurve
+	}
+	if updateData.CapPercent != 0 {
+		scoring.CapPercent = updateData.CapPercent
+	}
+	if updateData.CurveSteps != nil {
+		scoring.CurveSteps = updateData.CurveSteps
+	}
+	scoring.MaxScore = updateData.MaxScore
+	if err := normalizeItemScoring(&scoring); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 
 	result = models.DB.Model(&item).Updates(updateData)
 	if result.Error != nil {
@@ -118,6 +171,17 @@ func UpdateItem(c *gin.Context) {
 		}
 	}
 
+	// 评分类型相关字段整体更新（切换类型时清空不再适用的量表和量化指标配置）
+	result = models.DB.Model(&item).Select("score_type", "scale_points", "scale_anchors",
+		"target_value", "unit", "scoring_curve", "cap_percent", "curve_steps").Updates(&scoring)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "更新评分类型失败",
+			"message": result.Error.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "KPI项目更新成功",
 		"data":    item,
@@ -166,6 +230,9 @@ func GetEvaluations(c *gin.Context) {
 	year := c.Query("year")
 	month := c.Query("month")
 	quarter := c.Query("quarter")
+	overdue := c.Query("overdue")
+	escalatedTo := c.Query("escalated_to")
+	grade := c.Query("grade") // 绩效等级，多个等级用逗号分隔
 
 	// 验证分页参数
 	if page < 1 {
@@ -208,6 +275,18 @@ func GetEvaluations(c *gin.Context) {
 	if quarter != "" {
 		query = query.Where("quarter = ?", quarter)
 	}
+	// 当前阶段已逾期
+	if overdue == "true" {
+		overdueCondition, overdueArgs := overdueEvaluationsCondition(time.Now())
+		query = query.Where(overdueCondition, overdueArgs...)
+	}
+	// 升级给指定员工、仍待主管评估的评估
+	if escalatedTo != "" {
+		query = query.Where("status = ? AND id IN (SELECT evaluation_id FROM evaluation_escalations WHERE escalated_to_id = ? AND status = ? AND "+currentEscalationCondition+")", "self_evaluated", escalatedTo, "self_evaluated")
+	}
+	if grade != "" {
+		query = query.Where("grade IN ?", strings.Split(grade, ","))
+	}
 
 	// 构建基础统计查询（不含 status 筛选，用于统计卡片）
 	// 只统计在职员工的评估
@@ -259,8 +338,8 @@ func GetEvaluations(c *gin.Context) {
 		return
 	}
 
-	// 待处理数（pending, self_evaluated, manager_evaluated, pending_confirm）
-	if err := buildStatsQuery().Where("kpi_evaluations.status IN ?", []string{"pending", "self_evaluated", "manager_evaluated", "pending_confirm"}).Count(&statsPending).Error; err != nil {
+	// 待处理数（goal_setting, goal_review, pending, self_evaluated, manager_evaluated, pending_confirm）
+	if err := buildStatsQuery().Where("kpi_evaluations.status IN ?", []string{"goal_setting", "goal_review", "pending", "self_evaluated", "manager_evaluated", "pending_confirm"}).Count(&statsPending).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "获取统计数据失败",
 			"message": err.Error(),
@@ -290,6 +369,16 @@ func GetEvaluations(c *gin.Context) {
 	}
 	statsAvgScore = avgResult.AvgScore
 
+	// 已完成评估的等级分布
+	statsGrades, err := gradeDistribution(buildStatsQuery().Where("kpi_evaluations.status = ?", "completed"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取统计数据失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
 	// 获取总数（用于分页，受 status 筛选影响）
 	var total int64
 	countQuery := models.DB.Model(&models.KPIEvaluation{})
@@ -322,6 +411,16 @@ func GetEvaluations(c *gin.Context) {
 	if quarter != "" {
 		countQuery = countQuery.Where("quarter = ?", quarter)
 	}
+	if overdue == "true" {
+		overdueCondition, overdueArgs := overdueEvaluationsCondition(time.Now())
+		countQuery = countQuery.Where(overdueCondition, overdueArgs...)
+	}
+	if escalatedTo != "" {
+		countQuery = countQuery.Where("status = ? AND id IN (SELECT evaluation_id FROM evaluation_escalations WHERE escalated_to_id = ? AND status = ? AND "+currentEscalationCondition+")", "self_evaluated", escalatedTo, "self_evaluated")
+	}
+	if grade != "" {
+		countQuery = countQuery.Where("grade IN ?", strings.Split(grade, ","))
+	}
 	if err := countQuery.Count(&total).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "获取评估总数失败",
@@ -357,15 +456,26 @@ func GetEvaluations(c *gin.Context) {
 			"pending":   statsPending,
 			"completed": statsCompleted,
 			"avgScore":  statsAvgScore,
+			"grades":    statsGrades,
 		},
 	})
 }
 
+// CreateEvaluationRequest 创建评估请求：只接受员工、模板和考核周期，其余字段由服务端维护
+type CreateEvaluationRequest struct {
+	EmployeeID uint   `json:"employee_id" binding:"required"`
+	TemplateID uint   `json:"template_id" binding:"required"`
+	Period     string `json:"period" binding:"required,oneof=monthly quarterly yearly"`
+	Year       int    `json:"year" binding:"required"`
+	Month      *int   `json:"month"`
+	Quarter    *int   `json:"quarter"`
+	Comment    string `json:"comment"` // 创建说明，作为评估的第一条评论
+}
+
 // 创建评估
 func CreateEvaluation(c *gin.Context) {
-	var evaluation models.KPIEvaluation
-
-	if err := c.ShouldBindJSON(&evaluation); err != nil {
+	var req CreateEvaluationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "请求参数错误",
 			"message": err.Error(),
@@ -373,6 +483,59 @@ func CreateEvaluation(c *gin.Context) {
 		return
 	}
 
+	month, quarter, err := normalizeEvaluationPeriod(req.Period, req.Year, req.Month, req.Quarter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// 状态、总分、等级、截止时间等字段由服务端维护，新评估从自评（或目标设定）阶段开始
+	evaluation := models.KPIEvaluation{
+		EmployeeID: req.EmployeeID,
+		TemplateID: req.TemplateID,
+		Period:     req.Period,
+		Year:       req.Year,
+		Month:      month,
+		Quarter:    quarter,
+		Status:     "pending",
+	}
+	if err := models.DB.First(&models.Employee{}, req.EmployeeID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "员工不存在",
+		})
+		return
+	}
+
+	// 同一员工、同一模板、同一考核周期只允许一份评估
+	if existing := findSamePeriodEvaluation(evaluation.EmployeeID, evaluation.TemplateID, evaluation.Year, evaluation.Month, evaluation.Quarter, 0); existing != nil {
+		respondEvaluationConflict(c, existing)
+		return
+	}
+
+	// 未指定的阶段截止时间按模板配置补全
+	var template models.KPITemplate
+	if err := models.DB.First(&template, evaluation.TemplateID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "模板不存在",
+		})
+		return
+	}
+	applyGoalSetting(&evaluation, &template)
+	applyTemplateDeadlines(&evaluation, &template, time.Now())
+
+	// 使用模板当前发布版本的考核项目和计分方式
+	source, err := templateEvaluationSource(models.DB, &template)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取KPI项目失败",
+			"message": err.Error(),
+		})
+		return
+	}
+	source.apply(&evaluation)
+
 	// 开始数据库事务
 	tx := models.DB.Begin()
 
@@ -380,6 +543,10 @@ func CreateEvaluation(c *gin.Context) {
 	result := tx.Create(&evaluation)
 	if result.Error != nil {
 		tx.Rollback()
+		if isUniqueConstraintError(result.Error) {
+			respondEvaluationConflict(c, nil)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "创建评估失败",
 			"message": result.Error.Error(),
@@ -387,20 +554,26 @@ func CreateEvaluation(c *gin.Context) {
 		return
 	}
 
-	// 获取模板的所有KPI项目
-	var items []models.KPIItem
-	tx.Where("template_id = ?", evaluation.TemplateID).Find(&items)
-
 	// 为每个KPI项目创建评分记录
-	for _, item := range items {
-		score := models.KPIScore{
+	if err := createEvaluationScores(tx, &evaluation, source.Items); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "创建评分记录失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// 创建时填写的说明作为评估的第一条评论
+	if comment := strings.TrimSpace(req.Comment); comment != "" {
+		if err := tx.Create(&models.EvaluationComment{
 			EvaluationID: evaluation.ID,
-			ItemID:       item.ID,
-		}
-		if err := tx.Create(&score).Error; err != nil {
+			UserID:       c.GetUint("user_id"),
+			Content:      comment,
+		}).Error; err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "创建评分记录失败",
+				"error":   "创建评论失败",
 				"message": err.Error(),
 			})
 			return
@@ -412,9 +585,44 @@ func CreateEvaluation(c *gin.Context) {
 	// 获取完整的评估信息
 	models.DB.Preload("Employee.Department").Preload("Template").Preload("Scores").First(&evaluation, evaluation.ID)
 
-	// 发送 DooTask 机器人通知：创建考核 -> 员工待自评
+	// 发送 DooTask 机器人通知和实时通知
+	notifyEvaluationCreated(c.GetHeader("DooTaskAuth"), c.GetUint("user_id"), &evaluation)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "评估创建成功",
+		"data":    evaluation,
+	})
+}
+
+// createEvaluationScores 为评估的每个KPI项目创建评分记录
+// 关联了OKR关键结果的量化指标按关键结果的完成率预填实际完成值
+func createEvaluationScores(tx *gorm.DB, evaluation *models.KPIEvaluation, items []models.KPIItem) error {
+	feeds, err := keyResultFeeds(tx, evaluation)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		score := models.KPIScore{
+			EvaluationID: evaluation.ID,
+			ItemID:       item.ID,
+		}
+		setItemSnapshot(&score, &item)
+		if progress, ok := feeds[item.ID]; ok {
+			applyKeyResultFeed(&score, &item, progress)
+		}
+		if err := tx.Create(&score).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifyEvaluationCreated 创建考核后通知员工待自评（DooTask 机器人通知 + 实时通知）
+// evaluation 需预加载 Employee 和 Template
+func notifyEvaluationCreated(dooTaskToken string, operatorID uint, evaluation *models.KPIEvaluation) {
 	if evaluation.Employee.DooTaskUserID != nil {
-		dooTaskClient := utils.NewDooTaskClient(c.GetHeader("DooTaskAuth"))
+		dooTaskClient := utils.NewDooTaskClient(dooTaskToken)
 		periodValue := utils.GetPeriodValue(evaluation.Period, evaluation.Year, evaluation.Month, evaluation.Quarter)
 
 		appConfigJSON := utils.BuildKPIAppConfig(evaluation.ID)
@@ -430,14 +638,7 @@ func CreateEvaluation(c *gin.Context) {
 		_ = dooTaskClient.SendBotMessage(evaluation.Employee.DooTaskUserID, message)
 	}
 
-	// 发送实时通知
-	operatorID := c.GetUint("user_id")
-	GetNotificationService().SendNotification(operatorID, EventEvaluationCreated, &evaluation)
-
-	c.JSON(http.StatusCreated, gin.H{
-		"message": "评估创建成功",
-		"data":    evaluation,
-	})
+	GetNotificationService().SendNotification(operatorID, EventEvaluationCreated, evaluation)
 }
 
 // 获取单个评估
@@ -452,19 +653,28 @@ func GetEvaluation(c *gin.Context) {
 	}
 
 	var evaluation models.KPIEvaluation
-	result := models.DB.Preload("Employee.Department").Preload("Template").Preload("Scores.Item").First(&evaluation, evaluationId)
+	result := models.DB.Preload("Employee.Department").Preload("Template").Preload("Scores.Item").Preload("Escalations.EscalatedTo").First(&evaluation, evaluationId)
 	if result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "评估不存在",
 		})
 		return
 	}
+	applyItemSnapshots(evaluation.Scores)
 
+	setVersionETag(c, evaluation.Version)
 	c.JSON(http.StatusOK, gin.H{
 		"data": evaluation,
 	})
 }
 
+// UpdateEvaluationRequest 更新评估请求：推进评估状态，并可提交总分
+// 计分方式、等级、截止时间、目标审批、绩效规则等字段由服务端维护，不接受客户端修改
+type UpdateEvaluationRequest struct {
+	Status     string   `json:"status"`
+	TotalScore *float64 `json:"total_score"` // 由服务端重新计算，只在HR处理异议后保留HR提交的值
+}
+
 // 更新评估
 func UpdateEvaluation(c *gin.Context) {
 	id := c.Param("id")
@@ -485,8 +695,8 @@ func UpdateEvaluation(c *gin.Context) {
 		return
 	}
 
-	var updateData models.KPIEvaluation
-	if err := c.ShouldBindJSON(&updateData); err != nil {
+	var req UpdateEvaluationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "请求参数错误",
 			"message": err.Error(),
@@ -494,263 +704,485 @@ func UpdateEvaluation(c *gin.Context) {
 		return
 	}
 
-	// 特殊处理：如果状态是self_evaluated，检查员工是否有主管
-	// 注意：由于在UpdateSelfScore中已经限制了所有员工（包括HR）必须有直属上级才能开始自评
-	// 所以这里理论上不应该出现没有主管的情况，但为了数据一致性，仍然进行检查
-	if updateData.Status == "self_evaluated" {
-		// 检查员工是否有直属主管
-		if evaluation.Employee.ManagerID == nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "暂无直属上级，请联系HR",
+	// 并发检查：If-Match 与当前版本不一致时拒绝
+	expectedVersion, ok := checkIfMatch(c, evaluation.Version, &evaluation)
+	if !ok {
+		return
+	}
+
+	// 只有评估的参与者（员工本人、直属上级及其受托人、HR）可以更新评估
+	var operator models.Employee
+	if err := models.DB.First(&operator, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "用户不存在",
+		})
+		return
+	}
+	actors := resolveEvaluationActors(&evaluation, &operator)
+	if len(actors) == 0 {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "无权修改此评估",
+		})
+		return
+	}
+
+	// 状态未变化时按普通更新处理
+	if req.Status == evaluation.Status {
+		req.Status = ""
+	}
+
+	// 只写入 columns 中列出的字段
+	var updateData models.KPIEvaluation
+	var columns []string
+
+	// 状态流转校验：只能按流程逐级推进，且必须由对应身份（员工、直属上级、HR）执行
+	// 进入self_evaluated时还会检查员工是否有直属上级
+	var onBehalfOf *uint
+	var transition evaluationTransition
+	if req.Status != "" {
+		var werr *workflowError
+		transition, werr = checkEvaluationTransition(&evaluation, &operator, req.Status)
+		if werr != nil {
+			c.JSON(werr.status, gin.H{
+				"error": werr.message,
+			})
+			return
+		}
+		// 受托人或升级接收人代直属上级提交主管评分
+		if transition.Action == evaluationActionSubmitManager {
+			onBehalfOf = reviewOnBehalfOf(&evaluation, operator.ID)
+		}
+		updateData.Status = req.Status
+		columns = append(columns, "status")
+	}
+
+	// 目标审批信息只在审批通过时由服务端记录
+	if transition.Action == evaluationActionApproveGoals {
+		markGoalsApproved(&updateData, operator.ID)
+		columns = append(columns, "goals_approved_at", "goals_approved_by_id")
+	}
+
+	// 总分由服务端按计分方式计算，只有异议处理后（HR已调整最终得分）由HR提交的总分保留
+	// 异议处理后其他人提交的总分忽略，保持HR调整后的总分
+	clientTotalScore := false
+	if req.TotalScore != nil {
+		var scores []models.KPIScore
+		models.DB.Where("evaluation_id = ?", evaluation.ID).Find(&scores)
+		if evaluation.FinalComment != "" {
+			if actors[evaluationActorHR] {
+				if *req.TotalScore < 0 || *req.TotalScore > 100 {
+					c.JSON(http.StatusBadRequest, gin.H{
+						"error": "总分必须在0到100之间",
+					})
+					return
+				}
+				updateData.TotalScore = *req.TotalScore
+				updateData.RawScore = rawScoreForTotal(scores, *req.TotalScore)
+				columns = append(columns, "total_score", "raw_score")
+				clientTotalScore = true
+			}
+		} else {
+			updateData.TotalScore, updateData.RawScore = evaluationTotalScore(&evaluation, scores)
+			columns = append(columns, "total_score", "raw_score")
+		}
+	}
+
+	if len(columns) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "没有需要更新的内容",
+		})
+		return
+	}
+
+	// 进入待确认前或HR直接调整总分时检查部门强制分布配额：硬性配额下超出时拒绝，否则返回提示
+	var distributionWarnings []string
+	if updateData.Status == "pending_confirm" || clientTotalScore {
+		totalScore := evaluation.TotalScore
+		if req.TotalScore != nil && (evaluation.FinalComment == "" || clientTotalScore) {
+			totalScore = updateData.TotalScore
+		}
+		distribution, err := checkEvaluationDistribution(&evaluation, totalScore)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "检查强制分布失败",
+				"message": err.Error(),
 			})
 			return
 		}
+		if distribution.Blocked {
+			respondDistributionBlocked(c, distribution)
+			return
+		}
+		distributionWarnings = distribution.Violations
+	}
+
+	// 记录变更历史
+	history := newHistoryRecorder(evaluation.ID, operator.ID, historySourceEvaluation)
+	for _, column := range columns {
+		switch column {
+		case "status":
+			history.change("status", evaluation.Status, updateData.Status)
+		case "total_score":
+			history.change("total_score", evaluation.TotalScore, updateData.TotalScore)
+		case "raw_score":
+			history.change("raw_score", evaluation.RawScore, updateData.RawScore)
+		}
 	}
 
-	result = models.DB.Model(&evaluation).Updates(updateData)
+	// 目标审批通过时与状态变更在同一事务中锁定目标
+	tx := models.DB.Begin()
+	result = whereVersion(tx.Model(&evaluation), expectedVersion).Select(append(columns, "updated_at")).Updates(&updateData)
 	if result.Error != nil {
+		tx.Rollback()
+		if isUniqueConstraintError(result.Error) {
+			respondEvaluationConflict(c, nil)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "更新评估失败",
 			"message": result.Error.Error(),
 		})
 		return
 	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		models.DB.Preload("Employee").Preload("Scores").First(&evaluation, evaluation.ID)
+		respondVersionConflict(c, evaluation.Version, &evaluation)
+		return
+	}
+	// 主管提交评分时，按配置的审批链生成审批步骤
+	if transition.Action == evaluationActionSubmitManager {
+		if _, err := startApprovalChain(tx, &evaluation); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "生成审批步骤失败",
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	// 进入新阶段时从当前时间起算该阶段的截止时间
+	if updateData.Status != "" {
+		if err := scheduleStageDeadline(tx, &evaluation, updateData.Status, time.Now()); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "设置截止时间失败",
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	// HR调整已完成评估的总分时，按调整后的总分重新确定绩效等级
+	if clientTotalScore && evaluation.Status == "completed" && updateData.Status == "" {
+		evaluation.TotalScore = updateData.TotalScore
+		if err := assignEvaluationGrade(tx, &evaluation, history); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "确定绩效等级失败",
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	if transition.Action == evaluationActionApproveGoals {
+		if err := lockEvaluationGoals(tx, &evaluation); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "锁定目标失败",
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	// 如果状态变为completed，在同一事务中确定最终得分、总分和绩效等级
+	if updateData.Status == "completed" {
+		if clientTotalScore {
+			evaluation.TotalScore, evaluation.RawScore = updateData.TotalScore, updateData.RawScore
+		}
+		keepTotal := clientTotalScore || evaluation.FinalComment != ""
+		if err := finalizeEvaluationScores(tx, &evaluation, keepTotal, c.GetUint("user_id")); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "计算最终得分失败",
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	if err := history.save(tx); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "记录变更历史失败",
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "更新评估失败",
+			"message": err.Error(),
+		})
+		return
+	}
 
 	// 当流程进入等待HR审核阶段时，根据配置自动计算HR评分
+	// 如果规则未启用、有未完成的邀请或应用失败，保持manager_evaluated状态，等待HR手动审核
 	if updateData.Status == "manager_evaluated" {
-		// 检查绩效规则是否启用
-		var rule models.PerformanceRule
-		if err := models.DB.First(&rule).Error; err == nil && rule.Enabled {
-			// 如果规则已启用，检查是否所有邀请都已完成
-			allInvitationsCompleted, err := areAllInvitationsCompleted(evaluation.ID)
-			if err == nil && allInvitationsCompleted {
-				// 所有邀请都已完成，自动计算HR评分
-				if err := applyPerformanceRuleForEvaluation(evaluation.ID); err == nil {
-					// 如果绩效规则应用成功，自动将状态推进到pending_confirm
-					models.DB.Model(&evaluation).Update("status", "pending_confirm")
-					updateData.Status = "pending_confirm"
-				}
-			}
-			// 如果有未完成的邀请，保持manager_evaluated状态，等待所有邀请完成
+		if tryAutoConfirmEvaluation(evaluation.ID) {
+			updateData.Status = "pending_confirm"
 		}
-		// 如果规则未启用或应用失败，保持manager_evaluated状态，等待HR手动审核
 	}
 
-	// 如果状态变为completed，自动计算最终得分
-	if updateData.Status == "completed" {
-		var scores []models.KPIScore
-		if err := models.DB.Where("evaluation_id = ?", evaluation.ID).Find(&scores).Error; err == nil {
-			// 更新各项目的final_score
-			for _, s := range scores {
-				var final float64
-				if s.HRScore != nil {
-					final = *s.HRScore
-				} else if s.ManagerScore != nil {
-					final = *s.ManagerScore
-				} else if s.SelfScore != nil {
-					final = *s.SelfScore
-				}
-				models.DB.Model(&s).Update("final_score", final)
-			}
+	// 重新加载更新后的数据
+	models.DB.Preload("Employee.Manager").Preload("Template").First(&evaluation, evaluationId)
 
-			// 如果前端发送了total_score（说明可能已经过异议处理调整），使用前端发送的值
-			// 否则，如果存在异议处理（有final_comment），保持现有的total_score
-			// 否则，重新计算total_score
-			if updateData.TotalScore > 0 {
-				// 使用前端发送的total_score（已通过异议处理调整）
-				models.DB.Model(&evaluation).Update("total_score", updateData.TotalScore)
-			} else if evaluation.FinalComment != "" {
-				// 存在异议处理，保持现有的total_score
-				// 不更新total_score
-			} else {
-				// 没有异议处理，正常计算最终得分
-				total := 0.0
-				for _, s := range scores {
-					var final float64
-					if s.HRScore != nil {
-						final = *s.HRScore
-					} else if s.ManagerScore != nil {
-						final = *s.ManagerScore
-					} else if s.SelfScore != nil {
-						final = *s.SelfScore
-					}
-					total += final
-				}
-				models.DB.Model(&evaluation).Update("total_score", total)
-			}
+	// 根据状态变更自动创建绩效评论并发送 DooTask 机器人通知
+	if updateData.Status != "" {
+		notifyEvaluationStatusChanged(c.GetHeader("DooTaskAuth"), &operator, onBehalfOf, &evaluation, updateData.Status)
+	}
+
+	// 发送实时通知
+	operatorID := c.GetUint("user_id")
+	if updateData.Status != "" {
+		// 状态变更通知
+		GetNotificationService().SendNotificationOnBehalf(operatorID, onBehalfOf, EventEvaluationStatusChange, &evaluation)
+	} else {
+		// 一般更新通知
+		GetNotificationService().SendNotification(operatorID, EventEvaluationUpdated, &evaluation)
+	}
+
+	setVersionETag(c, evaluation.Version)
+	response := gin.H{
+		"message": "评估更新成功",
+		"data":    evaluation,
+	}
+	if len(distributionWarnings) > 0 {
+		response["distribution_warnings"] = distributionWarnings
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// finalizeEvaluationScores 评估完成时确定各项目最终得分，按计分方式计算总分并确定绩效等级
+// keepTotal 为 true 时（HR已处理异议并调整总分）保留当前总分
+func finalizeEvaluationScores(tx *gorm.DB, evaluation *models.KPIEvaluation, keepTotal bool, operatorID uint) error {
+	var scores []models.KPIScore
+	if err := tx.Where("evaluation_id = ?", evaluation.ID).Find(&scores).Error; err != nil {
+		return err
+	}
+	history := newHistoryRecorder(evaluation.ID, operatorID, historySourceFinalScore)
+
+	// 各项目的最终得分：HR评分 > 上级评分 > 自评 > 量化指标自动得分
+	for i := range scores {
+		s := &scores[i]
+		var final float64
+		if s.HRScore != nil {
+			final = *s.HRScore
+		} else if s.ManagerScore != nil {
+			final = *s.ManagerScore
+		} else if s.SelfScore != nil {
+			final = *s.SelfScore
+		} else if s.AutoScore != nil {
+			final = *s.AutoScore
 		}
+		history.scoreChange(s, "final_score", s.FinalScore, final)
+		if err := tx.Model(s).Update("final_score", final).Error; err != nil {
+			return err
+		}
+		s.FinalScore = &final
 	}
 
-	// 重新加载更新后的数据
-	models.DB.Preload("Employee.Manager").Preload("Template").First(&evaluation, evaluationId)
+	// 没有异议处理时按计分方式计算最终得分，异议处理后保持HR调整的总分
+	if !keepTotal {
+		total, raw := evaluationTotalScore(evaluation, scores)
+		history.change("total_score", evaluation.TotalScore, total)
+		history.change("raw_score", evaluation.RawScore, raw)
+		if err := tx.Model(&models.KPIEvaluation{}).Where("id = ?", evaluation.ID).Updates(map[string]interface{}{
+			"total_score": total,
+			"raw_score":   raw,
+		}).Error; err != nil {
+			return err
+		}
+		evaluation.TotalScore, evaluation.RawScore = total, raw
+	}
+
+	// 按最终得分确定绩效等级
+	if err := assignEvaluationGrade(tx, evaluation, history); err != nil {
+		return err
+	}
+	return history.save(tx)
+}
 
+// notifyEvaluationStatusChanged 评估状态变更后创建自动评论并发送 DooTask 机器人通知
+// evaluation 需预加载 Employee.Manager 和 Template，onBehalfOf 为受托人或升级接收人所代理的直属上级
+func notifyEvaluationStatusChanged(dooTaskToken string, operator *models.Employee, onBehalfOf *uint, evaluation *models.KPIEvaluation, status string) {
 	// 根据状态变更自动创建绩效评论
-	if updateData.Status != "" {
-		var scores []models.KPIScore
-		if err := models.DB.Where("evaluation_id = ?", evaluationId).Find(&scores).Error; err == nil {
-			switch updateData.Status {
-			case "self_evaluated":
-				// 计算员工自评总分
-				totalSelfScore := 0.0
-				for _, s := range scores {
-					if s.SelfScore != nil {
-						totalSelfScore += *s.SelfScore
-					}
-				}
-				// 创建自动评论：员工自评，总分X
-				commentContent := fmt.Sprintf("员工自评，总分%s", formatScore(totalSelfScore))
-				if err := createAutoComment(evaluation.ID, evaluation.EmployeeID, commentContent); err != nil {
-					// 评论创建失败不影响主流程，仅记录错误
-					fmt.Printf("创建员工自评自动评论失败: %v\n", err)
-				}
+	var scores []models.KPIScore
+	if err := models.DB.Where("evaluation_id = ?", evaluation.ID).Find(&scores).Error; err == nil {
+		switch status {
+		case "self_evaluated":
+			// 按计分方式计算员工自评总分
+			totalSelfScore := roleTotalScore(evaluation, scores, "self")
+			// 创建自动评论：员工自评，总分X
+			commentContent := fmt.Sprintf("员工自评，总分%s", formatScore(totalSelfScore))
+			if err := createAutoComment(evaluation.ID, evaluation.EmployeeID, commentContent); err != nil {
+				// 评论创建失败不影响主流程，仅记录错误
+				fmt.Printf("创建员工自评自动评论失败: %v\n", err)
+			}
 
-			case "manager_evaluated":
-				// 计算主管评分总分
-				totalManagerScore := 0.0
-				for _, s := range scores {
-					if s.ManagerScore != nil {
-						totalManagerScore += *s.ManagerScore
-					}
+		case "manager_evaluated":
+			// 按计分方式计算主管评分总分
+			totalManagerScore := roleTotalScore(evaluation, scores, "manager")
+			// 创建自动评论：主管评分，总分X（受托人或升级接收人提交时署名为“X 代 Y”）
+			if evaluation.Employee.ManagerID != nil {
+				commentContent := fmt.Sprintf("主管评分，总分%s", formatScore(totalManagerScore))
+				commentUserID := *evaluation.Employee.ManagerID
+				if onBehalfOf != nil {
+					commentUserID = operator.ID
 				}
-				// 创建自动评论：主管评分，总分X
-				if evaluation.Employee.ManagerID != nil {
-					commentContent := fmt.Sprintf("主管评分，总分%s", formatScore(totalManagerScore))
-					if err := createAutoComment(evaluation.ID, *evaluation.Employee.ManagerID, commentContent); err != nil {
-						fmt.Printf("创建主管评分自动评论失败: %v\n", err)
-					}
+				if err := createAutoCommentOnBehalf(evaluation.ID, commentUserID, onBehalfOf, commentContent); err != nil {
+					fmt.Printf("创建主管评分自动评论失败: %v\n", err)
 				}
+			}
 
-			case "pending_confirm":
-				// 只有在HR手动审核时才创建评论（绩效规则自动计算的情况在applyPerformanceRuleForEvaluation中处理）
-				// 检查是否是通过绩效规则自动计算的（通过检查是否有HR评分且HR评论是自动计算的）
-				isAutoCalculated := false
-				for _, s := range scores {
-					if s.HRScore != nil && s.HRComment == autoHRScoreComment {
-						isAutoCalculated = true
-						break
-					}
+		case "pending_confirm":
+			// 只有在HR手动审核时才创建评论（绩效规则自动计算的情况在applyPerformanceRuleForEvaluation中处理）
+			// 检查是否是通过绩效规则自动计算的（通过检查是否有HR评分且HR评论是自动计算的）
+			isAutoCalculated := false
+			for _, s := range scores {
+				if s.HRScore != nil && s.HRComment == autoHRScoreComment {
+					isAutoCalculated = true
+					break
 				}
-				// 如果不是自动计算的，说明是HR手动审核，创建评论
-				if !isAutoCalculated {
-					// 计算HR评分总分（使用TotalScore或HRScore之和）
-					totalHRScore := evaluation.TotalScore
-					if totalHRScore == 0 {
-						// 如果TotalScore为0，计算HRScore之和
-						for _, s := range scores {
-							if s.HRScore != nil {
-								totalHRScore += *s.HRScore
-							}
-						}
-					}
-					// 创建自动评论：HR评分，总分X
-					operatorID := c.GetUint("user_id")
-					commentContent := fmt.Sprintf("HR评分，总分%s", formatScore(totalHRScore))
-					if err := createAutoComment(evaluation.ID, operatorID, commentContent); err != nil {
-						fmt.Printf("创建HR评分自动评论失败: %v\n", err)
-					}
+			}
+			// 如果不是自动计算的，说明是HR手动审核，创建评论
+			if !isAutoCalculated {
+				// HR审核后的总分按各项目有效得分计算，与评估保存的总分一致
+				totalHRScore, _ := evaluationTotalScore(evaluation, scores)
+				// 创建自动评论：HR评分，总分X
+				commentContent := fmt.Sprintf("HR评分，总分%s", formatScore(totalHRScore))
+				if err := createAutoComment(evaluation.ID, operator.ID, commentContent); err != nil {
+					fmt.Printf("创建HR评分自动评论失败: %v\n", err)
 				}
 			}
 		}
 	}
 
 	// 发送DooTask机器人通知（根据状态变更）
-	if updateData.Status != "" {
-		dooTaskClient := utils.NewDooTaskClient(c.GetHeader("DooTaskAuth"))
-		periodValue := utils.GetPeriodValue(evaluation.Period, evaluation.Year, evaluation.Month, evaluation.Quarter)
-
-		switch updateData.Status {
-		case "self_evaluated":
-			// 完成自评：通知主管
-			if evaluation.Employee.Manager != nil && evaluation.Employee.Manager.DooTaskUserID != nil {
-				appConfigJSON := utils.BuildKPIAppConfig(evaluation.ID)
-
-				message := fmt.Sprintf(
-					"**你有一条绩效考核待评估**\n- 考核模板：%s\n- 考核周期：%s\n- 部门员工：%s\n\n> <div class=\"open-micro-app\" data-app-config='%s'>查看详情：点击查看详情</div>",
-					evaluation.Template.Name,
-					periodValue,
-					evaluation.Employee.Name,
-					appConfigJSON,
-				)
-				_ = dooTaskClient.SendBotMessage(evaluation.Employee.Manager.DooTaskUserID, message)
-			}
+	dooTaskClient := utils.NewDooTaskClient(dooTaskToken)
+	periodValue := utils.GetPeriodValue(evaluation.Period, evaluation.Year, evaluation.Month, evaluation.Quarter)
 
-		case "manager_evaluated":
-			// 完成主管评分：如仍处于待HR审核阶段，则通知HR
-			// （当启用了绩效规则且自动推进到 pending_confirm 时，这里不会进入）
+	switch status {
+	case "self_evaluated":
+		// 完成自评：通知主管
+		if evaluation.Employee.Manager != nil && evaluation.Employee.Manager.DooTaskUserID != nil {
 			appConfigJSON := utils.BuildKPIAppConfig(evaluation.ID)
 
-			hrUserIDs := GetNotificationService().GetAllHRUsers()
-			for _, hrID := range hrUserIDs {
-				var hr models.Employee
-				if err := models.DB.First(&hr, hrID).Error; err != nil || hr.DooTaskUserID == nil {
+			message := fmt.Sprintf(
+				"**你有一条绩效考核待评估**\n- 考核模板：%s\n- 考核周期：%s\n- 部门员工：%s\n\n> <div class=\"open-micro-app\" data-app-config='%s'>查看详情：点击查看详情</div>",
+				evaluation.Template.Name,
+				periodValue,
+				evaluation.Employee.Name,
+				appConfigJSON,
+			)
+			_ = dooTaskClient.SendBotMessage(evaluation.Employee.Manager.DooTaskUserID, message)
+		}
+		// 主管委托期间：同时通知受托人
+		if evaluation.Employee.Manager != nil {
+			appConfigJSON := utils.BuildKPIAppConfig(evaluation.ID)
+			for _, delegate := range activeDelegatesOf(evaluation.Employee.Manager.ID, time.Now()) {
+				if delegate.DooTaskUserID == nil {
 					continue
 				}
-
 				message := fmt.Sprintf(
-					"**你有一条绩效考核待审核**\n- 考核模板：%s\n- 考核周期：%s\n- 部门员工：%s\n\n> <div class=\"open-micro-app\" data-app-config='%s'>查看详情：点击查看详情</div>",
+					"**你有一条受托的绩效考核待评估**\n- 考核模板：%s\n- 考核周期：%s\n- 部门员工：%s\n- 委托人：%s\n\n> <div class=\"open-micro-app\" data-app-config='%s'>查看详情：点击查看详情</div>",
 					evaluation.Template.Name,
 					periodValue,
 					evaluation.Employee.Name,
+					evaluation.Employee.Manager.Name,
 					appConfigJSON,
 				)
-
-				_ = dooTaskClient.SendBotMessage(hr.DooTaskUserID, message)
+				_ = dooTaskClient.SendBotMessage(delegate.DooTaskUserID, message)
 			}
+		}
 
-		case "pending_confirm":
-			// 完成审核（HR人工或规则自动）：通知员工确认
-			if evaluation.Employee.DooTaskUserID != nil {
-				appConfigJSON := utils.BuildKPIAppConfig(evaluation.ID)
-
-				message := fmt.Sprintf(
-					"**你的绩效已审核完成，请确认结果**\n- 考核模板：%s\n- 考核周期：%s\n- 总分：%.1f\n\n> <div class=\"open-micro-app\" data-app-config='%s'>查看详情：点击查看详情</div>",
-					evaluation.Template.Name,
-					periodValue,
-					evaluation.TotalScore,
-					appConfigJSON,
-				)
-				_ = dooTaskClient.SendBotMessage(evaluation.Employee.DooTaskUserID, message)
-			}
+	case "manager_evaluated":
+		// 完成主管评分：配置了审批链时通知第一步的审批人，否则如仍处于待HR审核阶段，则通知HR
+		// （当启用了绩效规则且自动推进到 pending_confirm 时，这里不会进入）
+		if step := currentApprovalStep(evaluation.ID); step != nil {
+			notifyApprovalStepPending(dooTaskToken, operator.ID, evaluation, step)
+			break
+		}
+		reviewerLine := ""
+		if onBehalfOf != nil {
+			reviewerLine = fmt.Sprintf("\n- 主管评分：%s", onBehalfOfText(operator.Name, onBehalfOf))
+		}
+		notifyHRReviewPending(dooTaskToken, evaluation, reviewerLine)
 
-		case "completed":
-			// 员工确认完成：通知 HR
+	case "pending_confirm":
+		// 完成审核（HR人工或规则自动）：通知员工确认
+		if evaluation.Employee.DooTaskUserID != nil {
 			appConfigJSON := utils.BuildKPIAppConfig(evaluation.ID)
 
-			hrUserIDs := GetNotificationService().GetAllHRUsers()
-			for _, hrID := range hrUserIDs {
-				var hr models.Employee
-				if err := models.DB.First(&hr, hrID).Error; err != nil || hr.DooTaskUserID == nil {
-					continue
-				}
-
-				message := fmt.Sprintf(
-					"**绩效已完成**\n- 考核模板：%s\n- 考核周期：%s\n- 部门员工：%s\n- 总分：%.1f\n\n> <div class=\"open-micro-app\" data-app-config='%s'>查看详情：点击查看详情</div>",
-					evaluation.Template.Name,
-					periodValue,
-					evaluation.Employee.Name,
-					evaluation.TotalScore,
-					appConfigJSON,
-				)
+			message := fmt.Sprintf(
+				"**你的绩效已审核完成，请确认结果**\n- 考核模板：%s\n- 考核周期：%s\n- 总分：%.1f\n\n> <div class=\"open-micro-app\" data-app-config='%s'>查看详情：点击查看详情</div>",
+				evaluation.Template.Name,
+				periodValue,
+				evaluation.TotalScore,
+				appConfigJSON,
+			)
+			_ = dooTaskClient.SendBotMessage(evaluation.Employee.DooTaskUserID, message)
+		}
 
-				_ = dooTaskClient.SendBotMessage(hr.DooTaskUserID, message)
+	case "completed":
+		// 员工确认完成：通知 HR
+		appConfigJSON := utils.BuildKPIAppConfig(evaluation.ID)
+
+		hrUserIDs := GetNotificationService().GetAllHRUsers()
+		for _, hrID := range hrUserIDs {
+			var hr models.Employee
+			if err := models.DB.First(&hr, hrID).Error; err != nil || hr.DooTaskUserID == nil {
+				continue
 			}
+
+			message := fmt.Sprintf(
+				"**绩效已完成**\n- 考核模板：%s\n- 考核周期：%s\n- 部门员工：%s\n- 总分：%.1f\n\n> <div class=\"open-micro-app\" data-app-config='%s'>查看详情：点击查看详情</div>",
+				evaluation.Template.Name,
+				periodValue,
+				evaluation.Employee.Name,
+				evaluation.TotalScore,
+				appConfigJSON,
+			)
+
+			_ = dooTaskClient.SendBotMessage(hr.DooTaskUserID, message)
 		}
 	}
+}
 
-	// 发送实时通知
-	operatorID := c.GetUint("user_id")
-	if updateData.Status != "" {
-		// 状态变更通知
-		GetNotificationService().SendNotification(operatorID, EventEvaluationStatusChange, &evaluation)
-	} else {
-		// 一般更新通知
-		GetNotificationService().SendNotification(operatorID, EventEvaluationUpdated, &evaluation)
-	}
+// notifyHRReviewPending 评估进入待HR审核时通知所有HR，extraLines 为附加在消息中的说明行
+// evaluation 需预加载 Employee 和 Template
+func notifyHRReviewPending(dooTaskToken string, evaluation *models.KPIEvaluation, extraLines string) {
+	dooTaskClient := utils.NewDooTaskClient(dooTaskToken)
+	periodValue := utils.GetPeriodValue(evaluation.Period, evaluation.Year, evaluation.Month, evaluation.Quarter)
+	appConfigJSON := utils.BuildKPIAppConfig(evaluation.ID)
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "评估更新成功",
-		"data":    evaluation,
-	})
+	hrUserIDs := GetNotificationService().GetAllHRUsers()
+	for _, hrID := range hrUserIDs {
+		var hr models.Employee
+		if err := models.DB.First(&hr, hrID).Error; err != nil || hr.DooTaskUserID == nil {
+			continue
+		}
+
+		message := fmt.Sprintf(
+			"**你有一条绩效考核待审核**\n- 考核模板：%s\n- 考核周期：%s\n- 部门员工：%s%s\n\n> <div class=\"open-micro-app\" data-app-config='%s'>查看详情：点击查看详情</div>",
+			evaluation.Template.Name,
+			periodValue,
+			evaluation.Employee.Name,
+			extraLines,
+			appConfigJSON,
+		)
+
+		_ = dooTaskClient.SendBotMessage(hr.DooTaskUserID, message)
+	}
 }
 
 // 删除评估
@@ -773,17 +1205,13 @@ func DeleteEvaluation(c *gin.Context) {
 		return
 	}
 
-	// 删除相关的评分记录
-	models.DB.Where("evaluation_id = ?", evaluationId).Delete(&models.KPIScore{})
-
-	// 删除相关的邀请记录
-	models.DB.Where("evaluation_id = ?", evaluationId).Delete(&models.EvaluationInvitation{})
-
-	result := models.DB.Delete(&models.KPIEvaluation{}, evaluationId)
-	if result.Error != nil {
+	// 删除评估及相关的评分、目标、邀请、审批、校准等记录
+	if err := models.DB.Transaction(func(tx *gorm.DB) error {
+		return deleteEvaluationRecords(tx, []uint{evaluation.ID})
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "删除评估失败",
-			"message": result.Error.Error(),
+			"message": err.Error(),
 		})
 		return
 	}
@@ -838,7 +1266,7 @@ func GetPendingEvaluations(c *gin.Context) {
 	var evaluations []models.KPIEvaluation
 
 	// 获取需要当前员工处理的评估
-	result := models.DB.Preload("Employee.Department").Preload("Template").Where("employee_id = ? AND status IN ?", empId, []string{"pending", "self_evaluated"}).Find(&evaluations)
+	result := models.DB.Preload("Employee.Department").Preload("Template").Where("employee_id = ? AND status IN ?", empId, []string{"goal_setting", "pending", "self_evaluated"}).Find(&evaluations)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "获取待处理评估失败",
@@ -866,20 +1294,20 @@ func GetPendingCountEvaluations(c *gin.Context) {
 
 	var totalCount int64
 
-	// 所有角色：自己的待自评 + 待确认
+	// 所有角色：自己的待设定目标 + 待自评 + 待确认
 	if err := models.DB.Model(&models.KPIEvaluation{}).
-		Where("employee_id = ? AND status IN ?", userID, []string{"pending", "pending_confirm"}).
+		Where("employee_id = ? AND status IN ?", userID, []string{"goal_setting", "pending", "pending_confirm"}).
 		Count(&totalCount).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取待确认评估数量失败"})
 		return
 	}
 
-	// 主管：增加部门内员工的 self_evaluated（待主管评估）
+	// 主管：增加部门内员工的 goal_review（待确认目标）和 self_evaluated（待主管评估）
 	if user.Role == "manager" {
 		var deptSelfEvaluatedCount int64
 		if err := models.DB.Model(&models.KPIEvaluation{}).
 			Joins("JOIN employees ON employees.id = kpi_evaluations.employee_id").
-			Where("employees.department_id = ? AND kpi_evaluations.status = ?", user.DepartmentID, "self_evaluated").
+			Where("employees.department_id = ? AND kpi_evaluations.status IN ?", user.DepartmentID, []string{"goal_review", "self_evaluated"}).
 			Count(&deptSelfEvaluatedCount).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取待确认评估数量失败"})
 			return
@@ -909,6 +1337,16 @@ func GetPendingCountEvaluations(c *gin.Context) {
 		totalCount += deptSelfEvaluatedCount
 	}
 
+	// 审批链：增加待当前用户处理的审批步骤（HR已统计所有待HR审核的评估）
+	if user.Role != "hr" {
+		steps, err := pendingApprovalsFor(&user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取待确认评估数量失败"})
+			return
+		}
+		totalCount += int64(len(steps))
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"count": totalCount,
 	})
@@ -934,6 +1372,7 @@ func GetEvaluationScores(c *gin.Context) {
 		})
 		return
 	}
+	applyItemSnapshots(scores)
 
 	c.JSON(http.StatusOK, gin.H{
 		"data":  scores,
@@ -974,6 +1413,24 @@ func UpdateSelfScore(c *gin.Context) {
 		return
 	}
 
+	// 权限与阶段检查：只能在自评阶段由员工本人评分
+	transition := roleScoreTransition("self")
+	if !authorizeScoreWrite(c, &score.Evaluation, transition.From, transition.Actors, transition.Label) {
+		return
+	}
+
+	// 校验分数范围、小数位数和评价说明
+	if errs := validateScore(&score, "self_score", updateData.SelfScore, updateData.SelfComment); len(errs) > 0 {
+		respondScoreValidationErrors(c, errs)
+		return
+	}
+
+	// 并发检查：If-Match 与当前版本不一致时拒绝
+	expectedVersion, ok := checkIfMatch(c, score.Version, &score)
+	if !ok {
+		return
+	}
+
 	// 检查是否是第一次保存自评分数（开始自评时）
 	// 如果之前没有自评分数，且现在要保存自评分数，则检查是否有直属上级
 	if score.SelfScore == nil && updateData.SelfScore != nil {
@@ -986,23 +1443,35 @@ func UpdateSelfScore(c *gin.Context) {
 		}
 	}
 
-	result = models.DB.Model(&score).Updates(map[string]interface{}{
+	operatorID := c.GetUint("user_id")
+	history := newHistoryRecorder(score.EvaluationID, operatorID, historySourceSelfScore)
+	history.scoreChange(&score, "self_score", score.SelfScore, updateData.SelfScore)
+	history.scoreChange(&score, "self_comment", score.SelfComment, updateData.SelfComment)
+
+	// 更新与变更历史在同一事务中写入
+	err = updateVersioned(&score, expectedVersion, map[string]interface{}{
 		"self_score":   updateData.SelfScore,
 		"self_comment": updateData.SelfComment,
-	})
-
-	if result.Error != nil {
+	}, history)
+	if errors.Is(err, errVersionConflict) {
+		models.DB.First(&score, score.ID)
+		respondVersionConflict(c, score.Version, &score)
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "更新自评分数失败",
-			"message": result.Error.Error(),
+			"message": err.Error(),
 		})
 		return
 	}
+	models.DB.First(&score, score.ID)
 
 	// 发送实时通知
-	operatorID := c.GetUint("user_id")
 	GetNotificationService().SendNotification(operatorID, EventSelfScoreUpdated, &score)
 
+	setVersionETag(c, score.Version)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "自评分数更新成功",
 		"data":    score,
@@ -1021,7 +1490,7 @@ func UpdateManagerScore(c *gin.Context) {
 	}
 
 	var score models.KPIScore
-	result := models.DB.First(&score, scoreId)
+	result := models.DB.Preload("Evaluation.Employee").First(&score, scoreId)
 	if result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "评分记录不存在",
@@ -1042,22 +1511,57 @@ func UpdateManagerScore(c *gin.Context) {
 		return
 	}
 
-	result = models.DB.Model(&score).Updates(map[string]interface{}{
-		"manager_score":   updateData.ManagerScore,
-		"manager_comment": updateData.ManagerComment,
-	})
+	// 权限与阶段检查：只能在主管评分阶段由直属上级（或受托人、升级接收人）评分
+	transition := roleScoreTransition("manager")
+	if !authorizeScoreWrite(c, &score.Evaluation, transition.From, transition.Actors, transition.Label) {
+		return
+	}
+	operatorID := c.GetUint("user_id")
+	onBehalfOf := reviewOnBehalfOf(&score.Evaluation, operatorID)
 
-	if result.Error != nil {
+	// 校验分数范围、小数位数和评价说明
+	if errs := validateScore(&score, "manager_score", updateData.ManagerScore, updateData.ManagerComment); len(errs) > 0 {
+		respondScoreValidationErrors(c, errs)
+		return
+	}
+
+	// 并发检查：If-Match 与当前版本不一致时拒绝
+	expectedVersion, ok := checkIfMatch(c, score.Version, &score)
+	if !ok {
+		return
+	}
+
+	reviewerID := operatorID
+	history := newHistoryRecorder(score.EvaluationID, operatorID, historySourceManagerScore)
+	history.scoreChange(&score, "manager_score", score.ManagerScore, updateData.ManagerScore)
+	history.scoreChange(&score, "manager_comment", score.ManagerComment, updateData.ManagerComment)
+	history.scoreChange(&score, "manager_on_behalf_of_id", score.ManagerOnBehalfOfID, onBehalfOf)
+
+	// 更新与变更历史在同一事务中写入
+	err = updateVersioned(&score, expectedVersion, map[string]interface{}{
+		"manager_score":           updateData.ManagerScore,
+		"manager_comment":         updateData.ManagerComment,
+		"manager_reviewer_id":     &reviewerID,
+		"manager_on_behalf_of_id": onBehalfOf,
+	}, history)
+	if errors.Is(err, errVersionConflict) {
+		models.DB.First(&score, score.ID)
+		respondVersionConflict(c, score.Version, &score)
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "更新上级评分失败",
-			"message": result.Error.Error(),
+			"message": err.Error(),
 		})
 		return
 	}
+	models.DB.First(&score, score.ID)
 
 	// 发送实时通知
-	operatorID := c.GetUint("user_id")
-	GetNotificationService().SendNotification(operatorID, EventManagerScoreUpdated, &score)
+	GetNotificationService().SendNotificationOnBehalf(operatorID, onBehalfOf, EventManagerScoreUpdated, &score)
+
+	setVersionETag(c, score.Version)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "上级评分更新成功",
@@ -1077,7 +1581,7 @@ func UpdateHRScore(c *gin.Context) {
 	}
 
 	var score models.KPIScore
-	result := models.DB.First(&score, scoreId)
+	result := models.DB.Preload("Evaluation.Employee").First(&score, scoreId)
 	if result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "评分记录不存在",
@@ -1098,23 +1602,53 @@ func UpdateHRScore(c *gin.Context) {
 		return
 	}
 
-	result = models.DB.Model(&score).Updates(map[string]interface{}{
+	// 权限与阶段检查：只能在HR审核阶段由HR评分
+	transition := roleScoreTransition("hr")
+	if !authorizeScoreWrite(c, &score.Evaluation, transition.From, transition.Actors, transition.Label) {
+		return
+	}
+
+	// 校验分数范围、小数位数和评价说明
+	if errs := validateScore(&score, "hr_score", updateData.HRScore, updateData.HRComment); len(errs) > 0 {
+		respondScoreValidationErrors(c, errs)
+		return
+	}
+
+	// 并发检查：If-Match 与当前版本不一致时拒绝
+	expectedVersion, ok := checkIfMatch(c, score.Version, &score)
+	if !ok {
+		return
+	}
+
+	operatorID := c.GetUint("user_id")
+	history := newHistoryRecorder(score.EvaluationID, operatorID, historySourceHRScore)
+	history.scoreChange(&score, "hr_score", score.HRScore, updateData.HRScore)
+	history.scoreChange(&score, "hr_comment", score.HRComment, updateData.HRComment)
+
+	// 更新与变更历史在同一事务中写入
+	err = updateVersioned(&score, expectedVersion, map[string]interface{}{
 		"hr_score":   updateData.HRScore,
 		"hr_comment": updateData.HRComment,
-	})
-
-	if result.Error != nil {
+	}, history)
+	if errors.Is(err, errVersionConflict) {
+		models.DB.First(&score, score.ID)
+		respondVersionConflict(c, score.Version, &score)
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "更新HR评分失败",
-			"message": result.Error.Error(),
+			"message": err.Error(),
 		})
 		return
 	}
+	models.DB.First(&score, score.ID)
 
 	// 发送实时通知
-	operatorID := c.GetUint("user_id")
 	GetNotificationService().SendNotification(operatorID, EventHRScoreUpdated, &score)
 
+	setVersionETag(c, score.Version)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "HR评分更新成功",
 		"data":    score,
@@ -1133,7 +1667,7 @@ func UpdateFinalScore(c *gin.Context) {
 	}
 
 	var score models.KPIScore
-	result := models.DB.First(&score, scoreId)
+	result := models.DB.Preload("Evaluation.Employee").First(&score, scoreId)
 	if result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "评分记录不存在",
@@ -1154,18 +1688,47 @@ func UpdateFinalScore(c *gin.Context) {
 		return
 	}
 
-	result = models.DB.Model(&score).Updates(map[string]interface{}{
+	// 权限与阶段检查：最终得分只在待确认阶段由HR调整（如处理异议）
+	if !authorizeScoreWrite(c, &score.Evaluation, "pending_confirm", []string{evaluationActorHR}, "调整最终得分") {
+		return
+	}
+
+	// 校验分数范围、小数位数和评价说明
+	if errs := validateScore(&score, "final_score", updateData.FinalScore, updateData.FinalComment); len(errs) > 0 {
+		respondScoreValidationErrors(c, errs)
+		return
+	}
+
+	// 并发检查：If-Match 与当前版本不一致时拒绝
+	expectedVersion, ok := checkIfMatch(c, score.Version, &score)
+	if !ok {
+		return
+	}
+
+	history := newHistoryRecorder(score.EvaluationID, c.GetUint("user_id"), historySourceFinalScore)
+	history.scoreChange(&score, "final_score", score.FinalScore, updateData.FinalScore)
+	history.scoreChange(&score, "final_comment", score.FinalComment, updateData.FinalComment)
+
+	// 更新与变更历史在同一事务中写入
+	err = updateVersioned(&score, expectedVersion, map[string]interface{}{
 		"final_score":   updateData.FinalScore,
 		"final_comment": updateData.FinalComment,
-	})
-
-	if result.Error != nil {
+	}, history)
+	if errors.Is(err, errVersionConflict) {
+		models.DB.First(&score, score.ID)
+		respondVersionConflict(c, score.Version, &score)
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "更新最终得分失败",
-			"message": result.Error.Error(),
+			"message": err.Error(),
 		})
 		return
 	}
+	models.DB.First(&score, score.ID)
+
+	setVersionETag(c, score.Version)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "最终得分更新成功",
@@ -1230,16 +1793,31 @@ func SubmitObjection(c *gin.Context) {
 		return
 	}
 
+	// 并发检查：If-Match 与当前版本不一致时拒绝
+	expectedVersion, ok := checkIfMatch(c, evaluation.Version, &evaluation)
+	if !ok {
+		return
+	}
+
+	history := newHistoryRecorder(evaluation.ID, userID, historySourceObjection)
+	history.change("has_objection", evaluation.HasObjection, true)
+	history.change("objection_reason", evaluation.ObjectionReason, objectionData.Reason)
+
 	// 更新评估，添加异议
-	result = models.DB.Model(&evaluation).Updates(map[string]interface{}{
+	// 更新与变更历史在同一事务中写入
+	err = updateVersioned(&evaluation, expectedVersion, map[string]interface{}{
 		"has_objection":    true,
 		"objection_reason": objectionData.Reason,
-	})
-
-	if result.Error != nil {
+	}, history)
+	if errors.Is(err, errVersionConflict) {
+		models.DB.First(&evaluation, evaluation.ID)
+		respondVersionConflict(c, evaluation.Version, &evaluation)
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "提交异议失败",
-			"message": result.Error.Error(),
+			"message": err.Error(),
 		})
 		return
 	}
@@ -1299,6 +1877,7 @@ func SubmitObjection(c *gin.Context) {
 		notificationService.SendNotification(hrID, EventObjectionSubmitted, &evaluation)
 	}
 
+	setVersionETag(c, evaluation.Version)
 	c.JSON(http.StatusOK, gin.H{
 		"message": "异议提交成功",
 		"data":    evaluation,
@@ -1346,17 +1925,76 @@ func HandleObjection(c *gin.Context) {
 		return
 	}
 
+	if handleData.TotalScore < 0 || handleData.TotalScore > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "总分必须在0到100之间",
+		})
+		return
+	}
+
+	// 并发检查：If-Match 与当前版本不一致时拒绝
+	expectedVersion, ok := checkIfMatch(c, evaluation.Version, &evaluation)
+	if !ok {
+		return
+	}
+
+	// 调整后的总分同样需要满足部门强制分布配额
+	distribution, err := checkEvaluationDistribution(&evaluation, handleData.TotalScore)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "检查强制分布失败",
+			"message": err.Error(),
+		})
+		return
+	}
+	if distribution.Blocked {
+		respondDistributionBlocked(c, distribution)
+		return
+	}
+
+	// HR调整的总分按满分合计换算回原始得分
+	var scores []models.KPIScore
+	models.DB.Where("evaluation_id = ?", evaluation.ID).Find(&scores)
+	rawScore := rawScoreForTotal(scores, handleData.TotalScore)
+
+	history := newHistoryRecorder(evaluation.ID, c.GetUint("user_id"), historySourceObjection)
+	history.change("has_objection", evaluation.HasObjection, false)
+	history.change("total_score", evaluation.TotalScore, handleData.TotalScore)
+	history.change("raw_score", evaluation.RawScore, rawScore)
+	history.change("final_comment", evaluation.FinalComment, handleData.FinalComment)
+
 	// 更新评估：处理异议，清除异议状态，更新最终得分和处理原因
-	result = models.DB.Model(&evaluation).Updates(map[string]interface{}{
-		"has_objection": false,
-		"total_score":   handleData.TotalScore,
-		"final_comment": handleData.FinalComment,
+	// 已完成的评估按调整后的总分重新确定绩效等级，与变更历史在同一事务中写入
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		result := whereVersion(tx.Model(&evaluation), expectedVersion).Updates(map[string]interface{}{
+			"has_objection": false,
+			"total_score":   handleData.TotalScore,
+			"raw_score":     rawScore,
+			"final_comment": handleData.FinalComment,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errVersionConflict
+		}
+		if evaluation.Status == "completed" {
+			evaluation.TotalScore = handleData.TotalScore
+			if err := assignEvaluationGrade(tx, &evaluation, history); err != nil {
+				return err
+			}
+		}
+		return history.save(tx)
 	})
-
-	if result.Error != nil {
+	if errors.Is(err, errVersionConflict) {
+		models.DB.First(&evaluation, evaluation.ID)
+		respondVersionConflict(c, evaluation.Version, &evaluation)
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "处理异议失败",
-			"message": result.Error.Error(),
+			"message": err.Error(),
 		})
 		return
 	}
@@ -1402,10 +2040,15 @@ func HandleObjection(c *gin.Context) {
 	// 发送通知给员工
 	GetNotificationService().SendNotification(evaluation.EmployeeID, EventObjectionHandled, &evaluation)
 
-	c.JSON(http.StatusOK, gin.H{
+	setVersionETag(c, evaluation.Version)
+	response := gin.H{
 		"message": "异议处理成功",
 		"data":    evaluation,
-	})
+	}
+	if len(distribution.Violations) > 0 {
+		response["distribution_warnings"] = distribution.Violations
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 const (
@@ -1425,11 +2068,17 @@ func formatScore(score float64) string {
 
 // createAutoComment 自动创建绩效评论
 func createAutoComment(evaluationID uint, userID uint, content string) error {
+	return createAutoCommentOnBehalf(evaluationID, userID, nil, content)
+}
+
+// createAutoCommentOnBehalf 创建自动评论，onBehalfOfID 不为空时表示代他人评审
+func createAutoCommentOnBehalf(evaluationID uint, userID uint, onBehalfOfID *uint, content string) error {
 	comment := models.EvaluationComment{
 		EvaluationID: evaluationID,
 		UserID:       userID,
 		Content:      content,
 		IsPrivate:    false,
+		OnBehalfOfID: onBehalfOfID,
 	}
 	return models.DB.Create(&comment).Error
 }
@@ -1464,6 +2113,67 @@ func areAllInvitationsCompleted(evaluationID uint) (bool, error) {
 	return completedInvitations == totalInvitations, nil
 }
 
+// tryAutoConfirmEvaluation 绩效规则启用且所有邀请都已完成时，自动计算HR评分并将评估推进到pending_confirm
+// 返回是否已自动推进
+func tryAutoConfirmEvaluation(evaluationID uint) bool {
+	// 检查评估是否有已启用的适用绩效规则
+	if rule, _, err := resolvePerformanceRuleForEvaluation(evaluationID); err != nil || rule == nil {
+		return false
+	}
+
+	// 审批链未完成时，保持manager_evaluated状态，等待审批完成
+	if approvalPending(evaluationID) {
+		return false
+	}
+
+	// 有未完成的邀请时，保持manager_evaluated状态，等待所有邀请完成
+	allCompleted, err := areAllInvitationsCompleted(evaluationID)
+	if err != nil || !allCompleted {
+		return false
+	}
+
+	// HR评分、强制分布检查和状态推进在同一事务中完成，配额不允许时不保留自动计算的HR评分
+	tx := models.DB.Begin()
+	if err := applyPerformanceRule(tx, evaluationID); err != nil {
+		tx.Rollback()
+		return false
+	}
+
+	// 硬性强制分布配额下超出时不自动推进，保持待HR审核由HR处理
+	var evaluation models.KPIEvaluation
+	if err := tx.First(&evaluation, evaluationID).Error; err != nil {
+		tx.Rollback()
+		return false
+	}
+	if distribution, err := checkEvaluationDistribution(&evaluation, evaluation.TotalScore); err != nil || distribution.Blocked {
+		tx.Rollback()
+		return false
+	}
+
+	// 只推进仍处于待HR审核的评估，避免并发操作期间状态已变化
+	result := tx.Model(&models.KPIEvaluation{}).Where("id = ? AND status = ?", evaluationID, "manager_evaluated").Update("status", "pending_confirm")
+	if result.Error != nil || result.RowsAffected == 0 {
+		tx.Rollback()
+		return false
+	}
+	if err := scheduleStageDeadline(tx, &evaluation, "pending_confirm", time.Now()); err != nil {
+		tx.Rollback()
+		return false
+	}
+
+	history := newHistoryRecorder(evaluationID, 0, historySourcePerformanceRule)
+	history.change("status", "manager_evaluated", "pending_confirm")
+	if err := history.save(tx); err != nil {
+		tx.Rollback()
+		return false
+	}
+	if err := tx.Commit().Error; err != nil {
+		return false
+	}
+
+	return true
+}
+
 type invitationAggregate struct {
 	Average float64
 	Count   int
@@ -1475,27 +2185,36 @@ type scoreComponent struct {
 	present bool
 }
 
-// applyPerformanceRuleForEvaluation 根据启用的绩效规则自动计算HR评分和总分
+// applyPerformanceRuleForEvaluation 根据评估适用的已启用绩效规则自动计算HR评分和总分
+// 规则按评估的模板和员工所在部门确定，见 resolvePerformanceRule
 func applyPerformanceRuleForEvaluation(evaluationID uint) error {
-	var rule models.PerformanceRule
-	if err := models.DB.First(&rule).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil
-		}
-		return err
-	}
+	return models.DB.Transaction(func(tx *gorm.DB) error {
+		return applyPerformanceRule(tx, evaluationID)
+	})
+}
 
-	if !rule.Enabled {
-		return nil
+// applyPerformanceRule 在事务中按绩效规则计算HR评分和总分，并记录采用的规则版本
+func applyPerformanceRule(tx *gorm.DB, evaluationID uint) error {
+	var evaluation models.KPIEvaluation
+	if err := tx.Preload("Employee").First(&evaluation, evaluationID).Error; err != nil {
+		return err
 	}
 
-	var evaluation models.KPIEvaluation
-	if err := models.DB.Preload("Employee").First(&evaluation, evaluationID).Error; err != nil {
+	appliedAt := time.Now()
+	rulePtr, version, err := resolveEffectivePerformanceRule(tx, evaluation.TemplateID, evaluation.Employee.DepartmentID, appliedAt)
+	if err != nil {
 		return err
 	}
+	if rulePtr == nil {
+		return nil
+	}
+	// 按生效版本的权重计算，规则上的权重可能是尚未生效的新配置
+	rule := *rulePtr
+	rule.NoInvitation = version.NoInvitation
+	rule.WithInvitation = version.WithInvitation
 
 	var scores []models.KPIScore
-	if err := models.DB.Where("evaluation_id = ?", evaluationID).Find(&scores).Error; err != nil {
+	if err := tx.Where("evaluation_id = ?", evaluationID).Find(&scores).Error; err != nil {
 		return err
 	}
 	if len(scores) == 0 {
@@ -1503,7 +2222,7 @@ func applyPerformanceRuleForEvaluation(evaluationID uint) error {
 	}
 
 	var invitations []models.EvaluationInvitation
-	if err := models.DB.
+	if err := tx.
 		Preload("Invitee").
 		Preload("Scores").
 		Where("evaluation_id = ? AND status = ?", evaluationID, "completed").
@@ -1513,20 +2232,15 @@ func applyPerformanceRuleForEvaluation(evaluationID uint) error {
 
 	scenario, relevantInvitations := determinePerformanceRuleScenario(invitations)
 	invitationAverages := buildInvitationAverages(relevantInvitations)
+	applied := newAppliedPerformanceRule(rule, *version, scenario, appliedAt)
 
-	tx := models.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
-	totalScore := 0.0
-	updatedCount := 0
+	hrScores := make(map[uint]float64, len(scores))
+	history := newHistoryRecorder(evaluationID, 0, historySourcePerformanceRule)
 
 	for _, score := range scores {
 		aggregate := invitationAverages[score.ItemID]
 		hrScore, ok := calculateHRScoreByScenario(score, aggregate, scenario, rule)
+		applied.Items = append(applied.Items, appliedRuleItemCalc(score, aggregate, hrScore, ok))
 		if !ok {
 			continue
 		}
@@ -1535,23 +2249,51 @@ func applyPerformanceRuleForEvaluation(evaluationID uint) error {
 		if strings.TrimSpace(comment) == "" {
 			comment = autoHRScoreComment
 		}
+		history.scoreChange(&score, "hr_score", score.HRScore, hrScore)
+		history.scoreChange(&score, "hr_comment", score.HRComment, comment)
 
 		if err := tx.Model(&models.KPIScore{}).Where("id = ?", score.ID).Updates(map[string]interface{}{
 			"hr_score":   hrScore,
 			"hr_comment": comment,
 		}).Error; err != nil {
-			tx.Rollback()
 			return err
 		}
 
-		totalScore += hrScore
-		updatedCount++
+		hrScores[score.ID] = hrScore
 	}
 
-	if updatedCount > 0 {
-		totalScore = math.Round(totalScore*100) / 100
-		if err := tx.Model(&models.KPIEvaluation{}).Where("id = ?", evaluationID).Update("total_score", totalScore).Error; err != nil {
-			tx.Rollback()
+	if len(hrScores) > 0 {
+		// 按计分方式以HR评分计算总分，未能计算HR评分的项目按量化指标自动得分计，没有自动得分的按0分计
+		totalScore, rawScore := calculateTotalScore(evaluation.ScoringMode, scores, func(score *models.KPIScore) float64 {
+			if hrScore, ok := hrScores[score.ID]; ok {
+				return hrScore
+			}
+			if score.AutoScore != nil {
+				return *score.AutoScore
+			}
+			return 0
+		})
+		if err := tx.Model(&models.KPIEvaluation{}).Where("id = ?", evaluationID).Updates(map[string]interface{}{
+			"total_score": totalScore,
+			"raw_score":   rawScore,
+		}).Error; err != nil {
+			return err
+		}
+		// 记录采用的规则版本及计算依据，之后修改规则不影响已计算的评估
+		if err := tx.Model(&models.KPIEvaluation{}).Where("id = ?", evaluationID).
+			Select("performance_rule_version_id", "applied_rule").
+			Updates(&models.KPIEvaluation{PerformanceRuleVersionID: &version.ID, AppliedRule: applied}).Error; err != nil {
+			return err
+		}
+
+		previousRule := ""
+		if evaluation.AppliedRule != nil {
+			previousRule = appliedPerformanceRuleLabel(evaluation.AppliedRule)
+		}
+		history.change("performance_rule", previousRule, appliedPerformanceRuleLabel(applied))
+		history.change("total_score", evaluation.TotalScore, totalScore)
+		history.change("raw_score", evaluation.RawScore, rawScore)
+		if err := history.save(tx); err != nil {
 			return err
 		}
 
@@ -1569,7 +2311,53 @@ func applyPerformanceRuleForEvaluation(evaluationID uint) error {
 		}
 	}
 
-	return tx.Commit().Error
+	return nil
+}
+
+// newAppliedPerformanceRule 生成评估采用的绩效规则快照（不含考核项目明细）
+func newAppliedPerformanceRule(rule models.PerformanceRule, version models.PerformanceRuleVersion, scenario string, appliedAt time.Time) *models.AppliedPerformanceRule {
+	applied := &models.AppliedPerformanceRule{
+		RuleID:        rule.ID,
+		RuleName:      rule.Name,
+		VersionID:     version.ID,
+		Version:       version.Version,
+		EffectiveFrom: version.EffectiveFrom,
+		Scenario:      scenario,
+		AppliedAt:     appliedAt,
+	}
+	if scenario == performanceScenarioEmployeeInvitation {
+		applied.SelfWeight = version.WithInvitation.Employee.SelfWeight
+		applied.InviteWeight = version.WithInvitation.Employee.InviteSuperiorWeight
+		applied.SuperiorWeight = version.WithInvitation.Employee.SuperiorWeight
+	} else {
+		applied.SelfWeight = version.NoInvitation.SelfWeight
+		applied.SuperiorWeight = version.NoInvitation.SuperiorWeight
+	}
+	return applied
+}
+
+// appliedRuleItemCalc 记录单个考核项目参与计算的各项评分及计算结果
+func appliedRuleItemCalc(score models.KPIScore, aggregate invitationAggregate, hrScore float64, ok bool) models.AppliedRuleItemCalc {
+	item := models.AppliedRuleItemCalc{
+		ScoreID:      score.ID,
+		ItemName:     score.ItemName,
+		SelfScore:    score.SelfScore,
+		ManagerScore: score.ManagerScore,
+		InviteCount:  aggregate.Count,
+	}
+	if aggregate.Count > 0 {
+		average := aggregate.Average
+		item.InviteScore = &average
+	}
+	if ok {
+		item.HRScore = &hrScore
+	}
+	return item
+}
+
+// appliedPerformanceRuleLabel 规则快照在评估历史中的显示，例如“默认规则 v2”
+func appliedPerformanceRuleLabel(applied *models.AppliedPerformanceRule) string {
+	return fmt.Sprintf("%s v%d", applied.RuleName, applied.Version)
 }
 
 // determinePerformanceRuleScenario 根据邀请情况确定使用的绩效规则场景
@@ -15,6 +15,10 @@ const (
 	EventEvaluationDeleted      = "evaluation_deleted"
 	EventEvaluationStatusChange = "evaluation_status_changed"
 
+	// 截止提醒及升级事件
+	EventEvaluationDeadlineReminder = "evaluation_deadline_reminder"
+	EventEvaluationEscalated        = "evaluation_escalated"
+
 	// 邀请评分相关事件
 	EventInvitationCreated      = "invitation_created"
 	EventInvitationUpdated      = "invitation_updated"
@@ -30,6 +34,9 @@ const (
 	// 异议相关事件
 	EventObjectionSubmitted = "objection_submitted" // 员工提交异议
 	EventObjectionHandled   = "objection_handled"   // HR处理异议
+
+	// 审批链事件
+	EventApprovalStepPending = "approval_step_pending" // 审批步骤待处理
 )
 
 // 通知服务
@@ -78,15 +85,51 @@ func (n *NotificationService) GetRelatedUsers(eventType string, data interface{}
 		// 被评估员工
 		relatedUsers = append(relatedUsers, evaluation.EmployeeID)
 
-		// 被评估员工的主管
+		// 被评估员工的主管，以及主管当前的评审受托人
 		if evaluation.Employee.ManagerID != nil {
 			relatedUsers = append(relatedUsers, *evaluation.Employee.ManagerID)
+			for _, delegate := range activeDelegatesOf(*evaluation.Employee.ManagerID, time.Now()) {
+				relatedUsers = append(relatedUsers, delegate.ID)
+			}
 		}
 
 		// 所有HR用户
 		hrUsers := n.GetAllHRUsers()
 		relatedUsers = append(relatedUsers, hrUsers...)
 
+	case EventEvaluationDeadlineReminder:
+		evaluation := data.(*models.KPIEvaluation)
+		models.DB.Preload("Employee").First(&evaluation, evaluation.ID)
+
+		// 当前阶段负责人
+		relatedUsers = append(relatedUsers, evaluationStageRecipients(evaluation)...)
+
+	case EventEvaluationEscalated:
+		evaluation := data.(*models.KPIEvaluation)
+		models.DB.Preload("Employee").First(&evaluation, evaluation.ID)
+
+		// 最近一次升级的接收人
+		var escalation models.EvaluationEscalation
+		if models.DB.Where("evaluation_id = ?", evaluation.ID).Order("id DESC").First(&escalation).Error == nil {
+			relatedUsers = append(relatedUsers, escalation.EscalatedToID)
+		}
+
+		// 被评估员工的主管
+		if evaluation.Employee.ManagerID != nil {
+			relatedUsers = append(relatedUsers, *evaluation.Employee.ManagerID)
+		}
+
+	case EventApprovalStepPending:
+		step := data.(*models.EvaluationApproval)
+
+		// 审批人及其当前的评审受托人
+		for _, approverID := range step.ApproverIDs {
+			relatedUsers = append(relatedUsers, approverID)
+			for _, delegate := range activeDelegatesOf(approverID, time.Now()) {
+				relatedUsers = append(relatedUsers, delegate.ID)
+			}
+		}
+
 	case EventInvitationCreated, EventInvitationUpdated, EventInvitationDeleted, EventInvitationStatusChange:
 		invitation := data.(*models.EvaluationInvitation)
 
@@ -166,10 +209,18 @@ func (n *NotificationService) GetUserInfo(userID uint) (*models.Employee, error)
 	return &user, nil
 }
 
+// 获取操作者信息，operatorID 为0表示系统自动操作（如定时任务）
+func (n *NotificationService) GetOperatorInfo(operatorID uint) (*models.Employee, error) {
+	if operatorID == 0 {
+		return &models.Employee{Name: "系统"}, nil
+	}
+	return n.GetUserInfo(operatorID)
+}
+
 // 个性化消息生成
 func (n *NotificationService) PersonalizeMessage(userID uint, operatorID uint, eventType string, data interface{}) string {
 	// 获取操作者信息
-	operator, err := n.GetUserInfo(operatorID)
+	operator, err := n.GetOperatorInfo(operatorID)
 	if err != nil {
 		return "系统通知"
 	}
@@ -225,6 +276,36 @@ func (n *NotificationService) PersonalizeMessage(userID uint, operatorID uint, e
 			return fmt.Sprintf("员工 %s 的绩效评估状态已更新为：%s", evaluation.Employee.Name, statusText)
 		}
 
+	case EventEvaluationDeadlineReminder:
+		evaluation := data.(*models.KPIEvaluation)
+		models.DB.Preload("Employee").Preload("Template").First(&evaluation, evaluation.ID)
+
+		deadline := evaluationStageDeadline(evaluation)
+		if deadline == nil {
+			return "系统通知"
+		}
+		statusText := n.getStatusText(evaluation.Status)
+		if time.Now().After(*deadline) {
+			return fmt.Sprintf("员工 %s 的绩效评估（%s）已于 %s 逾期", evaluation.Employee.Name, statusText, deadline.Format("2006-01-02 15:04"))
+		}
+		return fmt.Sprintf("员工 %s 的绩效评估（%s）将于 %s 到期", evaluation.Employee.Name, statusText, deadline.Format("2006-01-02 15:04"))
+
+	case EventEvaluationEscalated:
+		evaluation := data.(*models.KPIEvaluation)
+		models.DB.Preload("Employee").Preload("Template").First(&evaluation, evaluation.ID)
+
+		if evaluation.Employee.ManagerID != nil && userID == *evaluation.Employee.ManagerID {
+			return fmt.Sprintf("您的下属 %s 的绩效评估主管评分已超时，已升级给您的上级", evaluation.Employee.Name)
+		}
+		return fmt.Sprintf("员工 %s 的绩效评估主管评分已超时，已升级给您", evaluation.Employee.Name)
+
+	case EventApprovalStepPending:
+		step := data.(*models.EvaluationApproval)
+		var evaluation models.KPIEvaluation
+		models.DB.Preload("Employee").First(&evaluation, step.EvaluationID)
+
+		return fmt.Sprintf("员工 %s 的绩效评估待您处理：%s", evaluation.Employee.Name, approvalStepLabel(step))
+
 	case EventInvitationCreated:
 		invitation := data.(*models.EvaluationInvitation)
 		models.DB.Preload("Evaluation.Employee").Preload("Evaluation.Template").First(&invitation, invitation.ID)
@@ -277,6 +358,10 @@ func (n *NotificationService) PersonalizeMessage(userID uint, operatorID uint, e
 // 获取状态文本
 func (n *NotificationService) getStatusText(status string) string {
 	switch status {
+	case "goal_setting":
+		return "目标设定中"
+	case "goal_review":
+		return "目标待确认"
 	case "pending":
 		return "待自评"
 	case "self_evaluated":
@@ -312,6 +397,11 @@ func (n *NotificationService) getInvitationStatusText(status string) string {
 
 // 发送通知
 func (n *NotificationService) SendNotification(operatorID uint, eventType string, data interface{}) {
+	n.SendNotificationOnBehalf(operatorID, nil, eventType, data)
+}
+
+// 代他人操作时发送通知，操作者显示为“X（代 Y）”，onBehalfOfID 为空时与 SendNotification 相同
+func (n *NotificationService) SendNotificationOnBehalf(operatorID uint, onBehalfOfID *uint, eventType string, data interface{}) {
 	// 获取相关用户
 	relatedUsers := n.GetRelatedUsers(eventType, data)
 
@@ -324,7 +414,7 @@ func (n *NotificationService) SendNotification(operatorID uint, eventType string
 	}
 
 	// 获取操作者信息
-	operator, err := n.GetUserInfo(operatorID)
+	operator, err := n.GetOperatorInfo(operatorID)
 	if err != nil {
 		fmt.Printf("获取操作者信息失败: %v\n", err)
 		return
@@ -341,7 +431,7 @@ func (n *NotificationService) SendNotification(operatorID uint, eventType string
 				ID:           n.getDataID(data),
 				EmployeeID:   n.getEmployeeID(data),
 				OperatorID:   operatorID,
-				OperatorName: operator.Name,
+				OperatorName: onBehalfOfText(operator.Name, onBehalfOfID),
 				Message:      message,
 				Timestamp:    time.Now().Format(time.RFC3339),
 				Payload:      data,
@@ -366,6 +456,8 @@ func (n *NotificationService) getDataID(data interface{}) uint {
 		return v.ID
 	case *models.KPIScore:
 		return v.ID
+	case *models.EvaluationApproval:
+		return v.ID
 	default:
 		return 0
 	}
@@ -385,6 +477,10 @@ func (n *NotificationService) getEmployeeID(data interface{}) uint {
 	case *models.KPIScore:
 		models.DB.Preload("Evaluation").First(&v, v.ID)
 		return v.Evaluation.EmployeeID
+	case *models.EvaluationApproval:
+		var evaluation models.KPIEvaluation
+		models.DB.First(&evaluation, v.EvaluationID)
+		return evaluation.EmployeeID
 	default:
 		return 0
 	}
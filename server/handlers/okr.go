@@ -0,0 +1,787 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"dootask-kpi-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// OKR归属类型
+const (
+	okrOwnerEmployee   = "employee"   // 员工个人目标
+	okrOwnerDepartment = "department" // 部门目标
+)
+
+// 关键结果信心指数范围（0-10），未填写时默认为5
+const (
+	maxKeyResultConfidence     = 10
+	defaultKeyResultConfidence = 5
+)
+
+// 关键结果请求结构
+type KeyResultRequest struct {
+	Title        string  `json:"title" binding:"required"`
+	StartValue   float64 `json:"start_value"`
+	TargetValue  float64 `json:"target_value"`
+	Unit         string  `json:"unit"`
+	Confidence   *int    `json:"confidence"`
+	LinkedItemID *uint   `json:"linked_item_id"` // 可选，关联的量化考核项目
+	Order        int     `json:"order"`
+}
+
+// OKR目标创建请求结构
+type CreateObjectiveRequest struct {
+	Title        string             `json:"title" binding:"required"`
+	Description  string             `json:"description"`
+	OwnerType    string             `json:"owner_type" binding:"required,oneof=employee department"`
+	EmployeeID   *uint              `json:"employee_id"`   // 员工目标的归属员工，默认为当前用户
+	DepartmentID *uint              `json:"department_id"` // 部门目标的归属部门
+	Period       string             `json:"period" binding:"required,oneof=monthly quarterly yearly"`
+	Year         int                `json:"year" binding:"required"`
+	Month        *int               `json:"month"`
+	Quarter      *int               `json:"quarter"`
+	KeyResults   []KeyResultRequest `json:"key_results" binding:"dive"`
+}
+
+// OKR目标更新请求结构（归属不可修改）
+type UpdateObjectiveRequest struct {
+	Title       string `json:"title" binding:"required"`
+	Description string `json:"description"`
+	Period      string `json:"period" binding:"required,oneof=monthly quarterly yearly"`
+	Year        int    `json:"year" binding:"required"`
+	Month       *int   `json:"month"`
+	Quarter     *int   `json:"quarter"`
+}
+
+// 关键结果进展更新请求结构
+type KeyResultCheckInRequest struct {
+	Value      *float64 `json:"value" binding:"required"` // 最新的当前值
+	Confidence *int     `json:"confidence"`               // 未填写时沿用上次的信心指数
+	Note       string   `json:"note"`
+}
+
+// keyResultProgress 计算关键结果的完成率，目标值小于起始值时表示需要降低的指标
+func keyResultProgress(kr *models.KeyResult) float64 {
+	if kr.TargetValue == kr.StartValue {
+		return 0
+	}
+	progress := (kr.CurrentValue - kr.StartValue) / (kr.TargetValue - kr.StartValue) * 100
+	return math.Round(math.Max(progress, 0)*100) / 100
+}
+
+// refreshObjectiveProgress 按各关键结果完成率的平均值更新目标的完成率
+func refreshObjectiveProgress(tx *gorm.DB, objectiveID uint) error {
+	var progresses []float64
+	if err := tx.Model(&models.KeyResult{}).Where("objective_id = ?", objectiveID).Pluck("progress", &progresses).Error; err != nil {
+		return err
+	}
+	var progress float64
+	for _, p := range progresses {
+		progress += p
+	}
+	if len(progresses) > 0 {
+		progress = math.Round(progress/float64(len(progresses))*100) / 100
+	}
+	return tx.Model(&models.Objective{}).Where("id = ?", objectiveID).Update("progress", progress).Error
+}
+
+// validateConfidence 校验信心指数，未填写时返回默认值
+func validateConfidence(confidence *int, fallback int) (int, error) {
+	if confidence == nil {
+		return fallback, nil
+	}
+	if *confidence < 0 || *confidence > maxKeyResultConfidence {
+		return 0, fmt.Errorf("信心指数必须在 0 到 %d 之间", maxKeyResultConfidence)
+	}
+	return *confidence, nil
+}
+
+// buildKeyResult 校验关键结果请求并生成关键结果，当前值从起始值开始
+// 关联的考核项目必须是量化指标，创建评估时按完成率换算为该项目的实际完成值
+func buildKeyResult(req *KeyResultRequest) (models.KeyResult, error) {
+	if req.TargetValue == req.StartValue {
+		return models.KeyResult{}, fmt.Errorf("关键结果「%s」的目标值不能等于起始值", req.Title)
+	}
+	confidence, err := validateConfidence(req.Confidence, defaultKeyResultConfidence)
+	if err != nil {
+		return models.KeyResult{}, err
+	}
+	if req.LinkedItemID != nil {
+		var item models.KPIItem
+		if err := models.DB.First(&item, *req.LinkedItemID).Error; err != nil {
+			return models.KeyResult{}, fmt.Errorf("关键结果「%s」关联的考核项目不存在", req.Title)
+		}
+		if itemScoreType(&item) != scoreTypeQuantitative {
+			return models.KeyResult{}, fmt.Errorf("关键结果「%s」只能关联量化指标类型的考核项目", req.Title)
+		}
+	}
+	return models.KeyResult{
+		Title:        req.Title,
+		StartValue:   req.StartValue,
+		TargetValue:  req.TargetValue,
+		CurrentValue: req.StartValue,
+		Unit:         req.Unit,
+		Confidence:   confidence,
+		LinkedItemID: req.LinkedItemID,
+		Order:        req.Order,
+	}, nil
+}
+
+// canManageObjective 用户是否可以维护该目标：HR、员工本人及其直属上级、部门目标所在部门的主管
+func canManageObjective(objective *models.Objective, user *models.Employee) bool {
+	if user.Role == "hr" {
+		return true
+	}
+	switch objective.OwnerType {
+	case okrOwnerEmployee:
+		if objective.EmployeeID == nil {
+			return false
+		}
+		if *objective.EmployeeID == user.ID {
+			return true
+		}
+		var owner models.Employee
+		if err := models.DB.First(&owner, *objective.EmployeeID).Error; err != nil {
+			return false
+		}
+		return owner.ManagerID != nil && *owner.ManagerID == user.ID
+	case okrOwnerDepartment:
+		return objective.DepartmentID != nil && user.Role == "manager" && user.DepartmentID == *objective.DepartmentID
+	default:
+		return false
+	}
+}
+
+// visibleObjectives 限定用户可查看的目标：HR查看全部，其他用户查看本人、直属下级和本部门的目标
+func visibleObjectives(query *gorm.DB, user *models.Employee) *gorm.DB {
+	if user.Role == "hr" {
+		return query
+	}
+	return query.Where("(owner_type = ? AND (employee_id = ? OR employee_id IN (SELECT id FROM employees WHERE manager_id = ?))) OR (owner_type = ? AND department_id = ?)",
+		okrOwnerEmployee, user.ID, user.ID, okrOwnerDepartment, user.DepartmentID)
+}
+
+// overlappingObjectives 限定与考核周期重叠的目标：年度目标与该年内所有周期重叠，季度目标与该季度内的月份重叠
+func overlappingObjectives(query *gorm.DB, period string, year int, month *int, quarter *int) *gorm.DB {
+	query = query.Where("objectives.year = ?", year)
+	switch period {
+	case "monthly":
+		return query.Where("objectives.period = ? OR (objectives.period = ? AND objectives.quarter = ?) OR (objectives.period = ? AND objectives.month = ?)",
+			"yearly", "quarterly", (periodPart(month)+2)/3, "monthly", periodPart(month))
+	case "quarterly":
+		return query.Where("objectives.period = ? OR (objectives.period = ? AND objectives.quarter = ?) OR (objectives.period = ? AND (objectives.month + 2) / 3 = ?)",
+			"yearly", "quarterly", periodPart(quarter), "monthly", periodPart(quarter))
+	default:
+		return query
+	}
+}
+
+// evaluationObjectives 获取与评估周期重叠的员工个人目标和员工所在部门的目标（员工目标在前）
+// query 中可预加载关键结果等关联数据
+func evaluationObjectives(query *gorm.DB, evaluation *models.KPIEvaluation) ([]models.Objective, error) {
+	query = query.Where("(owner_type = ? AND employee_id = ?) OR (owner_type = ? AND department_id = (SELECT department_id FROM employees WHERE id = ?))",
+		okrOwnerEmployee, evaluation.EmployeeID, okrOwnerDepartment, evaluation.EmployeeID)
+	query = overlappingObjectives(query, evaluation.Period, evaluation.Year, evaluation.Month, evaluation.Quarter)
+
+	var objectives []models.Objective
+	err := query.Order("owner_type DESC, id").Find(&objectives).Error
+	return objectives, err
+}
+
+// keyResultFeeds 汇总与评估周期重叠、关联了考核项目的关键结果，返回各考核项目的平均完成率
+func keyResultFeeds(db *gorm.DB, evaluation *models.KPIEvaluation) (map[uint]float64, error) {
+	objectives, err := evaluationObjectives(db.Preload("KeyResults"), evaluation)
+	if err != nil {
+		return nil, err
+	}
+
+	sums := make(map[uint]float64)
+	counts := make(map[uint]int)
+	for _, objective := range objectives {
+		for _, kr := range objective.KeyResults {
+			if kr.LinkedItemID == nil {
+				continue
+			}
+			sums[*kr.LinkedItemID] += kr.Progress
+			counts[*kr.LinkedItemID]++
+		}
+	}
+
+	feeds := make(map[uint]float64, len(sums))
+	for itemID, sum := range sums {
+		feeds[itemID] = sum / float64(counts[itemID])
+	}
+	return feeds, nil
+}
+
+// applyKeyResultFeed 将关键结果的完成率换算为量化指标的实际完成值（完成率 × 目标值），并自动计算得分
+func applyKeyResultFeed(score *models.KPIScore, item *models.KPIItem, progress float64) {
+	if itemScoreType(item) != scoreTypeQuantitative {
+		return
+	}
+	actual := math.Round(progress*item.TargetValue) / 100
+	autoScore := quantitativeScore(item, actual)
+	score.ActualValue = &actual
+	score.AutoScore = &autoScore
+}
+
+// loadObjective 解析路径中的目标ID并加载目标，失败时已返回错误响应
+func loadObjective(c *gin.Context, objective *models.Objective) bool {
+	objectiveID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的目标ID",
+		})
+		return false
+	}
+	if err := models.DB.First(objective, objectiveID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "目标不存在",
+		})
+		return false
+	}
+	return true
+}
+
+// loadOKROperator 加载当前用户，并检查是否可以维护该目标，失败时已返回错误响应
+func loadOKROperator(c *gin.Context, objective *models.Objective) (*models.Employee, bool) {
+	var operator models.Employee
+	if err := models.DB.First(&operator, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "用户不存在",
+		})
+		return nil, false
+	}
+	if !canManageObjective(objective, &operator) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "无权维护该目标",
+		})
+		return nil, false
+	}
+	return &operator, true
+}
+
+// loadKeyResult 解析路径中的关键结果ID并加载关键结果及所属目标，失败时已返回错误响应
+func loadKeyResult(c *gin.Context, kr *models.KeyResult, objective *models.Objective) bool {
+	krID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的关键结果ID",
+		})
+		return false
+	}
+	if err := models.DB.First(kr, krID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "关键结果不存在",
+		})
+		return false
+	}
+	if err := models.DB.First(objective, kr.ObjectiveID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "目标不存在",
+		})
+		return false
+	}
+	return true
+}
+
+// preloadObjectiveDetails 预加载目标的归属、关键结果及进展记录
+func preloadObjectiveDetails(query *gorm.DB) *gorm.DB {
+	return query.Preload("Employee").Preload("Department").Preload("CreatedBy").
+		Preload("KeyResults", func(db *gorm.DB) *gorm.DB {
+			return db.Order("`order`, id")
+		}).
+		Preload("KeyResults.LinkedItem").
+		Preload("KeyResults.CheckIns", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at DESC, id DESC")
+		}).
+		Preload("KeyResults.CheckIns.CreatedBy")
+}
+
+// 获取OKR目标列表：HR可以查看所有，其他用户查看本人、直属下级和本部门的目标
+func GetObjectives(c *gin.Context) {
+	var user models.Employee
+	if err := models.DB.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "用户不存在",
+		})
+		return
+	}
+
+	query := visibleObjectives(models.DB.Model(&models.Objective{}), &user)
+	if ownerType := c.Query("owner_type"); ownerType != "" {
+		query = query.Where("owner_type = ?", ownerType)
+	}
+	if employeeID := c.Query("employee_id"); employeeID != "" {
+		query = query.Where("employee_id = ?", employeeID)
+	}
+	if departmentID := c.Query("department_id"); departmentID != "" {
+		query = query.Where("department_id = ?", departmentID)
+	}
+	// 指定考核周期时返回与该周期重叠的目标
+	if period := c.Query("period"); period != "" {
+		year, _ := strconv.Atoi(c.Query("year"))
+		var month, quarter *int
+		if value, err := strconv.Atoi(c.Query("month")); err == nil {
+			month = &value
+		}
+		if value, err := strconv.Atoi(c.Query("quarter")); err == nil {
+			quarter = &value
+		}
+		month, quarter, err := normalizeEvaluationPeriod(period, year, month, quarter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		query = overlappingObjectives(query, period, year, month, quarter)
+	} else if year := c.Query("year"); year != "" {
+		query = query.Where("year = ?", year)
+	}
+
+	var objectives []models.Objective
+	if err := preloadObjectiveDetails(query).Order("year DESC, id DESC").Find(&objectives).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取目标列表失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  objectives,
+		"total": len(objectives),
+	})
+}
+
+// 获取OKR目标详情
+func GetObjective(c *gin.Context) {
+	var user models.Employee
+	if err := models.DB.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "用户不存在",
+		})
+		return
+	}
+
+	var objective models.Objective
+	if err := preloadObjectiveDetails(visibleObjectives(models.DB, &user)).First(&objective, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "目标不存在",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": objective,
+	})
+}
+
+// 创建OKR目标：员工为自己创建，主管可以为直属下级和本部门创建，HR可以为任意员工或部门创建
+func CreateObjective(c *gin.Context) {
+	var req CreateObjectiveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	month, quarter, err := normalizeEvaluationPeriod(req.Period, req.Year, req.Month, req.Quarter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	objective := models.Objective{
+		Title:       req.Title,
+		Description: req.Description,
+		OwnerType:   req.OwnerType,
+		Period:      req.Period,
+		Year:        req.Year,
+		Month:       month,
+		Quarter:     quarter,
+		CreatedByID: c.GetUint("user_id"),
+	}
+	if req.OwnerType == okrOwnerEmployee {
+		employeeID := c.GetUint("user_id")
+		if req.EmployeeID != nil {
+			employeeID = *req.EmployeeID
+		}
+		var employee models.Employee
+		if err := models.DB.First(&employee, employeeID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "员工不存在",
+			})
+			return
+		}
+		objective.EmployeeID = &employee.ID
+	} else {
+		if req.DepartmentID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "部门目标需要指定部门",
+			})
+			return
+		}
+		var department models.Department
+		if err := models.DB.First(&department, *req.DepartmentID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "部门不存在",
+			})
+			return
+		}
+		objective.DepartmentID = &department.ID
+	}
+
+	if _, ok := loadOKROperator(c, &objective); !ok {
+		return
+	}
+
+	for i := range req.KeyResults {
+		kr, err := buildKeyResult(&req.KeyResults[i])
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		objective.KeyResults = append(objective.KeyResults, kr)
+	}
+
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&objective).Error; err != nil {
+			return err
+		}
+		return refreshObjectiveProgress(tx, objective.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "创建目标失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	preloadObjectiveDetails(models.DB).First(&objective, objective.ID)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "目标创建成功",
+		"data":    objective,
+	})
+}
+
+// 更新OKR目标的标题、说明和周期
+func UpdateObjective(c *gin.Context) {
+	var objective models.Objective
+	if !loadObjective(c, &objective) {
+		return
+	}
+	if _, ok := loadOKROperator(c, &objective); !ok {
+		return
+	}
+
+	var req UpdateObjectiveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+	month, quarter, err := normalizeEvaluationPeriod(req.Period, req.Year, req.Month, req.Quarter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := models.DB.Model(&objective).Select("title", "description", "period", "year", "month", "quarter").Updates(&models.Objective{
+		Title:       req.Title,
+		Description: req.Description,
+		Period:      req.Period,
+		Year:        req.Year,
+		Month:       month,
+		Quarter:     quarter,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "更新目标失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	preloadObjectiveDetails(models.DB).First(&objective, objective.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "目标更新成功",
+		"data":    objective,
+	})
+}
+
+// 删除OKR目标及其关键结果和进展记录
+func DeleteObjective(c *gin.Context) {
+	var objective models.Objective
+	if !loadObjective(c, &objective) {
+		return
+	}
+	if _, ok := loadOKROperator(c, &objective); !ok {
+		return
+	}
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("key_result_id IN (SELECT id FROM key_results WHERE objective_id = ?)", objective.ID).Delete(&models.KeyResultCheckIn{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("objective_id = ?", objective.ID).Delete(&models.KeyResult{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&objective).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "删除目标失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "目标删除成功",
+	})
+}
+
+// 为OKR目标添加关键结果
+func CreateKeyResult(c *gin.Context) {
+	var objective models.Objective
+	if !loadObjective(c, &objective) {
+		return
+	}
+	if _, ok := loadOKROperator(c, &objective); !ok {
+		return
+	}
+
+	var req KeyResultRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+	kr, err := buildKeyResult(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	kr.ObjectiveID = objective.ID
+
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&kr).Error; err != nil {
+			return err
+		}
+		return refreshObjectiveProgress(tx, objective.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "添加关键结果失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "关键结果添加成功",
+		"data":    kr,
+	})
+}
+
+// 更新关键结果的定义（当前值通过进展更新修改）
+func UpdateKeyResult(c *gin.Context) {
+	var kr models.KeyResult
+	var objective models.Objective
+	if !loadKeyResult(c, &kr, &objective) {
+		return
+	}
+	if _, ok := loadOKROperator(c, &objective); !ok {
+		return
+	}
+
+	var req KeyResultRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+	if req.Confidence == nil {
+		req.Confidence = &kr.Confidence
+	}
+	updated, err := buildKeyResult(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	updated.CurrentValue = kr.CurrentValue
+	updated.Progress = keyResultProgress(&updated)
+
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&kr).Select("title", "start_value", "target_value", "unit", "progress", "confidence", "linked_item_id", "order").Updates(&updated).Error; err != nil {
+			return err
+		}
+		return refreshObjectiveProgress(tx, objective.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "更新关键结果失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	models.DB.First(&kr, kr.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "关键结果更新成功",
+		"data":    kr,
+	})
+}
+
+// 删除关键结果及其进展记录
+func DeleteKeyResult(c *gin.Context) {
+	var kr models.KeyResult
+	var objective models.Objective
+	if !loadKeyResult(c, &kr, &objective) {
+		return
+	}
+	if _, ok := loadOKROperator(c, &objective); !ok {
+		return
+	}
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("key_result_id = ?", kr.ID).Delete(&models.KeyResultCheckIn{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&kr).Error; err != nil {
+			return err
+		}
+		return refreshObjectiveProgress(tx, objective.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "删除关键结果失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "关键结果删除成功",
+	})
+}
+
+// 更新关键结果进展：记录当前值和信心指数，并重新计算关键结果和目标的完成率
+func CreateKeyResultCheckIn(c *gin.Context) {
+	var kr models.KeyResult
+	var objective models.Objective
+	if !loadKeyResult(c, &kr, &objective) {
+		return
+	}
+	operator, ok := loadOKROperator(c, &objective)
+	if !ok {
+		return
+	}
+
+	var req KeyResultCheckInRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+	confidence, err := validateConfidence(req.Confidence, kr.Confidence)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	kr.CurrentValue = *req.Value
+	kr.Confidence = confidence
+	kr.Progress = keyResultProgress(&kr)
+	checkIn := models.KeyResultCheckIn{
+		KeyResultID: kr.ID,
+		Value:       kr.CurrentValue,
+		Progress:    kr.Progress,
+		Confidence:  confidence,
+		Note:        req.Note,
+		CreatedByID: operator.ID,
+	}
+
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&checkIn).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&kr).Select("current_value", "confidence", "progress").Updates(&kr).Error; err != nil {
+			return err
+		}
+		return refreshObjectiveProgress(tx, objective.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "更新进展失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "进展更新成功",
+		"data": gin.H{
+			"check_in":   checkIn,
+			"key_result": kr,
+		},
+	})
+}
+
+// 获取与评估周期重叠的OKR目标（员工个人目标和所在部门目标），供评分时参考
+func GetEvaluationObjectives(c *gin.Context) {
+	var evaluation models.KPIEvaluation
+	if err := models.DB.First(&evaluation, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "评估不存在",
+		})
+		return
+	}
+
+	objectives, err := evaluationObjectives(preloadObjectiveDetails(models.DB), &evaluation)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取目标失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  objectives,
+		"total": len(objectives),
+	})
+}
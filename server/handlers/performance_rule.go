@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"dootask-kpi-server/models"
 
@@ -16,18 +19,150 @@ const weightTolerance = 0.0001
 
 // PerformanceRulePayload 绩效规则请求结构
 type PerformanceRulePayload struct {
+	Name           string                             `json:"name"`
+	TemplateID     *uint                              `json:"template_id"`   // 为空表示适用所有模板
+	DepartmentID   *uint                              `json:"department_id"` // 为空表示适用所有部门
 	NoInvitation   models.PerformanceRuleNoInvitation `json:"no_invitation" binding:"required"`
 	WithInvitation models.PerformanceRuleWithInvite   `json:"with_invitation" binding:"required"`
 	Enabled        bool                               `json:"enabled"`
+	EffectiveFrom  *time.Time                         `json:"effective_from"` // 权重变更的生效时间，为空表示立即生效
 }
 
-// GetPerformanceRule 获取绩效评分规则
+// defaultPerformanceRuleScope 组织默认规则：模板和部门都为空
+func defaultPerformanceRuleScope(db *gorm.DB) *gorm.DB {
+	return db.Where("template_id IS NULL AND department_id IS NULL")
+}
+
+// loadDefaultPerformanceRule 获取组织默认规则，不存在时返回默认配置（未保存）
+func loadDefaultPerformanceRule() (models.PerformanceRule, error) {
+	var rule models.PerformanceRule
+	result := defaultPerformanceRuleScope(models.DB).First(&rule)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return models.DefaultPerformanceRule(), nil
+	}
+	return rule, result.Error
+}
+
+// resolvePerformanceRule 返回指定时间适用于模板和部门的已启用规则：模板和部门都匹配的优先，其次为模板、部门，最后为组织默认规则
+// 尚无已生效版本的规则不参与匹配；没有已启用的适用规则时返回 nil
+func resolvePerformanceRule(db *gorm.DB, templateID uint, departmentID uint, at time.Time) (*models.PerformanceRule, error) {
+	var rules []models.PerformanceRule
+	if err := db.Where("enabled = ?", true).
+		Where("id IN (SELECT rule_id FROM performance_rule_versions WHERE effective_from <= ?)", at).
+		Where("template_id IS NULL OR template_id = ?", templateID).
+		Where("department_id IS NULL OR department_id = ?", departmentID).
+		Order("id").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	var best *models.PerformanceRule
+	bestRank := -1
+	for i := range rules {
+		rank := 0
+		if rules[i].TemplateID != nil {
+			rank += 2
+		}
+		if rules[i].DepartmentID != nil {
+			rank++
+		}
+		if rank > bestRank {
+			best, bestRank = &rules[i], rank
+		}
+	}
+	return best, nil
+}
+
+// resolvePerformanceRuleForEvaluation 返回评估当前适用的已启用规则及其生效版本，没有时都返回 nil
+func resolvePerformanceRuleForEvaluation(evaluationID uint) (*models.PerformanceRule, *models.PerformanceRuleVersion, error) {
+	var evaluation models.KPIEvaluation
+	if err := models.DB.Preload("Employee").First(&evaluation, evaluationID).Error; err != nil {
+		return nil, nil, err
+	}
+	return resolveEffectivePerformanceRule(models.DB, evaluation.TemplateID, evaluation.Employee.DepartmentID, time.Now())
+}
+
+// resolveEffectivePerformanceRule 返回指定时间适用的规则及其生效版本，没有时都返回 nil
+func resolveEffectivePerformanceRule(db *gorm.DB, templateID uint, departmentID uint, at time.Time) (*models.PerformanceRule, *models.PerformanceRuleVersion, error) {
+	rule, err := resolvePerformanceRule(db, templateID, departmentID, at)
+	if err != nil || rule == nil {
+		return nil, nil, err
+	}
+	version, err := effectivePerformanceRuleVersion(db, rule.ID, at)
+	if err != nil || version == nil {
+		return nil, nil, err
+	}
+	return rule, version, nil
+}
+
+// effectivePerformanceRuleVersion 返回规则在指定时间生效的版本（生效时间不晚于该时间的最新版本），没有时返回 nil
+func effectivePerformanceRuleVersion(db *gorm.DB, ruleID uint, at time.Time) (*models.PerformanceRuleVersion, error) {
+	var version models.PerformanceRuleVersion
+	err := db.Where("rule_id = ? AND effective_from <= ?", ruleID, at).
+		Order("effective_from DESC, version DESC").First(&version).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// savePerformanceRuleVersion 规则尚无版本或权重与最新版本不同时，按规则当前权重创建新版本；权重未变化时返回 nil
+func savePerformanceRuleVersion(tx *gorm.DB, rule *models.PerformanceRule, effectiveFrom time.Time, actorID uint) (*models.PerformanceRuleVersion, error) {
+	var latest models.PerformanceRuleVersion
+	err := tx.Where("rule_id = ?", rule.ID).Order("version DESC").First(&latest).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if err == nil && latest.NoInvitation == rule.NoInvitation && latest.WithInvitation == rule.WithInvitation {
+		return nil, nil
+	}
+
+	version := models.PerformanceRuleVersion{
+		RuleID:         rule.ID,
+		Version:        latest.Version + 1,
+		NoInvitation:   rule.NoInvitation,
+		WithInvitation: rule.WithInvitation,
+		EffectiveFrom:  effectiveFrom,
+	}
+	if actorID != 0 {
+		version.CreatedByID = &actorID
+	}
+	if err := tx.Create(&version).Error; err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// performanceRuleEffectiveFrom 返回权重变更的生效时间：为空时立即生效，不能早于当前时间（允许1分钟误差）
+func performanceRuleEffectiveFrom(payload PerformanceRulePayload) (time.Time, error) {
+	now := time.Now()
+	if payload.EffectiveFrom == nil {
+		return now, nil
+	}
+	if payload.EffectiveFrom.Before(now.Add(-time.Minute)) {
+		return now, fmt.Errorf("生效时间不能早于当前时间")
+	}
+	if payload.EffectiveFrom.Before(now) {
+		return now, nil
+	}
+	return *payload.EffectiveFrom, nil
+}
+
+// GetPerformanceRule 获取组织默认绩效评分规则，同时返回按模板和部门配置的规则
 func GetPerformanceRule(c *gin.Context) {
 	var rule models.PerformanceRule
-	result := models.DB.First(&rule)
+	result := defaultPerformanceRuleScope(models.DB).First(&rule)
 	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 		rule = models.DefaultPerformanceRule()
-		if err := models.DB.Create(&rule).Error; err != nil {
+		if err := models.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&rule).Error; err != nil {
+				return err
+			}
+			_, err := savePerformanceRuleVersion(tx, &rule, rule.CreatedAt, 0)
+			return err
+		}); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error":   "初始化绩效规则失败",
 				"message": err.Error(),
@@ -42,12 +177,23 @@ func GetPerformanceRule(c *gin.Context) {
 		return
 	}
 
+	var scoped []models.PerformanceRule
+	if err := models.DB.Preload("Template").Preload("Department").
+		Where("template_id IS NOT NULL OR department_id IS NOT NULL").Order("id").Find(&scoped).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取绩效规则失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"data": rule,
+		"data":  rule,
+		"rules": scoped,
 	})
 }
 
-// UpdatePerformanceRule 更新绩效评分规则
+// UpdatePerformanceRule 更新组织默认绩效评分规则
 func UpdatePerformanceRule(c *gin.Context) {
 	var payload PerformanceRulePayload
 	if err := c.ShouldBindJSON(&payload); err != nil {
@@ -64,24 +210,206 @@ func UpdatePerformanceRule(c *gin.Context) {
 		})
 		return
 	}
+	effectiveFrom, err := performanceRuleEffectiveFrom(payload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 
-	var rule models.PerformanceRule
-	result := models.DB.First(&rule)
-	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		rule = models.DefaultPerformanceRule()
-	} else if result.Error != nil {
+	rule, err := loadDefaultPerformanceRule()
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "获取绩效规则失败",
-			"message": result.Error.Error(),
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if name := strings.TrimSpace(payload.Name); name != "" {
+		rule.Name = name
+	}
+	rule.NoInvitation = payload.NoInvitation
+	rule.WithInvitation = payload.WithInvitation
+	rule.Enabled = payload.Enabled
+
+	var version *models.PerformanceRuleVersion
+	if err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&rule).Error; err != nil {
+			return err
+		}
+		version, err = savePerformanceRuleVersion(tx, &rule, effectiveFrom, c.GetUint("user_id"))
+		return err
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "更新绩效规则失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "绩效规则更新成功",
+		"data":    rule,
+		"version": version,
+	})
+}
+
+// validatePerformanceRuleScope 校验按模板和部门配置的规则：名称不能为空，至少指定模板或部门，同一适用范围只能有一条规则
+func validatePerformanceRuleScope(payload PerformanceRulePayload, ruleID uint) error {
+	if strings.TrimSpace(payload.Name) == "" {
+		return fmt.Errorf("规则名称不能为空")
+	}
+	if payload.TemplateID == nil && payload.DepartmentID == nil {
+		return fmt.Errorf("请指定规则适用的模板或部门")
+	}
+	if payload.TemplateID != nil {
+		var template models.KPITemplate
+		if err := models.DB.First(&template, *payload.TemplateID).Error; err != nil {
+			return fmt.Errorf("模板不存在")
+		}
+	}
+	if payload.DepartmentID != nil {
+		var department models.Department
+		if err := models.DB.First(&department, *payload.DepartmentID).Error; err != nil {
+			return fmt.Errorf("部门不存在")
+		}
+	}
+
+	query := models.DB.Model(&models.PerformanceRule{}).Where("id <> ?", ruleID)
+	if payload.TemplateID != nil {
+		query = query.Where("template_id = ?", *payload.TemplateID)
+	} else {
+		query = query.Where("template_id IS NULL")
+	}
+	if payload.DepartmentID != nil {
+		query = query.Where("department_id = ?", *payload.DepartmentID)
+	} else {
+		query = query.Where("department_id IS NULL")
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("该模板和部门范围已配置绩效规则")
+	}
+	return nil
+}
+
+// CreatePerformanceRule 创建按模板和/或部门配置的绩效评分规则
+func CreatePerformanceRule(c *gin.Context) {
+	var payload PerformanceRulePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := validatePerformanceRulePayload(payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err := validatePerformanceRuleScope(payload, 0); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	effectiveFrom, err := performanceRuleEffectiveFrom(payload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	rule := models.PerformanceRule{
+		Name:           strings.TrimSpace(payload.Name),
+		TemplateID:     payload.TemplateID,
+		DepartmentID:   payload.DepartmentID,
+		NoInvitation:   payload.NoInvitation,
+		WithInvitation: payload.WithInvitation,
+		Enabled:        payload.Enabled,
+	}
+	var version *models.PerformanceRuleVersion
+	if err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&rule).Error; err != nil {
+			return err
+		}
+		version, err = savePerformanceRuleVersion(tx, &rule, effectiveFrom, c.GetUint("user_id"))
+		return err
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "创建绩效规则失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "绩效规则创建成功",
+		"data":    rule,
+		"version": version,
+	})
+}
+
+// UpdateScopedPerformanceRule 更新按模板和/或部门配置的绩效评分规则
+func UpdateScopedPerformanceRule(c *gin.Context) {
+	rule, ok := loadScopedPerformanceRule(c)
+	if !ok {
+		return
+	}
+
+	var payload PerformanceRulePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := validatePerformanceRulePayload(payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err := validatePerformanceRuleScope(payload, rule.ID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	effectiveFrom, err := performanceRuleEffectiveFrom(payload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
 		})
 		return
 	}
 
+	rule.Name = strings.TrimSpace(payload.Name)
+	rule.TemplateID = payload.TemplateID
+	rule.DepartmentID = payload.DepartmentID
 	rule.NoInvitation = payload.NoInvitation
 	rule.WithInvitation = payload.WithInvitation
 	rule.Enabled = payload.Enabled
 
-	if err := models.DB.Save(&rule).Error; err != nil {
+	var version *models.PerformanceRuleVersion
+	if err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(rule).Error; err != nil {
+			return err
+		}
+		version, err = savePerformanceRuleVersion(tx, rule, effectiveFrom, c.GetUint("user_id"))
+		return err
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "更新绩效规则失败",
 			"message": err.Error(),
@@ -92,9 +420,153 @@ func UpdatePerformanceRule(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"message": "绩效规则更新成功",
 		"data":    rule,
+		"version": version,
+	})
+}
+
+// DeletePerformanceRule 删除按模板和/或部门配置的绩效评分规则及其版本，组织默认规则不能删除
+// 已采用该规则的评估保留各自的规则快照
+func DeletePerformanceRule(c *gin.Context) {
+	rule, ok := loadScopedPerformanceRule(c)
+	if !ok {
+		return
+	}
+
+	if err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("rule_id = ?", rule.ID).Delete(&models.PerformanceRuleVersion{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(rule).Error
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "删除绩效规则失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "绩效规则删除成功",
 	})
 }
 
+// ResolvePerformanceRule 查询模板和部门适用的绩效评分规则及生效版本，可通过 at 参数（RFC3339）查询指定时间的规则
+func ResolvePerformanceRule(c *gin.Context) {
+	var templateID, departmentID uint
+	for key, target := range map[string]*uint{"template_id": &templateID, "department_id": &departmentID} {
+		if value := c.Query(key); value != "" {
+			id, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": fmt.Sprintf("无效的参数：%s", key),
+				})
+				return
+			}
+			*target = uint(id)
+		}
+	}
+
+	at := time.Now()
+	if value := c.Query("at"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "无效的参数：at",
+			})
+			return
+		}
+		at = parsed
+	}
+
+	rule, version, err := resolveEffectivePerformanceRule(models.DB, templateID, departmentID, at)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取绩效规则失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":    rule,
+		"version": version,
+	})
+}
+
+// GetPerformanceRuleVersions 获取绩效规则的版本列表（按版本号倒序），同时返回当前生效的版本ID
+func GetPerformanceRuleVersions(c *gin.Context) {
+	ruleId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的规则ID",
+		})
+		return
+	}
+
+	var rule models.PerformanceRule
+	if err := models.DB.First(&rule, ruleId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "绩效规则不存在",
+		})
+		return
+	}
+
+	var versions []models.PerformanceRuleVersion
+	if err := models.DB.Preload("CreatedBy").Where("rule_id = ?", rule.ID).
+		Order("version DESC").Find(&versions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取绩效规则版本失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var effectiveVersionID *uint
+	effective, err := effectivePerformanceRuleVersion(models.DB, rule.ID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取绩效规则版本失败",
+			"message": err.Error(),
+		})
+		return
+	}
+	if effective != nil {
+		effectiveVersionID = &effective.ID
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":                 versions,
+		"rule":                 rule,
+		"effective_version_id": effectiveVersionID,
+	})
+}
+
+// loadScopedPerformanceRule 按路径参数加载按模板和/或部门配置的规则，组织默认规则请使用 PUT /performance-rules
+func loadScopedPerformanceRule(c *gin.Context) (*models.PerformanceRule, bool) {
+	ruleId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的规则ID",
+		})
+		return nil, false
+	}
+
+	var rule models.PerformanceRule
+	if err := models.DB.First(&rule, ruleId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "绩效规则不存在",
+		})
+		return nil, false
+	}
+	if rule.TemplateID == nil && rule.DepartmentID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "组织默认规则不能在此修改或删除",
+		})
+		return nil, false
+	}
+	return &rule, true
+}
+
 func validatePerformanceRulePayload(payload PerformanceRulePayload) error {
 	checks := []struct {
 		label  string
@@ -148,3 +620,48 @@ func validatePercentageValue(field string, value float64) error {
 	}
 	return nil
 }
+
+// GetEvaluationAppliedRule 获取评估计算HR评分时采用的绩效规则版本及各考核项目的计算依据
+func GetEvaluationAppliedRule(c *gin.Context) {
+	evaluationId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的评估ID",
+		})
+		return
+	}
+
+	var evaluation models.KPIEvaluation
+	if err := models.DB.Preload("Employee").First(&evaluation, evaluationId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "评估不存在",
+		})
+		return
+	}
+
+	// 权限检查：HR、被评估员工本人及其直属上级可以查看
+	userID := c.GetUint("user_id")
+	isManager := evaluation.Employee.ManagerID != nil && *evaluation.Employee.ManagerID == userID
+	if c.GetString("user_role") != "hr" && evaluation.EmployeeID != userID && !isManager {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "无权查看此评估的绩效规则",
+		})
+		return
+	}
+
+	// 规则或版本被删除后仍以评估上的快照为准
+	var version *models.PerformanceRuleVersion
+	if evaluation.PerformanceRuleVersionID != nil {
+		var record models.PerformanceRuleVersion
+		if err := models.DB.First(&record, *evaluation.PerformanceRuleVersionID).Error; err == nil {
+			version = &record
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":        evaluation.AppliedRule,
+		"version":     version,
+		"total_score": evaluation.TotalScore,
+		"raw_score":   evaluation.RawScore,
+	})
+}
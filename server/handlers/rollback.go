@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"dootask-kpi-server/models"
+	"dootask-kpi-server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// evaluationStageOrder 评估各阶段的先后顺序，目标制定和目标审批仅在启用目标设定的评估中出现
+var evaluationStageOrder = []string{"goal_setting", "goal_review", "pending", "self_evaluated", "manager_evaluated", "pending_confirm", "completed"}
+
+// 退回评估请求结构
+type RollbackEvaluationRequest struct {
+	TargetStatus     string `json:"target_status" binding:"required,oneof=goal_setting goal_review pending self_evaluated manager_evaluated pending_confirm"`
+	Reason           string `json:"reason" binding:"required"`
+	ClearHRScores    bool   `json:"clear_hr_scores"`    // 是否清除HR评分
+	ClearFinalScores bool   `json:"clear_final_scores"` // 是否清除最终得分及说明
+}
+
+// evaluationStageIndex 返回阶段在流程中的位置，未知状态返回-1
+func evaluationStageIndex(status string) int {
+	for i, stage := range evaluationStageOrder {
+		if stage == status {
+			return i
+		}
+	}
+	return -1
+}
+
+// isGoalStage 判断阶段是否属于目标制定或目标审批
+func isGoalStage(status string) bool {
+	return status == "goal_setting" || status == "goal_review"
+}
+
+// hasGoalStages 判断评估是否经过目标设定流程（当前处于目标阶段或目标已审批通过）
+func hasGoalStages(evaluation *models.KPIEvaluation) bool {
+	return isGoalStage(evaluation.Status) || evaluation.GoalsApprovedAt != nil
+}
+
+// rollbackTargets 返回评估可以退回到的所有更早阶段，未经过目标设定的评估不能退回到目标阶段
+func rollbackTargets(evaluation *models.KPIEvaluation) []string {
+	targets := []string{}
+	index := evaluationStageIndex(evaluation.Status)
+	if index <= 0 {
+		return targets
+	}
+	for _, stage := range evaluationStageOrder[:index] {
+		if isGoalStage(stage) && !hasGoalStages(evaluation) {
+			continue
+		}
+		targets = append(targets, stage)
+	}
+	return targets
+}
+
+// effectiveItemScore 返回评分项当前的有效得分：最终得分 > HR评分 > 上级评分 > 自评 > 量化指标自动得分
+func effectiveItemScore(score models.KPIScore) float64 {
+	switch {
+	case score.FinalScore != nil:
+		return *score.FinalScore
+	case score.HRScore != nil:
+		return *score.HRScore
+	case score.ManagerScore != nil:
+		return *score.ManagerScore
+	case score.SelfScore != nil:
+		return *score.SelfScore
+	case score.AutoScore != nil:
+		return *score.AutoScore
+	default:
+		return 0
+	}
+}
+
+// 重新打开已完成的评估（仅HR）
+func ReopenEvaluation(c *gin.Context) {
+	rollbackEvaluation(c, true)
+}
+
+// 将进行中的评估退回到更早阶段（仅HR）
+func RollbackEvaluation(c *gin.Context) {
+	rollbackEvaluation(c, false)
+}
+
+// rollbackEvaluation 退回评估，reopen 为 true 时只处理已完成的评估，否则只处理未完成的评估
+func rollbackEvaluation(c *gin.Context, reopen bool) {
+	id := c.Param("id")
+	evaluationId, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的评估ID",
+		})
+		return
+	}
+
+	var req RollbackEvaluationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "请填写退回原因",
+		})
+		return
+	}
+
+	var evaluation models.KPIEvaluation
+	if err := models.DB.Preload("Employee").First(&evaluation, evaluationId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "评估不存在",
+		})
+		return
+	}
+
+	if reopen && evaluation.Status != "completed" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "只能重新打开已完成的评估",
+		})
+		return
+	}
+	if !reopen && evaluation.Status == "completed" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "已完成的评估请使用重新打开",
+		})
+		return
+	}
+	if evaluationStageIndex(req.TargetStatus) >= evaluationStageIndex(evaluation.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("只能从「%s」退回到更早的阶段", getStatusText(evaluation.Status)),
+		})
+		return
+	}
+	if isGoalStage(req.TargetStatus) && !hasGoalStages(&evaluation) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "该评估未启用目标设定，不能退回到目标阶段",
+		})
+		return
+	}
+
+	var scores []models.KPIScore
+	if err := models.DB.Where("evaluation_id = ?", evaluation.ID).Find(&scores).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取评分记录失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// 并发检查：If-Match 与当前版本不一致时拒绝
+	expectedVersion, ok := checkIfMatch(c, evaluation.Version, &evaluation)
+	if !ok {
+		return
+	}
+
+	operatorID := c.GetUint("user_id")
+	history := newHistoryRecorder(evaluation.ID, operatorID, historySourceRollback)
+	history.change("reason", "", req.Reason)
+	history.change("status", evaluation.Status, req.TargetStatus)
+
+	tx := models.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// 按选择清除HR评分和最终得分，并重新计算总分
+	for i := range scores {
+		score := &scores[i]
+		updates := map[string]interface{}{}
+		if req.ClearHRScores && (score.HRScore != nil || score.HRComment != "") {
+			history.scoreChange(score, "hr_score", score.HRScore, nil)
+			history.scoreChange(score, "hr_comment", score.HRComment, "")
+			updates["hr_score"] = nil
+			updates["hr_comment"] = ""
+			score.HRScore = nil
+			score.HRComment = ""
+		}
+		if req.ClearFinalScores && (score.FinalScore != nil || score.FinalComment != "") {
+			history.scoreChange(score, "final_score", score.FinalScore, nil)
+			history.scoreChange(score, "final_comment", score.FinalComment, "")
+			updates["final_score"] = nil
+			updates["final_comment"] = ""
+			score.FinalScore = nil
+			score.FinalComment = ""
+		}
+		if len(updates) > 0 {
+			if err := tx.Model(&models.KPIScore{}).Where("id = ?", score.ID).Updates(updates).Error; err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":   "清除评分失败",
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+	}
+	totalScore, rawScore := evaluationTotalScore(&evaluation, scores)
+
+	evaluationUpdates := map[string]interface{}{
+		"status":        req.TargetStatus,
+		"total_score":   totalScore,
+		"raw_score":     rawScore,
+		"has_objection": false,
+		"grade":         "",
+		"grade_label":   "",
+	}
+	history.change("total_score", evaluation.TotalScore, totalScore)
+	history.change("raw_score", evaluation.RawScore, rawScore)
+	history.change("has_objection", evaluation.HasObjection, false)
+	history.change("grade", evaluation.Grade, "")
+	// 清除HR评分后，之前采用的绩效规则快照不再对应当前评分
+	if req.ClearHRScores && evaluation.AppliedRule != nil {
+		evaluationUpdates["performance_rule_version_id"] = nil
+		evaluationUpdates["applied_rule"] = nil
+		history.change("performance_rule", appliedPerformanceRuleLabel(evaluation.AppliedRule), "")
+	}
+	// 退回阶段及之后各阶段的截止时间作废，退回阶段从现在起按模板配置重新计算，之后的阶段在进入时计算
+	for _, stage := range stageDeadlineColumns {
+		if evaluationStageIndex(stage.status) >= evaluationStageIndex(req.TargetStatus) {
+			evaluationUpdates[stage.column] = nil
+			history.change(stage.column, stageDeadline(&evaluation, stage.status), nil)
+		}
+	}
+	// 退回到目标阶段时目标重新进入待审批状态，重新审批通过后再次锁定
+	if isGoalStage(req.TargetStatus) && evaluation.GoalsApprovedAt != nil {
+		evaluationUpdates["goals_approved_at"] = nil
+		evaluationUpdates["goals_approved_by_id"] = nil
+		history.change("goals_approved_at", evaluation.GoalsApprovedAt, nil)
+	}
+	if req.ClearFinalScores {
+		evaluationUpdates["final_comment"] = ""
+		history.change("final_comment", evaluation.FinalComment, "")
+	}
+
+	result := whereVersion(tx.Model(&models.KPIEvaluation{}).Where("id = ?", evaluation.ID), expectedVersion).Updates(evaluationUpdates)
+	if result.Error != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "退回评估失败",
+			"message": result.Error.Error(),
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		models.DB.First(&evaluation, evaluation.ID)
+		respondVersionConflict(c, evaluation.Version, &evaluation)
+		return
+	}
+	if err := scheduleStageDeadline(tx, &evaluation, req.TargetStatus, time.Now()); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "设置截止时间失败",
+			"message": err.Error(),
+		})
+		return
+	}
+	// 退回到主管评分之前的阶段时，取消未完成的审批步骤，重新提交主管评分后开始新一轮审批
+	if evaluationStageIndex(req.TargetStatus) < evaluationStageIndex("manager_evaluated") {
+		if err := cancelPendingApprovals(tx, evaluation.ID); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "取消审批步骤失败",
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	if err := history.save(tx); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "记录变更历史失败",
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "退回评估失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	models.DB.Preload("Employee.Manager").Preload("Template").Preload("Scores").First(&evaluation, evaluation.ID)
+	setVersionETag(c, evaluation.Version)
+
+	// 创建自动评论，记录退回原因
+	action := "退回"
+	if reopen {
+		action = "重新打开"
+	}
+	commentContent := fmt.Sprintf("HR%s评估至「%s」，原因：%s", action, getStatusText(req.TargetStatus), req.Reason)
+	if err := createAutoComment(evaluation.ID, operatorID, commentContent); err != nil {
+		fmt.Printf("创建退回评估自动评论失败: %v\n", err)
+	}
+
+	// 发送 DooTask 机器人通知：被评估员工及其直属上级
+	dooTaskClient := utils.NewDooTaskClient(c.GetHeader("DooTaskAuth"))
+	periodValue := utils.GetPeriodValue(evaluation.Period, evaluation.Year, evaluation.Month, evaluation.Quarter)
+	appConfigJSON := utils.BuildKPIAppConfig(evaluation.ID)
+	message := fmt.Sprintf(
+		"**绩效考核已%s**\n- 考核模板：%s\n- 考核周期：%s\n- 被评估员工：%s\n- 当前阶段：%s\n- 原因：%s\n\n> <div class=\"open-micro-app\" data-app-config='%s'>查看详情：点击查看详情</div>",
+		action,
+		evaluation.Template.Name,
+		periodValue,
+		evaluation.Employee.Name,
+		getStatusText(req.TargetStatus),
+		req.Reason,
+		appConfigJSON,
+	)
+	_ = dooTaskClient.SendBotMessage(evaluation.Employee.DooTaskUserID, message)
+	if evaluation.Employee.Manager != nil {
+		_ = dooTaskClient.SendBotMessage(evaluation.Employee.Manager.DooTaskUserID, message)
+	}
+
+	// 发送实时通知
+	GetNotificationService().SendNotification(operatorID, EventEvaluationStatusChange, &evaluation)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("评估已%s至「%s」", action, getStatusText(req.TargetStatus)),
+		"data":    evaluation,
+	})
+}
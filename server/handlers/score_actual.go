@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"dootask-kpi-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 可录入量化指标实际完成值的评估状态，进入待确认后总分已确定，不再允许修改
+var actualValueEditableStatuses = map[string]bool{
+	"pending":           true,
+	"self_evaluated":    true,
+	"manager_evaluated": true,
+}
+
+// 录入量化指标的实际完成值，按计分曲线自动计算得分
+// 员工本人、上级（含受托人/升级接收人）和HR均可录入，评分人可在自动得分基础上调整各自的评分
+func UpdateActualValue(c *gin.Context) {
+	scoreId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的评分ID",
+		})
+		return
+	}
+
+	var score models.KPIScore
+	if err := models.DB.Preload("Evaluation.Employee").First(&score, scoreId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "评分记录不存在",
+		})
+		return
+	}
+
+	var updateData struct {
+		ActualValue *float64 `json:"actual_value"`
+	}
+	if err := c.ShouldBindJSON(&updateData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var operator models.Employee
+	if err := models.DB.First(&operator, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "用户不存在",
+		})
+		return
+	}
+	if len(resolveEvaluationActors(&score.Evaluation, &operator)) == 0 {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "无权录入该评估的实际完成值",
+		})
+		return
+	}
+	if !actualValueEditableStatuses[score.Evaluation.Status] {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("评估当前处于「%s」阶段，不能修改实际完成值", getStatusText(score.Evaluation.Status)),
+		})
+		return
+	}
+
+	item, _ := scoreItem(&score)
+	if itemScoreType(&item) != scoreTypeQuantitative {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("「%s」不是量化指标，不能录入实际完成值", item.Name),
+		})
+		return
+	}
+	if updateData.ActualValue != nil && *updateData.ActualValue < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "实际完成值不能为负数",
+		})
+		return
+	}
+
+	// 并发检查：If-Match 与当前版本不一致时拒绝
+	expectedVersion, ok := checkIfMatch(c, score.Version, &score)
+	if !ok {
+		return
+	}
+
+	// 清空实际完成值时同时清空自动得分
+	var autoScore *float64
+	if updateData.ActualValue != nil {
+		value := quantitativeScore(&item, *updateData.ActualValue)
+		autoScore = &value
+	}
+
+	history := newHistoryRecorder(score.EvaluationID, operator.ID, historySourceActualValue)
+	history.scoreChange(&score, "actual_value", score.ActualValue, updateData.ActualValue)
+	history.scoreChange(&score, "auto_score", score.AutoScore, autoScore)
+
+	// 更新与变更历史在同一事务中写入
+	err = updateVersioned(&score, expectedVersion, map[string]interface{}{
+		"actual_value": updateData.ActualValue,
+		"auto_score":   autoScore,
+	}, history)
+	if errors.Is(err, errVersionConflict) {
+		models.DB.First(&score, score.ID)
+		respondVersionConflict(c, score.Version, &score)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "更新实际完成值失败",
+			"message": err.Error(),
+		})
+		return
+	}
+	models.DB.First(&score, score.ID)
+
+	setVersionETag(c, score.Version)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "实际完成值更新成功",
+		"data":    score,
+	})
+}
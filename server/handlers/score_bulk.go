@@ -0,0 +1,429 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"dootask-kpi-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 批量评分条目
+type BulkScoreEntry struct {
+	ScoreID uint     `json:"score_id" binding:"required"`
+	Score   *float64 `json:"score"`
+	Comment string   `json:"comment"`
+	Version *uint    `json:"version"` // 可选，评分记录的版本号，不一致时拒绝
+}
+
+// 批量评分请求结构：一次提交某一评分身份的全部评分，submit 为 true 时同时推进评估状态
+type BulkScoreRequest struct {
+	Role   string           `json:"role" binding:"required,oneof=self manager hr"`
+	Scores []BulkScoreEntry `json:"scores" binding:"dive"`
+	Submit bool             `json:"submit"`
+}
+
+// bulkScoreRole 评分身份对应的字段、历史来源和流程操作
+type bulkScoreRole struct {
+	scoreField    string
+	commentField  string
+	historySource string
+	action        string
+}
+
+var bulkScoreRoles = map[string]bulkScoreRole{
+	"self":    {scoreField: "self_score", commentField: "self_comment", historySource: historySourceSelfScore, action: evaluationActionSubmitSelf},
+	"manager": {scoreField: "manager_score", commentField: "manager_comment", historySource: historySourceManagerScore, action: evaluationActionSubmitManager},
+	"hr":      {scoreField: "hr_score", commentField: "hr_comment", historySource: historySourceHRScore, action: evaluationActionSubmitHR},
+}
+
+// roleScoreValue 返回评分记录中该评分身份的分数和评价
+func roleScoreValue(score *models.KPIScore, role string) (*float64, string) {
+	switch role {
+	case "self":
+		return score.SelfScore, score.SelfComment
+	case "manager":
+		return score.ManagerScore, score.ManagerComment
+	default:
+		return score.HRScore, score.HRComment
+	}
+}
+
+// setRoleScoreValue 设置评分记录中该评分身份的分数和评价
+func setRoleScoreValue(score *models.KPIScore, role string, value *float64, comment string) {
+	switch role {
+	case "self":
+		score.SelfScore, score.SelfComment = value, comment
+	case "manager":
+		score.ManagerScore, score.ManagerComment = value, comment
+	default:
+		score.HRScore, score.HRComment = value, comment
+	}
+}
+
+// roleScoreTransition 返回评分身份提交评分时对应的流程操作
+func roleScoreTransition(role string) evaluationTransition {
+	for _, transition := range evaluationTransitions {
+		if transition.Action == bulkScoreRoles[role].action {
+			return transition
+		}
+	}
+	return evaluationTransition{}
+}
+
+// checkScoreWritable 检查用户能否写入评分：评估须处于 stage 阶段，且用户在评估中具备 allowedActors 之一的身份
+// evaluation 需预加载 Employee
+func checkScoreWritable(evaluation *models.KPIEvaluation, operator *models.Employee, stage string, allowedActors []string, label string) *workflowError {
+	if evaluation.Status != stage {
+		return &workflowError{
+			status:  http.StatusBadRequest,
+			message: fmt.Sprintf("评估当前处于「%s」阶段，不能进行此评分", getStatusText(evaluation.Status)),
+		}
+	}
+	actors := resolveEvaluationActors(evaluation, operator)
+	for _, actor := range allowedActors {
+		if actors[actor] {
+			return nil
+		}
+	}
+	return &workflowError{
+		status:  http.StatusForbidden,
+		message: fmt.Sprintf("无权执行此操作：%s", label),
+	}
+}
+
+// authorizeScoreWrite 加载当前用户并检查能否写入评分，不能写入时返回错误响应并返回 false
+func authorizeScoreWrite(c *gin.Context, evaluation *models.KPIEvaluation, stage string, allowedActors []string, label string) bool {
+	var operator models.Employee
+	if err := models.DB.First(&operator, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "用户不存在",
+		})
+		return false
+	}
+	if werr := checkScoreWritable(evaluation, &operator, stage, allowedActors, label); werr != nil {
+		c.JSON(werr.status, gin.H{
+			"error": werr.message,
+		})
+		return false
+	}
+	return true
+}
+
+// respondBulkScoreConflict 批量评分写入时发现版本冲突，返回最新的评估及评分
+func respondBulkScoreConflict(c *gin.Context, evaluationID uint) {
+	var current models.KPIEvaluation
+	models.DB.Preload("Scores.Item").First(&current, evaluationID)
+	applyItemSnapshots(current.Scores)
+	respondVersionConflict(c, current.Version, &current)
+}
+
+// 批量保存评估评分，可选同时提交（推进到下一阶段），全部成功或全部失败
+func BulkUpdateEvaluationScores(c *gin.Context) {
+	id := c.Param("id")
+	evaluationId, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的评估ID",
+		})
+		return
+	}
+
+	var req BulkScoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+	role := bulkScoreRoles[req.Role]
+
+	var evaluation models.KPIEvaluation
+	if err := models.DB.Preload("Employee").Preload("Scores.Item").First(&evaluation, evaluationId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "评估不存在",
+		})
+		return
+	}
+	applyItemSnapshots(evaluation.Scores)
+
+	var operator models.Employee
+	if err := models.DB.First(&operator, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "用户不存在",
+		})
+		return
+	}
+
+	// 权限与阶段检查：只能在该评分身份对应的阶段、由对应身份评分
+	transition := roleScoreTransition(req.Role)
+	if werr := checkScoreWritable(&evaluation, &operator, transition.From, transition.Actors, transition.Label); werr != nil {
+		c.JSON(werr.status, gin.H{
+			"error": werr.message,
+		})
+		return
+	}
+	if req.Submit {
+		if _, werr := checkEvaluationTransition(&evaluation, &operator, transition.To); werr != nil {
+			c.JSON(werr.status, gin.H{
+				"error": werr.message,
+			})
+			return
+		}
+	} else if req.Role == "self" && evaluation.Employee.ManagerID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "暂无直属上级，请联系HR",
+		})
+		return
+	}
+
+	// 并发检查：If-Match 对应评估版本号，条目中的 version 对应评分记录版本号
+	expectedVersion, ok := checkIfMatch(c, evaluation.Version, &evaluation)
+	if !ok {
+		return
+	}
+
+	var onBehalfOf *uint
+	if req.Role == "manager" {
+		onBehalfOf = reviewOnBehalfOf(&evaluation, operator.ID)
+	}
+
+	// 校验全部评分，一次返回所有错误
+	scoreIndex := make(map[uint]int, len(evaluation.Scores))
+	for i, score := range evaluation.Scores {
+		scoreIndex[score.ID] = i
+	}
+	rules := loadScoreValidationRules()
+	var validationErrors []ScoreValidationError
+	submitted := make(map[uint]bool, len(req.Scores))
+	for _, entry := range req.Scores {
+		index, ok := scoreIndex[entry.ScoreID]
+		if !ok || submitted[entry.ScoreID] {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("评分记录 #%d 不属于该评估或重复提交", entry.ScoreID),
+			})
+			return
+		}
+		submitted[entry.ScoreID] = true
+
+		score := &evaluation.Scores[index]
+		if entry.Version != nil && *entry.Version != score.Version {
+			respondVersionConflict(c, evaluation.Version, &evaluation)
+			return
+		}
+		errs := rules.validate(&score.Item, role.scoreField, entry.Score, entry.Comment)
+		for i := range errs {
+			errs[i].ScoreID = score.ID
+		}
+		validationErrors = append(validationErrors, errs...)
+	}
+
+	// 提交时每个考核项目都必须有评分（文字评价项目必须填写评价，量化指标已录入实际值的以自动得分为准）
+	if req.Submit {
+		for _, score := range evaluation.Scores {
+			value, comment := roleScoreValue(&score, req.Role)
+			for _, entry := range req.Scores {
+				if entry.ScoreID == score.ID {
+					value, comment = entry.Score, entry.Comment
+				}
+			}
+			if value == nil {
+				value = score.AutoScore
+			}
+			if itemScoreMissing(&score.Item, value, comment) {
+				field, message := role.scoreField, fmt.Sprintf("「%s」尚未评分", score.Item.Name)
+				if itemScoreType(&score.Item) == scoreTypeText {
+					field, message = role.commentField, fmt.Sprintf("「%s」尚未填写评价", score.Item.Name)
+				}
+				validationErrors = append(validationErrors, ScoreValidationError{
+					ScoreID:  score.ID,
+					ItemID:   score.ItemID,
+					ItemName: score.Item.Name,
+					Field:    field,
+					Code:     scoreErrorRequired,
+					Message:  message,
+					MaxScore: score.Item.MaxScore,
+				})
+			}
+		}
+	}
+	if len(validationErrors) > 0 {
+		respondScoreValidationErrors(c, validationErrors)
+		return
+	}
+
+	history := newHistoryRecorder(evaluation.ID, operator.ID, role.historySource)
+	statusHistory := newHistoryRecorder(evaluation.ID, operator.ID, historySourceEvaluation)
+
+	tx := models.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for _, entry := range req.Scores {
+		score := &evaluation.Scores[scoreIndex[entry.ScoreID]]
+		oldValue, oldComment := roleScoreValue(score, req.Role)
+		history.scoreChange(score, role.scoreField, oldValue, entry.Score)
+		history.scoreChange(score, role.commentField, oldComment, entry.Comment)
+
+		updates := map[string]interface{}{
+			role.scoreField:   entry.Score,
+			role.commentField: entry.Comment,
+		}
+		if req.Role == "manager" {
+			reviewerID := operator.ID
+			history.scoreChange(score, "manager_on_behalf_of_id", score.ManagerOnBehalfOfID, onBehalfOf)
+			updates["manager_reviewer_id"] = &reviewerID
+			updates["manager_on_behalf_of_id"] = onBehalfOf
+		}
+		result := whereVersion(tx.Model(&models.KPIScore{}).Where("id = ?", score.ID), entry.Version).Updates(updates)
+		if result.Error != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "保存评分失败",
+				"message": result.Error.Error(),
+			})
+			return
+		}
+		if result.RowsAffected == 0 {
+			tx.Rollback()
+			respondBulkScoreConflict(c, evaluation.ID)
+			return
+		}
+		setRoleScoreValue(score, req.Role, entry.Score, entry.Comment)
+	}
+
+	// 按计分方式重新计算总分
+	totalScore, rawScore := evaluationTotalScore(&evaluation, evaluation.Scores)
+	evaluationUpdates := map[string]interface{}{
+		"total_score": totalScore,
+		"raw_score":   rawScore,
+	}
+	statusHistory.change("total_score", evaluation.TotalScore, totalScore)
+	statusHistory.change("raw_score", evaluation.RawScore, rawScore)
+
+	// 提交HR审核（进入待确认）前检查部门强制分布配额
+	var distributionWarnings []string
+	if req.Submit && transition.To == "pending_confirm" {
+		distribution, err := checkEvaluationDistribution(&evaluation, totalScore)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "检查强制分布失败",
+				"message": err.Error(),
+			})
+			return
+		}
+		if distribution.Blocked {
+			tx.Rollback()
+			respondDistributionBlocked(c, distribution)
+			return
+		}
+		distributionWarnings = distribution.Violations
+	}
+	if req.Submit {
+		evaluationUpdates["status"] = transition.To
+		statusHistory.change("status", evaluation.Status, transition.To)
+	}
+	result := whereVersion(tx.Model(&models.KPIEvaluation{}).Where("id = ?", evaluation.ID), expectedVersion).Updates(evaluationUpdates)
+	if result.Error != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "更新评估失败",
+			"message": result.Error.Error(),
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		respondBulkScoreConflict(c, evaluation.ID)
+		return
+	}
+
+	// 进入新阶段时从当前时间起算该阶段的截止时间
+	if req.Submit {
+		if err := scheduleStageDeadline(tx, &evaluation, transition.To, time.Now()); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "设置截止时间失败",
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+
+	// 主管提交评分时，按配置的审批链生成审批步骤
+	if req.Submit && transition.Action == evaluationActionSubmitManager {
+		if _, err := startApprovalChain(tx, &evaluation); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "生成审批步骤失败",
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+
+	if err := history.save(tx); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "记录变更历史失败",
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := statusHistory.save(tx); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "记录变更历史失败",
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "保存评分失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	status := ""
+	if req.Submit {
+		status = transition.To
+		// 与单独更新评估状态一致：进入待HR审核时尝试按绩效规则自动审核
+		if status == "manager_evaluated" && tryAutoConfirmEvaluation(evaluation.ID) {
+			status = "pending_confirm"
+		}
+	}
+
+	models.DB.Preload("Employee.Manager").Preload("Template").Preload("Scores.Item").First(&evaluation, evaluation.ID)
+	applyItemSnapshots(evaluation.Scores)
+	setVersionETag(c, evaluation.Version)
+
+	if status != "" {
+		notifyEvaluationStatusChanged(c.GetHeader("DooTaskAuth"), &operator, onBehalfOf, &evaluation, status)
+		GetNotificationService().SendNotificationOnBehalf(operator.ID, onBehalfOf, EventEvaluationStatusChange, &evaluation)
+	} else {
+		GetNotificationService().SendNotificationOnBehalf(operator.ID, onBehalfOf, EventEvaluationUpdated, &evaluation)
+	}
+
+	message := "评分保存成功"
+	if req.Submit {
+		message = "评分已提交"
+	}
+	response := gin.H{
+		"message": message,
+		"data":    evaluation,
+	}
+	if len(distributionWarnings) > 0 {
+		response["distribution_warnings"] = distributionWarnings
+	}
+	c.JSON(http.StatusOK, response)
+}
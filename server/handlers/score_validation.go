@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"dootask-kpi-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 评分校验设置项
+const (
+	settingScoreDecimalPlaces  = "score_decimal_places"        // 评分允许的小数位数，默认2
+	settingCommentBelowPercent = "score_comment_below_percent" // 得分低于满分的百分之多少时必须填写评价，0表示不要求
+	settingCommentAbovePercent = "score_comment_above_percent" // 得分高于满分的百分之多少时必须填写评价，0表示不要求
+)
+
+// 评分校验错误码
+const (
+	scoreErrorOutOfRange      = "out_of_range"
+	scoreErrorPrecision       = "precision"
+	scoreErrorCommentRequired = "comment_required"
+	scoreErrorRequired        = "required"   // 提交时考核项目尚未评分（文字评价项目尚未填写评价）
+	scoreErrorNotScored       = "not_scored" // 文字评价项目不能打分
+)
+
+// 评分校验错误（指明具体考核项目）
+type ScoreValidationError struct {
+	ScoreID  uint     `json:"score_id,omitempty"`
+	ItemID   uint     `json:"item_id"`
+	ItemName string   `json:"item_name"`
+	Field    string   `json:"field"` // 出错的字段，如 self_score、manager_comment
+	Code     string   `json:"code"`  // out_of_range, precision, comment_required, required, not_scored
+	Message  string   `json:"message"`
+	Value    *float64 `json:"value,omitempty"`
+	MaxScore float64  `json:"max_score"`
+}
+
+// 评分校验规则
+type scoreValidationRules struct {
+	DecimalPlaces       int
+	CommentBelowPercent int
+	CommentAbovePercent int
+}
+
+// settingInt 读取整数设置项，未设置或无效时返回默认值
+func settingInt(key string, defaultValue int) int {
+	value, err := GetSetting(key)
+	if err != nil {
+		return defaultValue
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 {
+		return defaultValue
+	}
+	return number
+}
+
+// loadScoreValidationRules 读取评分校验规则
+func loadScoreValidationRules() scoreValidationRules {
+	return scoreValidationRules{
+		DecimalPlaces:       settingInt(settingScoreDecimalPlaces, 2),
+		CommentBelowPercent: settingInt(settingCommentBelowPercent, 0),
+		CommentAbovePercent: settingInt(settingCommentAbovePercent, 0),
+	}
+}
+
+// validate 校验单个考核项目的评分，value 为空表示清除评分，不做校验
+// field 为分数字段名（如 self_score、score），评价字段名由其推导（如 self_comment、comment）
+func (rules scoreValidationRules) validate(item *models.KPIItem, field string, value *float64, comment string) []ScoreValidationError {
+	if value == nil {
+		return nil
+	}
+
+	newError := func(field string, code string, message string) ScoreValidationError {
+		return ScoreValidationError{
+			ItemID:   item.ID,
+			ItemName: item.Name,
+			Field:    field,
+			Code:     code,
+			Message:  fmt.Sprintf("「%s」%s", item.Name, message),
+			Value:    value,
+			MaxScore: item.MaxScore,
+		}
+	}
+
+	score := *value
+	if math.IsNaN(score) || math.IsInf(score, 0) {
+		return []ScoreValidationError{newError(field, scoreErrorOutOfRange, "的评分无效")}
+	}
+	if code, message := validateTypedScore(item, score); code != "" {
+		return []ScoreValidationError{newError(field, code, message)}
+	}
+
+	// 等级量表和通过/不通过的取值已按类型校验，数值和量化指标校验范围和小数位数
+	if scoreType := itemScoreType(item); scoreType == scoreTypeNumeric || scoreType == scoreTypeQuantitative {
+		maxPoints := itemMaxPoints(item)
+		if score < 0 || (maxPoints > 0 && score > maxPoints) {
+			return []ScoreValidationError{newError(field, scoreErrorOutOfRange, fmt.Sprintf("的评分必须在 0 到 %s 之间", formatScore(maxPoints)))}
+		}
+
+		scale := math.Pow(10, float64(rules.DecimalPlaces))
+		if math.Abs(score*scale-math.Round(score*scale)) > 1e-6 {
+			message := fmt.Sprintf("的评分最多保留 %d 位小数", rules.DecimalPlaces)
+			if rules.DecimalPlaces == 0 {
+				message = "的评分必须为整数"
+			}
+			return []ScoreValidationError{newError(field, scoreErrorPrecision, message)}
+		}
+	}
+
+	if item.MaxScore > 0 && strings.TrimSpace(comment) == "" {
+		commentField := strings.TrimSuffix(field, "score") + "comment"
+		percent := itemPoints(item, score) / item.MaxScore * 100
+		if rules.CommentBelowPercent > 0 && percent < float64(rules.CommentBelowPercent) {
+			return []ScoreValidationError{newError(commentField, scoreErrorCommentRequired,
+				fmt.Sprintf("的评分低于满分的 %d%%，请填写评价说明", rules.CommentBelowPercent))}
+		}
+		if rules.CommentAbovePercent > 0 && percent > float64(rules.CommentAbovePercent) {
+			return []ScoreValidationError{newError(commentField, scoreErrorCommentRequired,
+				fmt.Sprintf("的评分高于满分的 %d%%，请填写评价说明", rules.CommentAbovePercent))}
+		}
+	}
+	return nil
+}
+
+// validateScore 按评分记录的考核项目快照校验评分，找不到考核项目时跳过校验
+func validateScore(score *models.KPIScore, field string, value *float64, comment string) []ScoreValidationError {
+	item, ok := scoreItem(score)
+	if !ok {
+		return nil
+	}
+	errs := loadScoreValidationRules().validate(&item, field, value, comment)
+	for i := range errs {
+		errs[i].ScoreID = score.ID
+	}
+	return errs
+}
+
+// validateInvitedScore 按评估的考核项目快照校验邀请评分，score 需预加载 Invitation
+func validateInvitedScore(score *models.InvitedScore, value *float64, comment string) []ScoreValidationError {
+	item, ok := evaluationItemSnapshots(score.Invitation.EvaluationID)[score.ItemID]
+	if !ok && models.DB.First(&item, score.ItemID).Error != nil {
+		return nil
+	}
+	errs := loadScoreValidationRules().validate(&item, "score", value, comment)
+	for i := range errs {
+		errs[i].ScoreID = score.ID
+	}
+	return errs
+}
+
+// respondScoreValidationErrors 返回评分校验失败的结构化错误
+func respondScoreValidationErrors(c *gin.Context, errs []ScoreValidationError) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":   "评分校验失败",
+		"message": errs[0].Message,
+		"errors":  errs,
+	})
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"math"
+
+	"dootask-kpi-server/models"
+)
+
+// 模板计分方式，两种方式的总分都折算到0-100
+const (
+	scoringModeSum      = "sum"      // 原始分合计：得分合计 / 满分合计 × 100
+	scoringModeWeighted = "weighted" // 加权百分比：各项目得分率按权重加权平均 × 100
+)
+
+// validScoringMode 计分方式是否有效，空值表示使用默认的原始分合计
+func validScoringMode(mode string) bool {
+	return mode == "" || mode == scoringModeSum || mode == scoringModeWeighted
+}
+
+// getScoringModeText 计分方式显示文本
+func getScoringModeText(mode string) string {
+	if mode == scoringModeWeighted {
+		return "加权百分比"
+	}
+	return "原始分合计"
+}
+
+// calculateTotalScore 按计分方式计算总分，返回折算到0-100（最高100）的总分和未折算的原始分合计
+// value 返回各评分记录的评分，按考核项目的评分类型换算为分数；加权模式下所有项目权重均为0时按原始分合计折算
+func calculateTotalScore(mode string, scores []models.KPIScore, value func(score *models.KPIScore) float64) (float64, float64) {
+	var rawScore, maxScore, weightedRate, totalWeight float64
+	for i := range scores {
+		item, _ := scoreItem(&scores[i])
+		itemScore := itemPoints(&item, value(&scores[i]))
+		rawScore += itemScore
+		maxScore += item.MaxScore
+		if item.MaxScore > 0 && item.Weight > 0 {
+			weightedRate += item.Weight * itemScore / item.MaxScore
+			totalWeight += item.Weight
+		}
+	}
+	rawScore = math.Round(rawScore*100) / 100
+
+	// 量化指标超额完成时得分可超过满分，折算后的总分封顶为100，原始分合计保留超额部分
+	switch {
+	case mode == scoringModeWeighted && totalWeight > 0:
+		return math.Min(math.Round(weightedRate/totalWeight*10000)/100, 100), rawScore
+	case maxScore > 0:
+		return math.Min(math.Round(rawScore/maxScore*10000)/100, 100), rawScore
+	default:
+		return rawScore, rawScore
+	}
+}
+
+// rawScoreForTotal 将HR直接调整的总分（0-100）按满分合计换算回原始分合计，使原始得分与总分保持一致
+func rawScoreForTotal(scores []models.KPIScore, total float64) float64 {
+	var maxScore float64
+	for i := range scores {
+		item, _ := scoreItem(&scores[i])
+		maxScore += item.MaxScore
+	}
+	if maxScore <= 0 {
+		return total
+	}
+	return math.Round(total*maxScore) / 100
+}
+
+// evaluationTotalScore 按评估的计分方式，以各项目当前有效得分计算总分和原始分合计
+func evaluationTotalScore(evaluation *models.KPIEvaluation, scores []models.KPIScore) (float64, float64) {
+	return calculateTotalScore(evaluation.ScoringMode, scores, func(score *models.KPIScore) float64 {
+		return effectiveItemScore(*score)
+	})
+}
+
+// roleTotalScore 按评估的计分方式计算某一评分身份（self、manager、hr）给出的总分，折算到0-100
+// 该身份未评分的项目按量化指标自动得分计算，没有自动得分时按0分
+func roleTotalScore(evaluation *models.KPIEvaluation, scores []models.KPIScore, role string) float64 {
+	total, _ := calculateTotalScore(evaluation.ScoringMode, scores, func(score *models.KPIScore) float64 {
+		if value, _ := roleScoreValue(score, role); value != nil {
+			return *value
+		}
+		if score.AutoScore != nil {
+			return *score.AutoScore
+		}
+		return 0
+	})
+	return total
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"testing"
+
+	"dootask-kpi-server/models"
+)
+
+// snapshotScore 构造带考核项目快照的评分记录，计算总分时无需查询数据库
+func snapshotScore(item models.KPIItem, value float64) models.KPIScore {
+	score := models.KPIScore{ItemID: item.ID, FinalScore: &value}
+	setItemSnapshot(&score, &item)
+	return score
+}
+
+func TestCalculateTotalScore(t *testing.T) {
+	numeric := func(id uint, maxScore, weight float64) models.KPIItem {
+		return models.KPIItem{ID: id, Name: "项目", MaxScore: maxScore, Weight: weight, ScoreType: scoreTypeNumeric}
+	}
+
+	tests := []struct {
+		name      string
+		mode      string
+		scores    []models.KPIScore
+		wantTotal float64
+		wantRaw   float64
+	}{
+		{
+			name: "原始分合计按满分合计折算",
+			mode: scoringModeSum,
+			scores: []models.KPIScore{
+				snapshotScore(numeric(1, 40, 0), 30),
+				snapshotScore(numeric(2, 10, 0), 5),
+			},
+			wantTotal: 70,
+			wantRaw:   35,
+		},
+		{
+			name: "满分合计为100时总分等于原始分",
+			mode: scoringModeSum,
+			scores: []models.KPIScore{
+				snapshotScore(numeric(1, 60, 0), 45.5),
+				snapshotScore(numeric(2, 40, 0), 30),
+			},
+			wantTotal: 75.5,
+			wantRaw:   75.5,
+		},
+		{
+			name: "空计分方式按原始分合计",
+			mode: "",
+			scores: []models.KPIScore{
+				snapshotScore(numeric(1, 50, 0), 25),
+			},
+			wantTotal: 50,
+			wantRaw:   25,
+		},
+		{
+			name: "加权百分比按权重加权得分率",
+			mode: scoringModeWeighted,
+			scores: []models.KPIScore{
+				snapshotScore(numeric(1, 10, 30), 10),
+				snapshotScore(numeric(2, 50, 70), 25),
+			},
+			wantTotal: 65,
+			wantRaw:   35,
+		},
+		{
+			name: "加权百分比忽略权重为0的项目",
+			mode: scoringModeWeighted,
+			scores: []models.KPIScore{
+				snapshotScore(numeric(1, 10, 100), 8),
+				snapshotScore(numeric(2, 10, 0), 0),
+			},
+			wantTotal: 80,
+			wantRaw:   8,
+		},
+		{
+			name: "加权百分比权重均为0时按原始分合计折算",
+			mode: scoringModeWeighted,
+			scores: []models.KPIScore{
+				snapshotScore(numeric(1, 20, 0), 10),
+				snapshotScore(numeric(2, 20, 0), 20),
+			},
+			wantTotal: 75,
+			wantRaw:   30,
+		},
+		{
+			name: "等级量表和通过/不通过换算为分数",
+			mode: scoringModeSum,
+			scores: []models.KPIScore{
+				snapshotScore(models.KPIItem{ID: 1, Name: "量表", MaxScore: 50, ScoreType: scoreTypeScale, ScalePoints: 5}, 4),
+				snapshotScore(models.KPIItem{ID: 2, Name: "通过", MaxScore: 30, ScoreType: scoreTypePassFail}, 1),
+				snapshotScore(models.KPIItem{ID: 3, Name: "不通过", MaxScore: 20, ScoreType: scoreTypePassFail}, 0),
+			},
+			wantTotal: 70,
+			wantRaw:   70,
+		},
+		{
+			name: "文字评价不计入总分",
+			mode: scoringModeSum,
+			scores: []models.KPIScore{
+				snapshotScore(numeric(1, 10, 0), 9),
+				snapshotScore(models.KPIItem{ID: 2, Name: "评价", ScoreType: scoreTypeText}, 5),
+			},
+			wantTotal: 90,
+			wantRaw:   9,
+		},
+		{
+			name: "原始分合计超额完成时总分封顶为100",
+			mode: scoringModeSum,
+			scores: []models.KPIScore{
+				snapshotScore(models.KPIItem{ID: 1, Name: "销售额", MaxScore: 10, ScoreType: scoreTypeQuantitative}, 13),
+				snapshotScore(numeric(2, 10, 0), 10),
+			},
+			wantTotal: 100,
+			wantRaw:   23,
+		},
+		{
+			name: "加权百分比超额完成时总分封顶为100",
+			mode: scoringModeWeighted,
+			scores: []models.KPIScore{
+				snapshotScore(models.KPIItem{ID: 1, Name: "销售额", MaxScore: 10, Weight: 50, ScoreType: scoreTypeQuantitative}, 15),
+				snapshotScore(numeric(2, 10, 50), 9),
+			},
+			wantTotal: 100,
+			wantRaw:   24,
+		},
+		{
+			name: "超额部分可弥补其他项目但不超过100",
+			mode: scoringModeSum,
+			scores: []models.KPIScore{
+				snapshotScore(models.KPIItem{ID: 1, Name: "销售额", MaxScore: 10, ScoreType: scoreTypeQuantitative}, 12),
+				snapshotScore(numeric(2, 10, 0), 6),
+			},
+			wantTotal: 90,
+			wantRaw:   18,
+		},
+		{
+			name:      "没有评分记录时总分为0",
+			mode:      scoringModeSum,
+			scores:    nil,
+			wantTotal: 0,
+			wantRaw:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			total, raw := calculateTotalScore(tt.mode, tt.scores, func(score *models.KPIScore) float64 {
+				return *score.FinalScore
+			})
+			if total != tt.wantTotal || raw != tt.wantRaw {
+				t.Errorf("calculateTotalScore() = (%v, %v), want (%v, %v)", total, raw, tt.wantTotal, tt.wantRaw)
+			}
+		})
+	}
+}
+
+func TestRawScoreForTotal(t *testing.T) {
+	item := func(id uint, maxScore float64) models.KPIItem {
+		return models.KPIItem{ID: id, Name: "项目", MaxScore: maxScore}
+	}
+
+	tests := []struct {
+		name   string
+		scores []models.KPIScore
+		total  float64
+		want   float64
+	}{
+		{"按满分合计换算回原始分", []models.KPIScore{snapshotScore(item(1, 40), 0), snapshotScore(item(2, 10), 0)}, 70, 35},
+		{"满分合计为100时原始分等于总分", []models.KPIScore{snapshotScore(item(1, 60), 0), snapshotScore(item(2, 40), 0)}, 82.5, 82.5},
+		{"换算结果保留两位小数", []models.KPIScore{snapshotScore(item(1, 30), 0)}, 33.33, 10},
+		{"无法确定满分合计时原始分等于总分", nil, 60, 60},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rawScoreForTotal(tt.scores, tt.total); got != tt.want {
+				t.Errorf("rawScoreForTotal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -12,13 +12,31 @@ import (
 
 // 系统设置响应结构
 type SystemSettingsResponse struct {
-	AllowRegistration bool   `json:"allow_registration"`
-	SystemMode        string `json:"system_mode"` // 系统模式，独立模式: standalone，集成模式: integrated
+	AllowRegistration  bool   `json:"allow_registration"`
+	SystemMode         string `json:"system_mode"`          // 系统模式，独立模式: standalone，集成模式: integrated
+	RemindBeforeHours  int    `json:"remind_before_hours"`  // 截止前多少小时提醒
+	OverdueRemindHours int    `json:"overdue_remind_hours"` // 逾期后每隔多少小时再次提醒
+	EscalationDays     int    `json:"escalation_days"`      // 待主管评估超过多少天后升级，0表示不升级
+	EscalationReview   bool   `json:"escalation_review"`    // 升级接收人是否可以代为完成主管评分
+
+	// 评分校验设置
+	ScoreDecimalPlaces  int `json:"score_decimal_places"`  // 评分允许的小数位数
+	CommentBelowPercent int `json:"comment_below_percent"` // 得分低于满分的百分之多少时必须填写评价，0表示不要求
+	CommentAbovePercent int `json:"comment_above_percent"` // 得分高于满分的百分之多少时必须填写评价，0表示不要求
 }
 
 // 设置更新请求结构
 type UpdateSettingsRequest struct {
-	AllowRegistration bool `json:"allow_registration"`
+	AllowRegistration  *bool `json:"allow_registration"`                             // 不传则保持不变
+	RemindBeforeHours  *int  `json:"remind_before_hours" binding:"omitempty,min=1"`  // 不传则保持不变
+	OverdueRemindHours *int  `json:"overdue_remind_hours" binding:"omitempty,min=1"` // 不传则保持不变
+	EscalationDays     *int  `json:"escalation_days" binding:"omitempty,min=0"`      // 不传则保持不变
+	EscalationReview   *bool `json:"escalation_review"`                              // 不传则保持不变
+
+	// 评分校验设置，不传则保持不变
+	ScoreDecimalPlaces  *int `json:"score_decimal_places" binding:"omitempty,min=0,max=4"`
+	CommentBelowPercent *int `json:"comment_below_percent" binding:"omitempty,min=0,max=100"`
+	CommentAbovePercent *int `json:"comment_above_percent" binding:"omitempty,min=0,max=100"`
 }
 
 // 获取系统设置
@@ -26,17 +44,24 @@ func GetSystemSettings(c *gin.Context) {
 	var settings SystemSettingsResponse
 
 	// 获取注册设置
-	var allowRegistrationSetting models.SystemSetting
-	if err := models.DB.Where("key = ?", "allow_registration").First(&allowRegistrationSetting).Error; err == nil {
-		settings.AllowRegistration = allowRegistrationSetting.Value == "true"
-	} else {
-		// 如果设置不存在，默认为true
-		settings.AllowRegistration = true
-	}
+	settings.AllowRegistration = allowRegistration()
 
 	// 获取系统模式
 	settings.SystemMode = getSystemMode()
 
+	// 获取截止提醒设置
+	settings.RemindBeforeHours = settingHours(settingRemindBeforeHours, 24)
+	settings.OverdueRemindHours = settingHours(settingOverdueRemindHours, 24)
+
+	// 获取升级策略设置
+	settings.EscalationDays, settings.EscalationReview = escalationSettings()
+
+	// 获取评分校验设置
+	scoreRules := loadScoreValidationRules()
+	settings.ScoreDecimalPlaces = scoreRules.DecimalPlaces
+	settings.CommentBelowPercent = scoreRules.CommentBelowPercent
+	settings.CommentAbovePercent = scoreRules.CommentAbovePercent
+
 	c.JSON(http.StatusOK, gin.H{
 		"data": settings,
 	})
@@ -51,39 +76,89 @@ func UpdateSystemSettings(c *gin.Context) {
 	}
 
 	// 更新注册设置
-	allowRegistrationValue := strconv.FormatBool(req.AllowRegistration)
-	var allowRegistrationSetting models.SystemSetting
+	if req.AllowRegistration != nil {
+		if err := SetSetting("allow_registration", strconv.FormatBool(*req.AllowRegistration), "boolean"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新设置失败"})
+			return
+		}
+	}
 
-	// 先查找是否存在
-	if err := models.DB.Where("key = ?", "allow_registration").First(&allowRegistrationSetting).Error; err != nil {
-		// 如果不存在，创建新的设置
-		allowRegistrationSetting = models.SystemSetting{
-			Key:   "allow_registration",
-			Value: allowRegistrationValue,
-			Type:  "boolean",
+	// 更新截止提醒设置
+	if req.RemindBeforeHours != nil {
+		if err := SetSetting(settingRemindBeforeHours, strconv.Itoa(*req.RemindBeforeHours), "number"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新设置失败"})
+			return
 		}
-		if err := models.DB.Create(&allowRegistrationSetting).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建设置失败"})
+	}
+	if req.OverdueRemindHours != nil {
+		if err := SetSetting(settingOverdueRemindHours, strconv.Itoa(*req.OverdueRemindHours), "number"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新设置失败"})
 			return
 		}
-	} else {
-		// 如果存在，更新值
-		allowRegistrationSetting.Value = allowRegistrationValue
-		if err := models.DB.Save(&allowRegistrationSetting).Error; err != nil {
+	}
+
+	// 更新升级策略设置
+	if req.EscalationDays != nil {
+		if err := SetSetting(settingEscalationDays, strconv.Itoa(*req.EscalationDays), "number"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新设置失败"})
+			return
+		}
+	}
+	if req.EscalationReview != nil {
+		if err := SetSetting(settingEscalationAllowReview, strconv.FormatBool(*req.EscalationReview), "boolean"); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新设置失败"})
 			return
 		}
 	}
 
+	// 更新评分校验设置
+	scoreSettings := []struct {
+		key   string
+		value *int
+	}{
+		{settingScoreDecimalPlaces, req.ScoreDecimalPlaces},
+		{settingCommentBelowPercent, req.CommentBelowPercent},
+		{settingCommentAbovePercent, req.CommentAbovePercent},
+	}
+	for _, setting := range scoreSettings {
+		if setting.value == nil {
+			continue
+		}
+		if err := SetSetting(setting.key, strconv.Itoa(*setting.value), "number"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新设置失败"})
+			return
+		}
+	}
+
+	escalationDays, escalationReview := escalationSettings()
+	scoreRules := loadScoreValidationRules()
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "设置更新成功",
 		"data": SystemSettingsResponse{
-			AllowRegistration: req.AllowRegistration,
-			SystemMode:        getSystemMode(),
+			AllowRegistration:  allowRegistration(),
+			SystemMode:         getSystemMode(),
+			RemindBeforeHours:  settingHours(settingRemindBeforeHours, 24),
+			OverdueRemindHours: settingHours(settingOverdueRemindHours, 24),
+			EscalationDays:     escalationDays,
+			EscalationReview:   escalationReview,
+
+			ScoreDecimalPlaces:  scoreRules.DecimalPlaces,
+			CommentBelowPercent: scoreRules.CommentBelowPercent,
+			CommentAbovePercent: scoreRules.CommentAbovePercent,
 		},
 	})
 }
 
+// allowRegistration 是否允许注册，未设置时默认允许
+func allowRegistration() bool {
+	value, err := GetSetting("allow_registration")
+	if err != nil {
+		return true
+	}
+	return value == "true"
+}
+
 // 获取单个设置项（供其他组件使用）
 func GetSetting(key string) (string, error) {
 	var setting models.SystemSetting
@@ -18,6 +18,8 @@ type RecentEvaluation struct {
 	ID         uint           `json:"id"`
 	Employee   RecentEmployee `json:"employee"`
 	TotalScore float64        `json:"total_score"`
+	Grade      string         `json:"grade"`
+	GradeLabel string         `json:"grade_label"`
 	Status     string         `json:"status"`
 	Period     string         `json:"period"`
 	Year       int            `json:"year"`
@@ -52,6 +54,7 @@ func GetDashboardStats(c *gin.Context) {
 		PendingEvaluations   int64              `json:"pending_evaluations"`
 		CompletedEvaluations int64              `json:"completed_evaluations"`
 		AverageScore         float64            `json:"average_score"`
+		GradeDistribution    []GradeCount       `json:"grade_distribution"`
 		RecentEvaluations    []RecentEvaluation `json:"recent_evaluations"`
 	}
 
@@ -90,6 +93,9 @@ func GetDashboardStats(c *gin.Context) {
 	avgQuery := models.DB.Model(&models.KPIEvaluation{}).
 		Joins("JOIN employees ON kpi_evaluations.employee_id = employees.id").
 		Where("employees.is_active = ?", true)
+	gradeQuery := models.DB.Model(&models.KPIEvaluation{}).
+		Joins("JOIN employees ON kpi_evaluations.employee_id = employees.id").
+		Where("employees.is_active = ?", true)
 
 	// 应用相同的时间筛选条件
 	if period != "" {
@@ -97,14 +103,17 @@ func GetDashboardStats(c *gin.Context) {
 			pendingQuery = pendingQuery.Where("period = ? AND year = ? AND month = ?", "monthly", year, month)
 			completedQuery = completedQuery.Where("period = ? AND year = ? AND month = ?", "monthly", year, month)
 			avgQuery = avgQuery.Where("period = ? AND year = ? AND month = ?", "monthly", year, month)
+			gradeQuery = gradeQuery.Where("period = ? AND year = ? AND month = ?", "monthly", year, month)
 		} else if period == "quarterly" && quarter != "" {
 			pendingQuery = pendingQuery.Where("period = ? AND year = ? AND quarter = ?", "quarterly", year, quarter)
 			completedQuery = completedQuery.Where("period = ? AND year = ? AND quarter = ?", "quarterly", year, quarter)
 			avgQuery = avgQuery.Where("period = ? AND year = ? AND quarter = ?", "quarterly", year, quarter)
+			gradeQuery = gradeQuery.Where("period = ? AND year = ? AND quarter = ?", "quarterly", year, quarter)
 		} else if period == "yearly" {
 			pendingQuery = pendingQuery.Where("(period = ? OR period = ?) AND year = ?", "yearly", year, year)
 			completedQuery = completedQuery.Where("(period = ? OR period = ?) AND year = ?", "yearly", year, year)
 			avgQuery = avgQuery.Where("(period = ? OR period = ?) AND year = ?", "yearly", year, year)
+			gradeQuery = gradeQuery.Where("(period = ? OR period = ?) AND year = ?", "yearly", year, year)
 		}
 	}
 
@@ -119,6 +128,9 @@ func GetDashboardStats(c *gin.Context) {
 	avgQuery.Select("AVG(total_score) as avg_score").Where("status = ?", "completed").Scan(&avgResult)
 	stats.AverageScore = avgResult.AvgScore
 
+	// 已完成评估的绩效等级分布
+	stats.GradeDistribution, _ = gradeDistribution(gradeQuery.Where("status = ?", "completed"))
+
 	// 获取最近的评估记录（应用相同的时间筛选，只显示在职员工的评估）
 	var recentEvals []models.KPIEvaluation
 	recentQuery := models.DB.Preload("Employee.Department").Preload("Template").
@@ -148,6 +160,8 @@ func GetDashboardStats(c *gin.Context) {
 				},
 			},
 			TotalScore: eval.TotalScore,
+			Grade:      eval.Grade,
+			GradeLabel: eval.GradeLabel,
 			Status:     eval.Status,
 			Period:     eval.Period,
 			Year:       eval.Year,
@@ -351,30 +365,48 @@ func GetEmployeeStats(c *gin.Context) {
 		})
 	}
 
-	// 获取KPI项目分析
-	var kpiBreakdown []struct {
-		ItemName     string
-		AverageScore float64
-		MaxScore     float64
+	// 获取KPI项目分析：按项目快照把最终得分折算为分值后再求平均，量表和通过制项目不能直接平均原始值
+	var finalScores []models.KPIScore
+	models.DB.Joins("JOIN kpi_evaluations ON kpi_scores.evaluation_id = kpi_evaluations.id").
+		Where("kpi_evaluations.employee_id = ? AND kpi_scores.final_score IS NOT NULL AND kpi_scores.item_name <> ''", employeeId).
+		Order("kpi_scores.id").
+		Find(&finalScores)
+
+	type itemBreakdown struct {
+		name     string
+		total    float64
+		maxScore float64
+		count    int
+	}
+	var itemOrder []uint
+	breakdowns := make(map[uint]*itemBreakdown)
+	for i := range finalScores {
+		score := &finalScores[i]
+		item, ok := scoreItem(score)
+		if !ok || itemScoreType(&item) == scoreTypeText {
+			continue
+		}
+		breakdown, exists := breakdowns[score.ItemID]
+		if !exists {
+			breakdown = &itemBreakdown{name: score.ItemName}
+			breakdowns[score.ItemID] = breakdown
+			itemOrder = append(itemOrder, score.ItemID)
+		}
+		breakdown.total += itemPoints(&item, *score.FinalScore)
+		breakdown.maxScore = item.MaxScore
+		breakdown.count++
 	}
 
-	models.DB.Model(&models.KPIScore{}).
-		Select("kpi_items.name as item_name, AVG(kpi_scores.final_score) as average_score, kpi_items.max_score").
-		Joins("JOIN kpi_items ON kpi_scores.item_id = kpi_items.id").
-		Joins("JOIN kpi_evaluations ON kpi_scores.evaluation_id = kpi_evaluations.id").
-		Where("kpi_evaluations.employee_id = ? AND kpi_scores.final_score IS NOT NULL", employeeId).
-		Group("kpi_items.id, kpi_items.name, kpi_items.max_score").
-		Scan(&kpiBreakdown)
-
-	for _, item := range kpiBreakdown {
+	for _, itemID := range itemOrder {
+		breakdown := breakdowns[itemID]
 		stats.KPIBreakdown = append(stats.KPIBreakdown, struct {
 			ItemName     string  `json:"item_name"`
 			AverageScore float64 `json:"average_score"`
 			MaxScore     float64 `json:"max_score"`
 		}{
-			ItemName:     item.ItemName,
-			AverageScore: item.AverageScore,
-			MaxScore:     item.MaxScore,
+			ItemName:     breakdown.name,
+			AverageScore: breakdown.total / float64(breakdown.count),
+			MaxScore:     breakdown.maxScore,
 		})
 	}
 
@@ -520,6 +552,7 @@ func ExportEvaluation(c *gin.Context) {
 		})
 		return
 	}
+	applyItemSnapshots(evaluation.Scores)
 
 	// 这里应该生成Excel文件，暂时返回JSON数据
 	c.JSON(http.StatusOK, gin.H{
@@ -631,6 +664,8 @@ func GetStatisticsData(c *gin.Context) {
 		Department string  `json:"department"`
 		Template   string  `json:"template"`
 		Score      float64 `json:"score"`
+		Grade      string  `json:"grade"`
+		GradeLabel string  `json:"grade_label"`
 		Status     string  `json:"status"`
 		Period     string  `json:"period"`
 		Year       int     `json:"year"`
@@ -642,6 +677,7 @@ func GetStatisticsData(c *gin.Context) {
 		DepartmentStats   []DepartmentStat   `json:"departmentStats"`
 		MonthlyTrends     []MonthlyTrend     `json:"monthlyTrends"`
 		ScoreDistribution []ScoreDistrib     `json:"scoreDistribution"`
+		GradeDistribution []GradeCount       `json:"gradeDistribution"`
 		TopPerformers     []TopPerformer     `json:"topPerformers"`
 		RecentEvaluations []RecentEvaluation `json:"recentEvaluations"`
 	}
@@ -726,25 +762,25 @@ func GetStatisticsData(c *gin.Context) {
 		response.MonthlyTrends = append(response.MonthlyTrends, trend)
 	}
 
-	// 3. 获取分数分布
+	// 3. 获取分数分布（总分已按计分方式折算到0-100，区间为 [min, max)，最高档包含100分）
 	scoreRanges := []struct {
 		min   float64
 		max   float64
 		label string
 		color string
 	}{
-		{90, 100, "90-100", "#22c55e"},
-		{80, 89, "80-89", "#3b82f6"},
-		{70, 79, "70-79", "#f59e0b"},
-		{60, 69, "60-69", "#ef4444"},
-		{0, 59, "60以下", "#6b7280"},
+		{90, 100.01, "90-100", "#22c55e"},
+		{80, 90, "80-89", "#3b82f6"},
+		{70, 80, "70-79", "#f59e0b"},
+		{60, 70, "60-69", "#ef4444"},
+		{0, 60, "60以下", "#6b7280"},
 	}
 
 	for _, scoreRange := range scoreRanges {
 		var count int64
 		query := models.DB.Model(&models.KPIEvaluation{}).
 			Joins("JOIN employees ON kpi_evaluations.employee_id = employees.id").
-			Where("kpi_evaluations.status = ? AND kpi_evaluations.total_score >= ? AND kpi_evaluations.total_score <= ? AND employees.is_active = ?", "completed", scoreRange.min, scoreRange.max, true)
+			Where("kpi_evaluations.status = ? AND kpi_evaluations.total_score >= ? AND kpi_evaluations.total_score < ? AND employees.is_active = ?", "completed", scoreRange.min, scoreRange.max, true)
 
 		switch period {
 		case "monthly":
@@ -765,6 +801,21 @@ func GetStatisticsData(c *gin.Context) {
 		})
 	}
 
+	// 已完成评估的绩效等级分布（等级在完成时按当时的等级区间确定）
+	gradeQuery := models.DB.Model(&models.KPIEvaluation{}).
+		Joins("JOIN employees ON kpi_evaluations.employee_id = employees.id").
+		Where("kpi_evaluations.status = ? AND employees.is_active = ?", "completed", true)
+	switch period {
+	case "monthly":
+		gradeQuery = gradeQuery.Where("kpi_evaluations.period = ? AND kpi_evaluations.year = ? AND kpi_evaluations.month = ?", "monthly", year, month)
+	case "quarterly":
+		gradeQuery = gradeQuery.Where("kpi_evaluations.period = ? AND kpi_evaluations.year = ? AND kpi_evaluations.quarter = ?", "quarterly", year, quarter)
+	default:
+		// 兼容历史数据格式，支持 period="yearly" 和 period="年份"
+		gradeQuery = gradeQuery.Where("(kpi_evaluations.period = ? OR kpi_evaluations.period = ?) AND kpi_evaluations.year = ?", "yearly", year, year)
+	}
+	response.GradeDistribution, _ = gradeDistribution(gradeQuery)
+
 	// 4. 获取顶级表现者
 	var topPerformers []struct {
 		EmployeeID   uint
@@ -820,6 +871,8 @@ func GetStatisticsData(c *gin.Context) {
 			Department: eval.Employee.Department.Name,
 			Template:   eval.Template.Name,
 			Score:      eval.TotalScore,
+			Grade:      eval.Grade,
+			GradeLabel: eval.GradeLabel,
 			Status:     eval.Status,
 			Period:     eval.Period,
 			Year:       eval.Year,
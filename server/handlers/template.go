@@ -39,6 +39,16 @@ func CreateTemplate(c *gin.Context) {
 		})
 		return
 	}
+	if !validScoringMode(template.ScoringMode) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的计分方式",
+		})
+		return
+	}
+
+	// 新模板尚未发布，发布版本只能通过发布接口生成
+	template.CurrentVersionID = nil
+	template.CurrentVersion = 0
 
 	result := models.DB.Create(&template)
 	if result.Error != nil {
@@ -109,6 +119,17 @@ func UpdateTemplate(c *gin.Context) {
 		return
 	}
 
+	if !validScoringMode(updateData.ScoringMode) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的计分方式",
+		})
+		return
+	}
+
+	// 修改的是模板草稿，发布版本只能通过发布接口变更
+	updateData.CurrentVersionID = nil
+	updateData.CurrentVersion = 0
+
 	result = models.DB.Model(&template).Updates(updateData)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -147,6 +168,13 @@ func DeleteTemplate(c *gin.Context) {
 
 	// 删除模板的同时删除相关的KPI项目
 	models.DB.Where("template_id = ?", templateId).Delete(&models.KPIItem{})
+	models.DB.Where("template_id = ?", templateId).Delete(&models.TemplateAssignment{})
+	models.DB.Where("version_id IN (?)", models.DB.Model(&models.TemplateVersion{}).Select("id").Where("template_id = ?", templateId)).Delete(&models.TemplateVersionItem{})
+	models.DB.Where("template_id = ?", templateId).Delete(&models.TemplateVersion{})
+	models.DB.Where("template_id = ?", templateId).Delete(&models.GradeBand{})
+	models.DB.Where("template_id = ?", templateId).Delete(&models.ApprovalChain{})
+	models.DB.Where("rule_id IN (?)", models.DB.Model(&models.PerformanceRule{}).Select("id").Where("template_id = ?", templateId)).Delete(&models.PerformanceRuleVersion{})
+	models.DB.Where("template_id = ?", templateId).Delete(&models.PerformanceRule{})
 
 	result := models.DB.Delete(&models.KPITemplate{}, templateId)
 	if result.Error != nil {
@@ -188,3 +216,131 @@ func GetTemplateItems(c *gin.Context) {
 		"total": len(items),
 	})
 }
+
+// 模板适用范围更新请求结构
+type UpdateTemplateAssignmentsRequest struct {
+	DepartmentIDs []uint `json:"department_ids"`
+	EmployeeIDs   []uint `json:"employee_ids"`
+}
+
+// 获取模板适用范围
+func GetTemplateAssignments(c *gin.Context) {
+	id := c.Param("id")
+	templateId, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的模板ID",
+		})
+		return
+	}
+
+	var assignments []models.TemplateAssignment
+	result := models.DB.Preload("Department").Preload("Employee").Where("template_id = ?", templateId).Order("id").Find(&assignments)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取模板适用范围失败",
+			"message": result.Error.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  assignments,
+		"total": len(assignments),
+	})
+}
+
+// 更新模板适用范围（整体替换）
+func UpdateTemplateAssignments(c *gin.Context) {
+	id := c.Param("id")
+	templateId, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的模板ID",
+		})
+		return
+	}
+
+	var req UpdateTemplateAssignmentsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var template models.KPITemplate
+	if err := models.DB.First(&template, templateId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "模板不存在",
+		})
+		return
+	}
+
+	tx := models.DB.Begin()
+	if err := tx.Where("template_id = ?", template.ID).Delete(&models.TemplateAssignment{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "更新模板适用范围失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	assignments := []models.TemplateAssignment{}
+	for _, departmentID := range req.DepartmentIDs {
+		departmentID := departmentID
+		assignments = append(assignments, models.TemplateAssignment{TemplateID: template.ID, DepartmentID: &departmentID})
+	}
+	for _, employeeID := range req.EmployeeIDs {
+		employeeID := employeeID
+		assignments = append(assignments, models.TemplateAssignment{TemplateID: template.ID, EmployeeID: &employeeID})
+	}
+	if len(assignments) > 0 {
+		if err := tx.Create(&assignments).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "更新模板适用范围失败",
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	tx.Commit()
+
+	models.DB.Preload("Department").Preload("Employee").Where("template_id = ?", template.ID).Order("id").Find(&assignments)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "模板适用范围更新成功",
+		"data":    assignments,
+	})
+}
+
+// templateAssignedEmployees 获取模板适用范围内的所有在职员工
+func templateAssignedEmployees(templateID uint) ([]models.Employee, error) {
+	var assignments []models.TemplateAssignment
+	if err := models.DB.Where("template_id = ?", templateID).Find(&assignments).Error; err != nil {
+		return nil, err
+	}
+
+	departmentIDs := []uint{0}
+	employeeIDs := []uint{0}
+	for _, assignment := range assignments {
+		if assignment.DepartmentID != nil {
+			departmentIDs = append(departmentIDs, *assignment.DepartmentID)
+		}
+		if assignment.EmployeeID != nil {
+			employeeIDs = append(employeeIDs, *assignment.EmployeeID)
+		}
+	}
+
+	var employees []models.Employee
+	if len(assignments) == 0 {
+		return employees, nil
+	}
+	err := models.DB.Where("is_active = ?", true).
+		Where("department_id IN ? OR id IN ?", departmentIDs, employeeIDs).
+		Order("id").Find(&employees).Error
+	return employees, err
+}
@@ -0,0 +1,478 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"dootask-kpi-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 版本对比中表示草稿的版本参数
+const templateDraftVersion = "draft"
+
+// 发布模板版本请求结构
+type PublishTemplateVersionRequest struct {
+	Changelog string `json:"changelog"`
+}
+
+// 字段变更
+type TemplateFieldChange struct {
+	Field    string      `json:"field"`
+	OldValue interface{} `json:"old_value"`
+	NewValue interface{} `json:"new_value"`
+}
+
+// 考核项目变更
+type TemplateItemChange struct {
+	ItemID  uint                  `json:"item_id"`
+	Name    string                `json:"name"`
+	Changes []TemplateFieldChange `json:"changes"`
+}
+
+// 两个模板版本之间的差异
+type TemplateVersionDiff struct {
+	From          string                       `json:"from"` // 版本号或 draft
+	To            string                       `json:"to"`
+	FieldChanges  []TemplateFieldChange        `json:"field_changes"`
+	AddedItems    []models.TemplateVersionItem `json:"added_items"`
+	RemovedItems  []models.TemplateVersionItem `json:"removed_items"`
+	ModifiedItems []TemplateItemChange         `json:"modified_items"`
+}
+
+// hasChanges 是否存在差异
+func (diff *TemplateVersionDiff) hasChanges() bool {
+	return len(diff.FieldChanges) > 0 || len(diff.AddedItems) > 0 || len(diff.RemovedItems) > 0 || len(diff.ModifiedItems) > 0
+}
+
+// summary 生成变更摘要，如「新增1项、删除1项、修改2项」
+func (diff *TemplateVersionDiff) summary() string {
+	var parts []string
+	if len(diff.FieldChanges) > 0 {
+		parts = append(parts, "修改模板信息")
+	}
+	if len(diff.AddedItems) > 0 {
+		parts = append(parts, fmt.Sprintf("新增%d项", len(diff.AddedItems)))
+	}
+	if len(diff.RemovedItems) > 0 {
+		parts = append(parts, fmt.Sprintf("删除%d项", len(diff.RemovedItems)))
+	}
+	if len(diff.ModifiedItems) > 0 {
+		parts = append(parts, fmt.Sprintf("修改%d项", len(diff.ModifiedItems)))
+	}
+	if len(parts) == 0 {
+		return "无变更"
+	}
+	return strings.Join(parts, "、")
+}
+
+// templateDraft 将模板当前内容（草稿）转换为未保存的版本，用于发布和对比
+func templateDraft(db *gorm.DB, template *models.KPITemplate) (models.TemplateVersion, error) {
+	var items []models.KPIItem
+	if err := db.Where("template_id = ?", template.ID).Order("`order`").Find(&items).Error; err != nil {
+		return models.TemplateVersion{}, err
+	}
+
+	draft := models.TemplateVersion{
+		TemplateID:  template.ID,
+		Name:        template.Name,
+		Description: template.Description,
+		Period:      template.Period,
+		ScoringMode: template.ScoringMode,
+	}
+	for _, item := range items {
+		draft.Items = append(draft.Items, models.TemplateVersionItem{
+			ItemID:      item.ID,
+			Name:        item.Name,
+			Description: item.Description,
+			MaxScore:    item.MaxScore,
+			Weight:      item.Weight,
+			Order:       item.Order,
+
+			ScoreType:    item.ScoreType,
+			ScalePoints:  item.ScalePoints,
+			ScaleAnchors: item.ScaleAnchors,
+
+			QuantitativeTarget: item.QuantitativeTarget,
+		})
+	}
+	return draft, nil
+}
+
+// loadTemplateVersion 按版本参数加载模板版本，draft 表示草稿
+func loadTemplateVersion(template *models.KPITemplate, version string) (models.TemplateVersion, error) {
+	if version == templateDraftVersion {
+		return templateDraft(models.DB, template)
+	}
+	number, err := strconv.Atoi(version)
+	if err != nil || number <= 0 {
+		return models.TemplateVersion{}, fmt.Errorf("无效的版本号：%s", version)
+	}
+	var result models.TemplateVersion
+	err = models.DB.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("`order`")
+	}).Where("template_id = ? AND version = ?", template.ID, number).First(&result).Error
+	if err != nil {
+		return result, fmt.Errorf("版本 %d 不存在", number)
+	}
+	return result, nil
+}
+
+// diffTemplateVersions 对比两个模板版本，考核项目按草稿考核项目ID匹配
+func diffTemplateVersions(from *models.TemplateVersion, to *models.TemplateVersion) TemplateVersionDiff {
+	diff := TemplateVersionDiff{
+		FieldChanges:  []TemplateFieldChange{},
+		AddedItems:    []models.TemplateVersionItem{},
+		RemovedItems:  []models.TemplateVersionItem{},
+		ModifiedItems: []TemplateItemChange{},
+	}
+
+	compare := func(changes []TemplateFieldChange, field string, oldValue interface{}, newValue interface{}) []TemplateFieldChange {
+		if oldValue != newValue {
+			changes = append(changes, TemplateFieldChange{Field: field, OldValue: oldValue, NewValue: newValue})
+		}
+		return changes
+	}
+	diff.FieldChanges = compare(diff.FieldChanges, "name", from.Name, to.Name)
+	diff.FieldChanges = compare(diff.FieldChanges, "description", from.Description, to.Description)
+	diff.FieldChanges = compare(diff.FieldChanges, "period", from.Period, to.Period)
+	diff.FieldChanges = compare(diff.FieldChanges, "scoring_mode", from.ScoringMode, to.ScoringMode)
+
+	fromItems := make(map[uint]models.TemplateVersionItem, len(from.Items))
+	for _, item := range from.Items {
+		fromItems[item.ItemID] = item
+	}
+	for _, item := range to.Items {
+		old, ok := fromItems[item.ItemID]
+		if !ok {
+			diff.AddedItems = append(diff.AddedItems, item)
+			continue
+		}
+		delete(fromItems, item.ItemID)
+
+		var changes []TemplateFieldChange
+		changes = compare(changes, "name", old.Name, item.Name)
+		changes = compare(changes, "description", old.Description, item.Description)
+		changes = compare(changes, "max_score", old.MaxScore, item.MaxScore)
+		changes = compare(changes, "weight", old.Weight, item.Weight)
+		changes = compare(changes, "order", old.Order, item.Order)
+		changes = compare(changes, "score_type", old.ScoreType, item.ScoreType)
+		changes = compare(changes, "scale_points", old.ScalePoints, item.ScalePoints)
+		changes = compare(changes, "scale_anchors", formatScaleAnchors(old.ScaleAnchors), formatScaleAnchors(item.ScaleAnchors))
+		changes = compare(changes, "target_value", old.TargetValue, item.TargetValue)
+		changes = compare(changes, "unit", old.Unit, item.Unit)
+		changes = compare(changes, "scoring_curve", old.ScoringCurve, item.ScoringCurve)
+		changes = compare(changes, "cap_percent", old.CapPercent, item.CapPercent)
+		changes = compare(changes, "curve_steps", formatCurveSteps(old.CurveSteps), formatCurveSteps(item.CurveSteps))
+		if len(changes) > 0 {
+			diff.ModifiedItems = append(diff.ModifiedItems, TemplateItemChange{
+				ItemID:  item.ItemID,
+				Name:    item.Name,
+				Changes: changes,
+			})
+		}
+	}
+	for _, item := range from.Items {
+		if _, ok := fromItems[item.ItemID]; ok {
+			diff.RemovedItems = append(diff.RemovedItems, item)
+		}
+	}
+	return diff
+}
+
+// 创建评估时使用的模板内容
+type evaluationTemplate struct {
+	VersionID   *uint // 模板发布版本，为空表示模板尚未发布
+	ScoringMode string
+	Items       []models.KPIItem
+}
+
+// apply 将模板版本和计分方式记录到评估中
+func (source *evaluationTemplate) apply(evaluation *models.KPIEvaluation) {
+	evaluation.TemplateVersionID = source.VersionID
+	evaluation.ScoringMode = source.ScoringMode
+}
+
+// templateEvaluationSource 返回创建评估时应使用的模板内容
+// 模板已发布时使用当前发布版本，尚未发布时使用草稿中的考核项目
+func templateEvaluationSource(db *gorm.DB, template *models.KPITemplate) (evaluationTemplate, error) {
+	source := evaluationTemplate{ScoringMode: template.ScoringMode}
+	if template.CurrentVersionID == nil {
+		err := db.Where("template_id = ?", template.ID).Order("`order`").Find(&source.Items).Error
+		return source, err
+	}
+
+	var version models.TemplateVersion
+	if err := db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("`order`")
+	}).First(&version, *template.CurrentVersionID).Error; err != nil {
+		return source, err
+	}
+	source.VersionID = &version.ID
+	source.ScoringMode = version.ScoringMode
+	for _, item := range version.Items {
+		source.Items = append(source.Items, models.KPIItem{
+			ID:          item.ItemID,
+			TemplateID:  template.ID,
+			Name:        item.Name,
+			Description: item.Description,
+			MaxScore:    item.MaxScore,
+			Weight:      item.Weight,
+			Order:       item.Order,
+
+			ScoreType:    item.ScoreType,
+			ScalePoints:  item.ScalePoints,
+			ScaleAnchors: item.ScaleAnchors,
+
+			QuantitativeTarget: item.QuantitativeTarget,
+		})
+	}
+	return source, nil
+}
+
+// loadVersionedTemplate 解析路径中的模板ID并加载模板，失败时已返回错误响应
+func loadVersionedTemplate(c *gin.Context) (*models.KPITemplate, bool) {
+	templateId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的模板ID",
+		})
+		return nil, false
+	}
+
+	var template models.KPITemplate
+	if err := models.DB.First(&template, templateId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "模板不存在",
+		})
+		return nil, false
+	}
+	return &template, true
+}
+
+// 获取模板的版本列表（变更日志），按版本号倒序
+func GetTemplateVersions(c *gin.Context) {
+	template, ok := loadVersionedTemplate(c)
+	if !ok {
+		return
+	}
+
+	var versions []models.TemplateVersion
+	if err := models.DB.Preload("PublishedBy").Where("template_id = ?", template.ID).Order("version DESC").Find(&versions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取模板版本失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// 各版本被评估引用的次数
+	var counts []struct {
+		TemplateVersionID uint
+		Count             int64
+	}
+	models.DB.Model(&models.KPIEvaluation{}).
+		Select("template_version_id, COUNT(*) as count").
+		Where("template_id = ? AND template_version_id IS NOT NULL", template.ID).
+		Group("template_version_id").
+		Scan(&counts)
+	evaluationCounts := make(map[uint]int64, len(counts))
+	for _, count := range counts {
+		evaluationCounts[count.TemplateVersionID] = count.Count
+	}
+
+	type versionEntry struct {
+		models.TemplateVersion
+		EvaluationCount int64 `json:"evaluation_count"`
+		IsCurrent       bool  `json:"is_current"`
+	}
+	entries := make([]versionEntry, 0, len(versions))
+	for _, version := range versions {
+		entries = append(entries, versionEntry{
+			TemplateVersion: version,
+			EvaluationCount: evaluationCounts[version.ID],
+			IsCurrent:       template.CurrentVersionID != nil && *template.CurrentVersionID == version.ID,
+		})
+	}
+
+	// 草稿相对当前发布版本是否有未发布的修改
+	hasDraftChanges := true
+	if len(versions) > 0 {
+		current, err := loadTemplateVersion(template, strconv.Itoa(template.CurrentVersion))
+		draft, draftErr := templateDraft(models.DB, template)
+		if err == nil && draftErr == nil {
+			diff := diffTemplateVersions(&current, &draft)
+			hasDraftChanges = diff.hasChanges()
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":              entries,
+		"total":             len(entries),
+		"current_version":   template.CurrentVersion,
+		"has_draft_changes": hasDraftChanges,
+	})
+}
+
+// 获取模板的某个版本，version 为 draft 时返回草稿
+func GetTemplateVersion(c *gin.Context) {
+	template, ok := loadVersionedTemplate(c)
+	if !ok {
+		return
+	}
+
+	version, err := loadTemplateVersion(template, c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": version,
+	})
+}
+
+// 对比模板的两个版本，from 默认为当前发布版本，to 默认为草稿
+func GetTemplateVersionDiff(c *gin.Context) {
+	template, ok := loadVersionedTemplate(c)
+	if !ok {
+		return
+	}
+
+	if template.CurrentVersionID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "模板尚未发布任何版本",
+		})
+		return
+	}
+	fromParam := c.DefaultQuery("from", strconv.Itoa(template.CurrentVersion))
+	toParam := c.DefaultQuery("to", templateDraftVersion)
+
+	from, err := loadTemplateVersion(template, fromParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	to, err := loadTemplateVersion(template, toParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	diff := diffTemplateVersions(&from, &to)
+	diff.From = fromParam
+	diff.To = toParam
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":    diff,
+		"summary": diff.summary(),
+	})
+}
+
+// 将模板草稿发布为新版本，之后新创建的评估使用该版本，已有评估不受影响
+func PublishTemplateVersion(c *gin.Context) {
+	template, ok := loadVersionedTemplate(c)
+	if !ok {
+		return
+	}
+
+	var req PublishTemplateVersionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "请求参数错误",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	tx := models.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	draft, err := templateDraft(tx, template)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "获取KPI项目失败",
+			"message": err.Error(),
+		})
+		return
+	}
+	if len(draft.Items) == 0 {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "模板没有考核项目，无法发布",
+		})
+		return
+	}
+
+	summary := "首次发布"
+	if template.CurrentVersionID != nil {
+		current, err := loadTemplateVersion(template, strconv.Itoa(template.CurrentVersion))
+		if err == nil {
+			diff := diffTemplateVersions(&current, &draft)
+			if !diff.hasChanges() {
+				tx.Rollback()
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "草稿与当前发布版本一致，无需发布",
+				})
+				return
+			}
+			summary = diff.summary()
+		}
+	}
+
+	var latest int
+	tx.Model(&models.TemplateVersion{}).Where("template_id = ?", template.ID).Select("COALESCE(MAX(version), 0)").Scan(&latest)
+
+	draft.Version = latest + 1
+	draft.Changelog = strings.TrimSpace(req.Changelog)
+	draft.Summary = summary
+	draft.PublishedByID = c.GetUint("user_id")
+	if err := tx.Create(&draft).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "发布模板版本失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Model(&models.KPITemplate{}).Where("id = ?", template.ID).Updates(map[string]interface{}{
+		"current_version_id": draft.ID,
+		"current_version":    draft.Version,
+	}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "发布模板版本失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "发布模板版本失败",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": fmt.Sprintf("模板已发布为版本 %d", draft.Version),
+		"data":    draft,
+	})
+}
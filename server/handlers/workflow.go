@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"dootask-kpi-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 评估流程操作
+const (
+	evaluationActionSubmitGoals   = "submit_goals"   // 员工提交目标
+	evaluationActionApproveGoals  = "approve_goals"  // 直属上级审批通过目标（目标锁定）
+	evaluationActionReturnGoals   = "return_goals"   // 直属上级退回目标
+	evaluationActionSubmitSelf    = "submit_self"    // 员工提交自评
+	evaluationActionSubmitManager = "submit_manager" // 直属上级提交评分
+	evaluationActionSubmitHR      = "submit_hr"      // HR完成审核
+	evaluationActionConfirm       = "confirm"        // 员工确认最终结果
+)
+
+// 评估流程中的参与身份
+const (
+	evaluationActorEmployee = "employee" // 被评估员工本人
+	evaluationActorManager  = "manager"  // 被评估员工的直属上级
+	evaluationActorHR       = "hr"       // HR
+)
+
+// evaluationTransition 评估状态流转定义
+type evaluationTransition struct {
+	Action string   `json:"action"`
+	Label  string   `json:"label"`
+	From   string   `json:"from"`
+	To     string   `json:"to"`
+	Actors []string `json:"-"`
+}
+
+// evaluationTransitions 评估状态机：pending → self_evaluated → manager_evaluated → pending_confirm → completed
+// 模板启用目标设定时，评估从 goal_setting 开始：goal_setting → goal_review → pending（goal_review 可退回 goal_setting）
+// 模板或部门配置了审批链时，manager_evaluated 阶段需依次完成各审批步骤后才能进入 pending_confirm
+// manager_evaluated → pending_confirm 也可能由绩效规则自动推进，不经过此处校验
+var evaluationTransitions = []evaluationTransition{
+	{Action: evaluationActionSubmitGoals, Label: "提交目标", From: "goal_setting", To: "goal_review", Actors: []string{evaluationActorEmployee}},
+	{Action: evaluationActionApproveGoals, Label: "确认目标", From: "goal_review", To: "pending", Actors: []string{evaluationActorManager, evaluationActorHR}},
+	{Action: evaluationActionReturnGoals, Label: "退回目标", From: "goal_review", To: "goal_setting", Actors: []string{evaluationActorManager, evaluationActorHR}},
+	{Action: evaluationActionSubmitSelf, Label: "提交自评", From: "pending", To: "self_evaluated", Actors: []string{evaluationActorEmployee}},
+	{Action: evaluationActionSubmitManager, Label: "提交主管评分", From: "self_evaluated", To: "manager_evaluated", Actors: []string{evaluationActorManager}},
+	{Action: evaluationActionSubmitHR, Label: "完成HR审核", From: "manager_evaluated", To: "pending_confirm", Actors: []string{evaluationActorHR}},
+	{Action: evaluationActionConfirm, Label: "确认最终得分", From: "pending_confirm", To: "completed", Actors: []string{evaluationActorEmployee}},
+}
+
+// workflowError 状态流转校验错误，携带对应的HTTP状态码
+type workflowError struct {
+	status  int
+	message string
+}
+
+func (e *workflowError) Error() string {
+	return e.message
+}
+
+// resolveEvaluationActors 计算当前用户在该评估中具备的身份
+// evaluation 需预加载 Employee
+func resolveEvaluationActors(evaluation *models.KPIEvaluation, user *models.Employee) map[string]bool {
+	actors := make(map[string]bool)
+	if evaluation.EmployeeID == user.ID {
+		actors[evaluationActorEmployee] = true
+	}
+	if evaluation.Employee.ManagerID != nil && *evaluation.Employee.ManagerID == user.ID && evaluation.EmployeeID != user.ID {
+		actors[evaluationActorManager] = true
+	}
+	// 直属上级委托期间，受托人可代为完成主管评分
+	if !actors[evaluationActorManager] && evaluation.Employee.ManagerID != nil && evaluation.EmployeeID != user.ID &&
+		activeReviewDelegation(*evaluation.Employee.ManagerID, user.ID, time.Now()) != nil {
+		actors[evaluationActorManager] = true
+	}
+	// 主管评分超时升级后，升级接收人可代为完成主管评分
+	if !actors[evaluationActorManager] && evaluation.Status == "self_evaluated" && evaluation.EmployeeID != user.ID && escalatedReviewer(evaluation.ID, user.ID) {
+		actors[evaluationActorManager] = true
+	}
+	if user.Role == "hr" {
+		actors[evaluationActorHR] = true
+	}
+	return actors
+}
+
+// findEvaluationTransition 查找从 from 到 to 的合法流转
+func findEvaluationTransition(from, to string) (evaluationTransition, bool) {
+	for _, transition := range evaluationTransitions {
+		if transition.From == from && transition.To == to {
+			return transition, true
+		}
+	}
+	return evaluationTransition{}, false
+}
+
+// transitionAllowed 检查用户身份是否满足流转要求，以及当前评估是否满足附加条件
+func transitionAllowed(transition evaluationTransition, evaluation *models.KPIEvaluation, actors map[string]bool) bool {
+	allowed := false
+	for _, actor := range transition.Actors {
+		if actors[actor] {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return false
+	}
+
+	switch transition.Action {
+	case evaluationActionSubmitSelf, evaluationActionSubmitGoals:
+		// 没有直属上级时无法进入主管评分或目标审批阶段
+		return evaluation.Employee.ManagerID != nil
+	case evaluationActionSubmitHR:
+		// 审批链未完成时不能完成HR审核
+		return !approvalPending(evaluation.ID)
+	case evaluationActionConfirm:
+		// 存在未处理的异议时不能确认
+		return !evaluation.HasObjection
+	}
+	return true
+}
+
+// checkEvaluationTransition 校验评估能否由当前用户流转到目标状态
+func checkEvaluationTransition(evaluation *models.KPIEvaluation, user *models.Employee, to string) (evaluationTransition, *workflowError) {
+	transition, ok := findEvaluationTransition(evaluation.Status, to)
+	if !ok {
+		return transition, &workflowError{
+			status:  http.StatusBadRequest,
+			message: fmt.Sprintf("不允许从「%s」变更为「%s」", getStatusText(evaluation.Status), getStatusText(to)),
+		}
+	}
+
+	actors := resolveEvaluationActors(evaluation, user)
+	if !transitionAllowed(transition, evaluation, actors) {
+		if (transition.Action == evaluationActionSubmitSelf || transition.Action == evaluationActionSubmitGoals) && actors[evaluationActorEmployee] {
+			return transition, &workflowError{status: http.StatusBadRequest, message: "暂无直属上级，请联系HR"}
+		}
+		if transition.Action == evaluationActionSubmitHR && actors[evaluationActorHR] {
+			return transition, &workflowError{status: http.StatusBadRequest, message: "审批流程尚未完成，暂不能完成HR审核"}
+		}
+		if transition.Action == evaluationActionConfirm && actors[evaluationActorEmployee] {
+			return transition, &workflowError{status: http.StatusBadRequest, message: "异议尚未处理，暂不能确认"}
+		}
+		return transition, &workflowError{status: http.StatusForbidden, message: fmt.Sprintf("无权执行此操作：%s", transition.Label)}
+	}
+
+	return transition, nil
+}
+
+// availableEvaluationTransitions 返回当前用户可执行的所有流转
+func availableEvaluationTransitions(evaluation *models.KPIEvaluation, user *models.Employee) []evaluationTransition {
+	actors := resolveEvaluationActors(evaluation, user)
+	transitions := []evaluationTransition{}
+	for _, transition := range evaluationTransitions {
+		if transition.From != evaluation.Status {
+			continue
+		}
+		if transitionAllowed(transition, evaluation, actors) {
+			transitions = append(transitions, transition)
+		}
+	}
+	return transitions
+}
+
+// 获取当前用户可执行的评估操作
+func GetEvaluationActions(c *gin.Context) {
+	id := c.Param("id")
+	evaluationId, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的评估ID",
+		})
+		return
+	}
+
+	var evaluation models.KPIEvaluation
+	if err := models.DB.Preload("Employee").First(&evaluation, evaluationId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "评估不存在",
+		})
+		return
+	}
+
+	var user models.Employee
+	if err := models.DB.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "用户不存在",
+		})
+		return
+	}
+
+	// HR可以将评估退回到更早阶段（已完成的评估为重新打开）
+	targets := []string{}
+	if user.Role == "hr" {
+		targets = rollbackTargets(&evaluation)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"status":           evaluation.Status,
+			"actions":          availableEvaluationTransitions(&evaluation, &user),
+			"rollback_targets": targets,
+			"approval":         evaluationApprovalState(&evaluation, &user),
+		},
+	})
+}
@@ -28,7 +28,8 @@ func main() {
 	// 配置CORS
 	config := cors.DefaultConfig()
 	config.AllowAllOrigins = true
-	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", "DooTaskAuth"}
+	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", "DooTaskAuth", "If-Match"}
+	config.ExposeHeaders = []string{"ETag"}
 	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
 	r.Use(cors.New(config))
 
@@ -51,6 +52,15 @@ func main() {
 	handlers.StartSSECleanupTask()
 	handlers.CleanupExportFiles()
 
+	// 启动周期考核定时任务
+	handlers.StartEvaluationScheduler()
+
+	// 启动评估截止提醒任务
+	handlers.StartDeadlineReminderTask()
+
+	// 启动主管评分超时升级任务
+	handlers.StartEscalationTask()
+
 	log.Println("KPI系统服务器启动在端口 :8080")
 	log.Fatal(r.Run(":8080"))
 }
@@ -7,11 +7,16 @@ import (
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
 var DB *gorm.DB
 
+// 评估唯一索引名称
+const evaluationUniqueIndex = "idx_kpi_evaluations_unique_period"
+
 // 初始化数据库连接
 func InitDB() {
 	var err error
@@ -29,25 +34,180 @@ func InitDB() {
 
 	log.Println("数据库连接成功")
 
+	// 评估和评分每次更新时自动递增版本号
+	if err := DB.Callback().Update().Before("gorm:update").Register("kpi:increment_version", incrementVersion); err != nil {
+		log.Fatal("注册版本号回调失败:", err)
+	}
+	if err := DB.Callback().Update().After("gorm:update").Register("kpi:increment_version_cleanup", cleanupVersionAssignments); err != nil {
+		log.Fatal("注册版本号回调失败:", err)
+	}
+
 	// 自动迁移数据库表
 	err = DB.AutoMigrate(
 		&Department{},
 		&Employee{},
 		&KPITemplate{},
+		&TemplateVersion{},
+		&TemplateVersionItem{},
+		&TemplateAssignment{},
 		&KPIItem{},
 		&KPIEvaluation{},
 		&KPIScore{},
 		&EvaluationComment{},
+		&EvaluationHistory{},
+		&EvaluationReminder{},
+		&EvaluationEscalation{},
+		&ReviewDelegation{},
 		&EvaluationInvitation{},
 		&InvitedScore{},
 		&SystemSetting{},
 		&PerformanceRule{},
+		&PerformanceRuleVersion{},
+		&EvaluationSchedule{},
+		&EvaluationScheduleRun{},
+		&Objective{},
+		&KeyResult{},
+		&KeyResultCheckIn{},
+		&EvaluationGoal{},
+		&GradeBand{},
+		&DistributionQuota{},
+		&CalibrationSession{},
+		&CalibrationEvaluation{},
+		&CalibrationAdjustment{},
+		&ApprovalChain{},
+		&EvaluationApproval{},
 	)
 	if err != nil {
 		log.Fatal("数据库迁移失败:", err)
 	}
 
 	log.Println("数据库表迁移完成")
+
+	// 同一员工、同一模板、同一考核周期只允许一份评估
+	// 已存在重复评估时无法创建唯一索引，需由HR处理重复评估后再次创建
+	if err := EnsureEvaluationUniqueIndex(); err != nil {
+		log.Println("评估唯一索引创建失败，请先处理重复评估:", err)
+	}
+
+	// 为快照功能上线前创建的评分补全考核项目快照（使用考核项目的当前值）
+	if err := backfillItemSnapshots(); err != nil {
+		log.Println("补全考核项目快照失败:", err)
+	}
+
+	// 为规则版本上线前创建的绩效规则补全初始版本，自规则创建时起生效
+	if err := backfillPerformanceRuleVersions(); err != nil {
+		log.Println("补全绩效规则版本失败:", err)
+	}
+
+	// 计分方式上线前的总分即为原始分合计，补全到原始得分，并将总分折算到0-100
+	if err := backfillNormalizedTotalScores(); err != nil {
+		log.Println("补全原始得分失败:", err)
+	}
+}
+
+// backfillItemSnapshots 为没有考核项目快照的评分记录补全快照，考核项目已删除的无法补全
+func backfillItemSnapshots() error {
+	return DB.Exec(`UPDATE kpi_scores SET
+		item_name = (SELECT name FROM kpi_items WHERE kpi_items.id = kpi_scores.item_id),
+		item_description = (SELECT description FROM kpi_items WHERE kpi_items.id = kpi_scores.item_id),
+		item_max_score = (SELECT max_score FROM kpi_items WHERE kpi_items.id = kpi_scores.item_id),
+		item_order = (SELECT "order" FROM kpi_items WHERE kpi_items.id = kpi_scores.item_id)
+		WHERE (item_name IS NULL OR item_name = '') AND item_id IN (SELECT id FROM kpi_items)`).Error
+}
+
+// backfillPerformanceRuleVersions 为没有任何版本的绩效规则按当前权重创建第1版
+func backfillPerformanceRuleVersions() error {
+	return DB.Exec(`INSERT INTO performance_rule_versions (rule_id, version,
+		no_invitation_self_weight, no_invitation_superior_weight,
+		with_invitation_employee_self_weight, with_invitation_employee_invite_superior_weight, with_invitation_employee_superior_weight,
+		effective_from, created_at)
+		SELECT id, 1,
+		no_invitation_self_weight, no_invitation_superior_weight,
+		with_invitation_employee_self_weight, with_invitation_employee_invite_superior_weight, with_invitation_employee_superior_weight,
+		created_at, created_at
+		FROM performance_rules WHERE id NOT IN (SELECT rule_id FROM performance_rule_versions)`).Error
+}
+
+// 计分方式上线时折算总分的迁移标记，记录在系统设置中，保证折算只执行一次
+const normalizedTotalScoresMigration = "migration_normalized_total_scores"
+
+// backfillNormalizedTotalScores 将计分方式上线前的总分（原始分合计）写入原始得分，并按评分记录的满分快照合计折算到0-100
+// 已按旧方式补全过（原始得分与总分相同）的评估同样折算；满分合计为100或无法确定满分合计的只补全原始得分
+// 折算只执行一次：此后的总分均已在0-100，再次执行会把HR调整的总分或原始分恰好等于总分的评估重复折算
+func backfillNormalizedTotalScores() error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var done int64
+		if err := tx.Model(&SystemSetting{}).Where("key = ?", normalizedTotalScoresMigration).Count(&done).Error; err != nil {
+			return err
+		}
+		if done > 0 {
+			return nil
+		}
+
+		const maxScoreSum = "(SELECT SUM(item_max_score) FROM kpi_scores WHERE kpi_scores.evaluation_id = kpi_evaluations.id)"
+		if err := tx.Exec(`UPDATE kpi_evaluations SET raw_score = total_score,
+			total_score = ROUND(total_score * 100.0 / ` + maxScoreSum + `, 2)
+			WHERE total_score <> 0 AND (raw_score IS NULL OR raw_score = 0 OR raw_score = total_score)
+			AND (scoring_mode IS NULL OR scoring_mode IN ('', 'sum'))
+			AND ` + maxScoreSum + ` > 0 AND ` + maxScoreSum + ` <> 100`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("UPDATE kpi_evaluations SET raw_score = total_score WHERE (raw_score IS NULL OR raw_score = 0) AND total_score <> 0").Error; err != nil {
+			return err
+		}
+		return tx.Create(&SystemSetting{Key: normalizedTotalScoresMigration, Value: "done", Type: "string"}).Error
+	})
+}
+
+// EnsureEvaluationUniqueIndex 创建评估的唯一索引（员工 + 模板 + 年 + 月 + 季度）
+// 月份和季度可能为空，SQLite 中 NULL 互不相等，因此按 0 参与唯一性判断
+func EnsureEvaluationUniqueIndex() error {
+	return DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS " + evaluationUniqueIndex + " ON kpi_evaluations (employee_id, template_id, year, COALESCE(month, 0), COALESCE(quarter, 0))").Error
+}
+
+// EvaluationUniqueIndexExists 检查评估唯一索引是否已创建
+func EvaluationUniqueIndexExists() bool {
+	var count int64
+	DB.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = ?", evaluationUniqueIndex).Scan(&count)
+	return count > 0
+}
+
+// versionedTables 启用乐观锁版本号的表
+var versionedTables = map[string]bool{
+	"kpi_evaluations": true,
+	"kpi_scores":      true,
+}
+
+// incrementVersion 在更新语句中追加 version = version + 1
+// 提前生成 SET 子句（与 gorm:update 的生成方式一致），使 Update、Updates 的 map 和结构体写法都能生效
+func incrementVersion(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil || !versionedTables[db.Statement.Schema.Table] {
+		return
+	}
+	if _, ok := db.Statement.Clauses["SET"]; ok {
+		return
+	}
+
+	set := callbacks.ConvertToAssignments(db.Statement)
+	if len(set) == 0 {
+		return
+	}
+	assignments := make(clause.Set, 0, len(set)+1)
+	for _, assignment := range set {
+		if assignment.Column.Name != "version" {
+			assignments = append(assignments, assignment)
+		}
+	}
+	assignments = append(assignments, clause.Assignment{Column: clause.Column{Name: "version"}, Value: gorm.Expr("version + 1")})
+	db.Statement.AddClause(assignments)
+	db.InstanceSet("kpi:version_set", true)
+}
+
+// cleanupVersionAssignments 更新完成后移除 incrementVersion 生成的 SET 子句，避免复用语句时残留
+func cleanupVersionAssignments(db *gorm.DB) {
+	if _, ok := db.InstanceGet("kpi:version_set"); ok {
+		delete(db.Statement.Clauses, "SET")
+	}
 }
 
 // 创建测试数据
@@ -73,6 +233,7 @@ func CreateTestData() {
 	}
 	CreateTestDataForTemplate()
 	CreateTestDataForPerformanceRule()
+	CreateTestDataForGradeBands()
 
 	log.Println("测试数据创建完成")
 }
@@ -164,13 +325,26 @@ func CreateTestDataForTemplate() {
 // 创建测试数据（绩效规则）
 func CreateTestDataForPerformanceRule() {
 	var count int64
-	DB.Model(&PerformanceRule{}).Count(&count)
+	DB.Model(&PerformanceRule{}).Where("template_id IS NULL AND department_id IS NULL").Count(&count)
 	if count > 0 {
 		return
 	}
 
 	defaultRule := DefaultPerformanceRule()
 	DB.Create(&defaultRule)
+	backfillPerformanceRuleVersions()
+}
+
+// 创建测试数据（组织默认绩效等级）
+func CreateTestDataForGradeBands() {
+	var count int64
+	DB.Model(&GradeBand{}).Where("template_id IS NULL").Count(&count)
+	if count > 0 {
+		return
+	}
+
+	bands := DefaultGradeBands()
+	DB.Create(&bands)
 }
 
 // 辅助函数：获取uint指针
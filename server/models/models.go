@@ -39,18 +39,83 @@ type Employee struct {
 
 // KPI模板模型
 type KPITemplate struct {
-	ID          uint      `json:"id" gorm:"primaryKey"`
-	Name        string    `json:"name" gorm:"not null"`
-	Description string    `json:"description"`
-	Period      string    `json:"period"` // monthly, quarterly, yearly
-	IsActive    bool      `json:"is_active" gorm:"default:true"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	Name        string `json:"name" gorm:"not null"`
+	Description string `json:"description"`
+	Period      string `json:"period"` // monthly, quarterly, yearly
+	IsActive    bool   `json:"is_active" gorm:"default:true"`
+	ScoringMode string `json:"scoring_mode" gorm:"default:sum"` // 计分方式：sum 原始分合计, weighted 加权百分比
+
+	GoalSetting *bool `json:"goal_setting" gorm:"default:false"` // 是否在自评前增加目标设定阶段（员工提出目标，直属上级审批）
+
+	// 各阶段默认截止天数（从评估进入该阶段时起算，为空或0表示不设截止时间）
+	SelfDeadlineDays    *int `json:"self_deadline_days"`    // 员工自评
+	ManagerDeadlineDays *int `json:"manager_deadline_days"` // 主管评分
+	HRDeadlineDays      *int `json:"hr_deadline_days"`      // HR审核
+	ConfirmDeadlineDays *int `json:"confirm_deadline_days"` // 员工确认
+
+	// 当前发布版本（为空表示尚未发布，创建评估时直接使用草稿中的考核项目）
+	// 模板本身及其考核项目即为草稿，修改后需发布为新版本才会用于新创建的评估
+	CurrentVersionID *uint `json:"current_version_id"`
+	CurrentVersion   int   `json:"current_version"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 
 	// 关联关系
 	Items []KPIItem `json:"items,omitempty" gorm:"foreignKey:TemplateID"`
 }
 
+// 模板发布版本模型（发布后不可修改，评估引用创建时的发布版本）
+type TemplateVersion struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	TemplateID    uint      `json:"template_id" gorm:"uniqueIndex:idx_template_versions_version"`
+	Version       int       `json:"version" gorm:"uniqueIndex:idx_template_versions_version"` // 版本号，从1开始递增
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	Period        string    `json:"period"`
+	ScoringMode   string    `json:"scoring_mode" gorm:"default:sum"`
+	Changelog     string    `json:"changelog"` // 发布说明
+	Summary       string    `json:"summary"`   // 与上一版本相比的变更摘要（自动生成）
+	PublishedByID uint      `json:"published_by_id"`
+	CreatedAt     time.Time `json:"created_at"`
+
+	// 关联关系
+	Items       []TemplateVersionItem `json:"items,omitempty" gorm:"foreignKey:VersionID"`
+	PublishedBy *Employee             `json:"published_by,omitempty" gorm:"foreignKey:PublishedByID"`
+}
+
+// 模板发布版本中的考核项目
+type TemplateVersionItem struct {
+	ID          uint    `json:"id" gorm:"primaryKey"`
+	VersionID   uint    `json:"version_id" gorm:"index"`
+	ItemID      uint    `json:"item_id"` // 发布时对应的草稿考核项目，用于版本对比和评分记录关联
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	MaxScore    float64 `json:"max_score"`
+	Weight      float64 `json:"weight"`
+	Order       int     `json:"order"`
+
+	ScoreType    string        `json:"score_type"`
+	ScalePoints  int           `json:"scale_points"`
+	ScaleAnchors []ScaleAnchor `json:"scale_anchors" gorm:"serializer:json"`
+
+	QuantitativeTarget
+}
+
+// 模板适用范围模型（按部门或按员工，用于周期自动开启考核）
+type TemplateAssignment struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	TemplateID   uint      `json:"template_id" gorm:"index"`
+	DepartmentID *uint     `json:"department_id,omitempty"` // 适用部门（部门内所有在职员工）
+	EmployeeID   *uint     `json:"employee_id,omitempty"`   // 适用员工
+	CreatedAt    time.Time `json:"created_at"`
+
+	// 关联关系
+	Department *Department `json:"department,omitempty" gorm:"foreignKey:DepartmentID"`
+	Employee   *Employee   `json:"employee,omitempty" gorm:"foreignKey:EmployeeID"`
+}
+
 // KPI考核项目模型
 type KPIItem struct {
 	ID          uint      `json:"id" gorm:"primaryKey"`
@@ -58,35 +123,94 @@ type KPIItem struct {
 	Name        string    `json:"name" gorm:"not null"`
 	Description string    `json:"description"`
 	MaxScore    float64   `json:"max_score"` // 满分
+	Weight      float64   `json:"weight"`    // 权重（加权计分时使用，按各项目权重占比折算，不要求合计为100）
 	Order       int       `json:"order"`     // 排序
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 
+	// 评分类型：numeric 数值（0到满分）, scale 等级量表（1到N级）, pass_fail 通过/不通过, text 文字评价（不计分）
+	ScoreType    string        `json:"score_type" gorm:"default:numeric"`
+	ScalePoints  int           `json:"scale_points"`                         // 等级量表的级数，如5表示1-5级
+	ScaleAnchors []ScaleAnchor `json:"scale_anchors" gorm:"serializer:json"` // 等级量表各级的名称和行为描述
+
+	// 量化指标配置（评分类型为 quantitative 时使用）
+	QuantitativeTarget
+
 	// 关联关系
 	Template KPITemplate `json:"template,omitempty" gorm:"foreignKey:TemplateID"`
 }
 
+// 量化指标配置：按实际完成值相对目标值的完成率，以计分曲线自动计算得分
+type QuantitativeTarget struct {
+	TargetValue  float64     `json:"target_value"`                       // 目标值
+	Unit         string      `json:"unit"`                               // 单位，如 万元、个
+	ScoringCurve string      `json:"scoring_curve"`                      // 计分曲线：linear 线性, steps 阶梯, capped 超额封顶
+	CapPercent   float64     `json:"cap_percent"`                        // 超额封顶的最高完成率（%），如120表示最多按120%计分
+	CurveSteps   []CurveStep `json:"curve_steps" gorm:"serializer:json"` // 阶梯计分的档位
+}
+
+// 阶梯计分档位：完成率达到 MinPercent 时得分为满分的 ScorePercent
+type CurveStep struct {
+	MinPercent   float64 `json:"min_percent"`
+	ScorePercent float64 `json:"score_percent"`
+}
+
+// 等级量表锚点（某一级的名称和行为描述）
+type ScaleAnchor struct {
+	Value       int    `json:"value"`
+	Label       string `json:"label"`
+	Description string `json:"description"`
+}
+
 // KPI评估记录模型
 type KPIEvaluation struct {
-	ID              uint      `json:"id" gorm:"primaryKey"`
-	EmployeeID      uint      `json:"employee_id"`
-	TemplateID      uint      `json:"template_id"`
-	Period          string    `json:"period"` // 2024-01, 2024-Q1, 2024
-	Year            int       `json:"year"`
-	Month           *int      `json:"month,omitempty"`
-	Quarter         *int      `json:"quarter,omitempty"`
-	Status          string    `json:"status" gorm:"default:pending"` // pending, self_evaluated, manager_evaluated, pending_confirm, completed
-	TotalScore      float64   `json:"total_score"`
-	FinalComment    string    `json:"final_comment"`
-	HasObjection    bool      `json:"has_objection" gorm:"default:false"` // 是否有异议
-	ObjectionReason string    `json:"objection_reason"`                   // 异议原因（员工填写）
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
+	ID              uint    `json:"id" gorm:"primaryKey"`
+	EmployeeID      uint    `json:"employee_id"`
+	TemplateID      uint    `json:"template_id"`
+	Period          string  `json:"period"` // 2024-01, 2024-Q1, 2024
+	Year            int     `json:"year"`
+	Month           *int    `json:"month,omitempty"`
+	Quarter         *int    `json:"quarter,omitempty"`
+	Status          string  `json:"status" gorm:"default:pending"` // pending, self_evaluated, manager_evaluated, pending_confirm, completed
+	TotalScore      float64 `json:"total_score"`
+	FinalComment    string  `json:"final_comment"`
+	HasObjection    bool    `json:"has_objection" gorm:"default:false"` // 是否有异议
+	ObjectionReason string  `json:"objection_reason"`                   // 异议原因（员工填写）
+
+	// 各阶段截止时间（为空表示不设截止时间）
+	SelfDeadline    *time.Time `json:"self_deadline,omitempty"`    // 员工自评（pending）
+	ManagerDeadline *time.Time `json:"manager_deadline,omitempty"` // 主管评分（self_evaluated）
+	HRDeadline      *time.Time `json:"hr_deadline,omitempty"`      // HR审核（manager_evaluated）
+	ConfirmDeadline *time.Time `json:"confirm_deadline,omitempty"` // 员工确认（pending_confirm）
+
+	Version uint `json:"version" gorm:"not null;default:1"` // 版本号，每次更新自动递增（乐观锁）
+
+	TemplateVersionID *uint `json:"template_version_id,omitempty"` // 创建时使用的模板发布版本，为空表示模板当时尚未发布
+
+	// 计分方式（TotalScore 统一折算到0-100，便于不同模板之间比较）
+	ScoringMode string  `json:"scoring_mode" gorm:"default:sum"` // 创建时模板的计分方式
+	RawScore    float64 `json:"raw_score"`                       // 各项目得分合计（未折算）
+
+	// 目标设定阶段审批通过后锁定目标
+	GoalsApprovedAt   *time.Time `json:"goals_approved_at,omitempty"`
+	GoalsApprovedByID *uint      `json:"goals_approved_by_id,omitempty"`
+
+	// 绩效等级：完成时按等级区间由最终得分确定，之后修改等级区间不影响已完成的评估
+	Grade      string `json:"grade" gorm:"index"`
+	GradeLabel string `json:"grade_label"`
+
+	// 自动计算HR评分时采用的绩效规则版本及计算依据
+	PerformanceRuleVersionID *uint                   `json:"performance_rule_version_id,omitempty" gorm:"index"`
+	AppliedRule              *AppliedPerformanceRule `json:"applied_rule,omitempty" gorm:"serializer:json"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 
 	// 关联关系
-	Employee Employee    `json:"employee,omitempty" gorm:"foreignKey:EmployeeID"`
-	Template KPITemplate `json:"template,omitempty" gorm:"foreignKey:TemplateID"`
-	Scores   []KPIScore  `json:"scores,omitempty" gorm:"foreignKey:EvaluationID"`
+	Employee    Employee               `json:"employee,omitempty" gorm:"foreignKey:EmployeeID"`
+	Template    KPITemplate            `json:"template,omitempty" gorm:"foreignKey:TemplateID"`
+	Scores      []KPIScore             `json:"scores,omitempty" gorm:"foreignKey:EvaluationID"`
+	Escalations []EvaluationEscalation `json:"escalations,omitempty" gorm:"foreignKey:EvaluationID"`
 }
 
 // KPI具体得分模型
@@ -106,6 +230,30 @@ type KPIScore struct {
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
 
+	// 代为评分信息（委托或升级时记录）
+	ManagerReviewerID   *uint `json:"manager_reviewer_id,omitempty"`     // 实际填写上级评分的人
+	ManagerOnBehalfOfID *uint `json:"manager_on_behalf_of_id,omitempty"` // 被代理的直属上级
+
+	// 创建评估时的考核项目快照，修改或删除考核项目不影响已创建的评估
+	ItemName         string        `json:"item_name"`
+	ItemDescription  string        `json:"item_description"`
+	ItemMaxScore     float64       `json:"item_max_score"`
+	ItemWeight       float64       `json:"item_weight"`
+	ItemOrder        int           `json:"item_order"`
+	ItemScoreType    string        `json:"item_score_type"`
+	ItemScalePoints  int           `json:"item_scale_points"`
+	ItemScaleAnchors []ScaleAnchor `json:"item_scale_anchors" gorm:"serializer:json"`
+
+	ItemTarget QuantitativeTarget `json:"item_target" gorm:"embedded;embeddedPrefix:item_"`
+
+	// 量化指标的实际完成值及按计分曲线自动计算的得分（各评分人的评分作为调整值）
+	ActualValue *float64 `json:"actual_value"`
+	AutoScore   *float64 `json:"auto_score"`
+
+	Goal string `json:"goal"` // 目标设定阶段约定的个人目标，审批通过后锁定
+
+	Version uint `json:"version" gorm:"not null;default:1"` // 版本号，每次更新自动递增（乐观锁）
+
 	// 关联关系
 	Evaluation KPIEvaluation `json:"evaluation,omitempty" gorm:"foreignKey:EvaluationID"`
 	Item       KPIItem       `json:"item,omitempty" gorm:"foreignKey:ItemID"`
@@ -118,12 +266,33 @@ type EvaluationComment struct {
 	UserID       uint      `json:"user_id"` // 评论者ID
 	Content      string    `json:"content" gorm:"not null"`
 	IsPrivate    bool      `json:"is_private" gorm:"default:false"` // 是否仅自己可见
+	OnBehalfOfID *uint     `json:"on_behalf_of_id,omitempty"`       // 代为评审时被代理的直属上级
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 
 	// 关联关系
 	Evaluation KPIEvaluation `json:"evaluation,omitempty" gorm:"foreignKey:EvaluationID"`
 	User       Employee      `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	OnBehalfOf *Employee     `json:"on_behalf_of,omitempty" gorm:"foreignKey:OnBehalfOfID"`
+}
+
+// 评估变更历史模型（只追加，不修改、不删除）
+type EvaluationHistory struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	EvaluationID uint      `json:"evaluation_id" gorm:"index"`
+	ScoreID      *uint     `json:"score_id,omitempty"`      // 关联的评分记录（评分变更时）
+	ItemID       *uint     `json:"item_id,omitempty"`       // 关联的考核项目（评分变更时）
+	InvitationID *uint     `json:"invitation_id,omitempty"` // 关联的邀请（邀请相关变更时）
+	ActorID      uint      `json:"actor_id"`                // 操作人ID，0表示系统自动
+	Source       string    `json:"source"`                  // 变更来源：self_score, manager_score, hr_score, final_score, evaluation, objection, invitation, performance_rule
+	Field        string    `json:"field"`                   // 变更字段
+	OldValue     string    `json:"old_value"`               // 变更前的值
+	NewValue     string    `json:"new_value"`               // 变更后的值
+	CreatedAt    time.Time `json:"created_at"`
+
+	// 关联关系
+	Actor *Employee `json:"actor,omitempty" gorm:"foreignKey:ActorID"`
+	Item  *KPIItem  `json:"item,omitempty" gorm:"foreignKey:ItemID"`
 }
 
 // 系统设置模型
@@ -169,14 +338,22 @@ type InvitedScore struct {
 	Item       KPIItem              `json:"item,omitempty" gorm:"foreignKey:ItemID"`
 }
 
-// 绩效评分规则模型
+// 绩效评分规则模型：模板和部门都为空的为组织默认规则，其余规则适用于指定的模板和/或部门
+// 权重为最近一次保存的配置，自动计算时按生效时间采用对应的规则版本（见 PerformanceRuleVersion）
 type PerformanceRule struct {
 	ID             uint                        `json:"id" gorm:"primaryKey"`
+	Name           string                      `json:"name" gorm:"not null;default:默认规则"`
+	TemplateID     *uint                       `json:"template_id,omitempty" gorm:"index"`
+	DepartmentID   *uint                       `json:"department_id,omitempty" gorm:"index"`
 	NoInvitation   PerformanceRuleNoInvitation `json:"no_invitation" gorm:"embedded;embeddedPrefix:no_invitation_"`
 	WithInvitation PerformanceRuleWithInvite   `json:"with_invitation" gorm:"embedded;embeddedPrefix:with_invitation_"`
 	Enabled        bool                        `json:"enabled" gorm:"not null;default:false"`
 	CreatedAt      time.Time                   `json:"created_at"`
 	UpdatedAt      time.Time                   `json:"updated_at"`
+
+	// 关联关系
+	Template   *KPITemplate `json:"template,omitempty" gorm:"foreignKey:TemplateID"`
+	Department *Department  `json:"department,omitempty" gorm:"foreignKey:DepartmentID"`
 }
 
 // 无邀请评分规则
@@ -190,6 +367,47 @@ type PerformanceRuleWithInvite struct {
 	Employee PerformanceRuleEmployee `json:"employee" gorm:"embedded;embeddedPrefix:employee_"`
 }
 
+// 绩效评分规则版本：每次修改权重生成新版本，自生效时间起用于自动计算HR评分
+type PerformanceRuleVersion struct {
+	ID             uint                        `json:"id" gorm:"primaryKey"`
+	RuleID         uint                        `json:"rule_id" gorm:"uniqueIndex:idx_performance_rule_version"`
+	Version        int                         `json:"version" gorm:"uniqueIndex:idx_performance_rule_version"`
+	NoInvitation   PerformanceRuleNoInvitation `json:"no_invitation" gorm:"embedded;embeddedPrefix:no_invitation_"`
+	WithInvitation PerformanceRuleWithInvite   `json:"with_invitation" gorm:"embedded;embeddedPrefix:with_invitation_"`
+	EffectiveFrom  time.Time                   `json:"effective_from" gorm:"index"`
+	CreatedByID    *uint                       `json:"created_by_id,omitempty"`
+	CreatedAt      time.Time                   `json:"created_at"`
+
+	// 关联关系
+	CreatedBy *Employee `json:"created_by,omitempty" gorm:"foreignKey:CreatedByID"`
+}
+
+// 评估实际采用的绩效规则快照：规则版本、所用权重及各考核项目的计算依据
+type AppliedPerformanceRule struct {
+	RuleID         uint                  `json:"rule_id"`
+	RuleName       string                `json:"rule_name"`
+	VersionID      uint                  `json:"version_id"`
+	Version        int                   `json:"version"`
+	EffectiveFrom  time.Time             `json:"effective_from"`
+	Scenario       string                `json:"scenario"` // no_invitation: 无邀请评分, employee_invitation: 有邀请评分
+	SelfWeight     float64               `json:"self_weight"`
+	InviteWeight   float64               `json:"invite_weight"` // 无邀请评分时为0
+	SuperiorWeight float64               `json:"superior_weight"`
+	Items          []AppliedRuleItemCalc `json:"items"`
+	AppliedAt      time.Time             `json:"applied_at"`
+}
+
+// 单个考核项目按绩效规则计算HR评分的依据
+type AppliedRuleItemCalc struct {
+	ScoreID      uint     `json:"score_id"`
+	ItemName     string   `json:"item_name"`
+	SelfScore    *float64 `json:"self_score"`
+	InviteScore  *float64 `json:"invite_score"` // 邀请评分的平均分
+	InviteCount  int      `json:"invite_count"`
+	ManagerScore *float64 `json:"manager_score"`
+	HRScore      *float64 `json:"hr_score"` // 缺少评分无法计算时为空
+}
+
 // 员工邀请评分规则
 type PerformanceRuleEmployee struct {
 	SelfWeight           float64 `json:"self_weight" gorm:"not null;default:10"`
@@ -200,6 +418,7 @@ type PerformanceRuleEmployee struct {
 // DefaultPerformanceRule 返回默认绩效规则配置
 func DefaultPerformanceRule() PerformanceRule {
 	return PerformanceRule{
+		Name:    "默认规则",
 		Enabled: false,
 		NoInvitation: PerformanceRuleNoInvitation{
 			SelfWeight:     10,
@@ -214,3 +433,323 @@ func DefaultPerformanceRule() PerformanceRule {
 		},
 	}
 }
+
+// 评估截止提醒发送记录（用于避免重复提醒）
+type EvaluationReminder struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	EvaluationID uint      `json:"evaluation_id" gorm:"index"`
+	Status       string    `json:"status"`   // 提醒时评估所处阶段
+	Kind         string    `json:"kind"`     // before: 到期前提醒, overdue: 逾期提醒
+	Deadline     time.Time `json:"deadline"` // 提醒对应的截止时间，截止时间调整后重新提醒
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// 评审委托（主管请假期间委托他人代为完成主管评分）
+type ReviewDelegation struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	DelegatorID uint      `json:"delegator_id" gorm:"index"` // 委托人（主管）
+	DelegateID  uint      `json:"delegate_id" gorm:"index"`  // 受托人
+	StartAt     time.Time `json:"start_at"`                  // 委托开始时间
+	EndAt       time.Time `json:"end_at"`                    // 委托结束时间
+	Reason      string    `json:"reason"`
+	CreatedByID uint      `json:"created_by_id"` // 创建人（主管本人或HR）
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// 关联关系
+	Delegator *Employee `json:"delegator,omitempty" gorm:"foreignKey:DelegatorID"`
+	Delegate  *Employee `json:"delegate,omitempty" gorm:"foreignKey:DelegateID"`
+	CreatedBy *Employee `json:"created_by,omitempty" gorm:"foreignKey:CreatedByID"`
+}
+
+// 评估升级记录（主管长时间未评分时升级给上级的上级）
+type EvaluationEscalation struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	EvaluationID    uint      `json:"evaluation_id" gorm:"index"`
+	Status          string    `json:"status"`            // 升级时评估所处阶段
+	Level           int       `json:"level"`             // 升级层级，1表示上级的上级
+	DirectManagerID *uint     `json:"direct_manager_id"` // 原直属上级
+	EscalatedToID   uint      `json:"escalated_to_id"`   // 升级接收人
+	CanReview       bool      `json:"can_review"`        // 接收人是否可以代为完成主管评分
+	CreatedAt       time.Time `json:"created_at"`
+
+	// 关联关系
+	DirectManager *Employee `json:"direct_manager,omitempty" gorm:"foreignKey:DirectManagerID"`
+	EscalatedTo   *Employee `json:"escalated_to,omitempty" gorm:"foreignKey:EscalatedToID"`
+}
+
+// 周期考核自动开启配置
+type EvaluationSchedule struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Enabled     bool      `json:"enabled" gorm:"not null;default:false"`
+	DayOfPeriod int       `json:"day_of_period" gorm:"not null;default:1"` // 每个周期的第几天开启考核（从1开始，超出周期天数时取周期最后一天）
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// DefaultEvaluationSchedule 返回默认周期考核自动开启配置
+func DefaultEvaluationSchedule() EvaluationSchedule {
+	return EvaluationSchedule{
+		Enabled:     false,
+		DayOfPeriod: 1,
+	}
+}
+
+// 周期考核自动开启运行记录
+type EvaluationScheduleRun struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	TemplateID   uint      `json:"template_id" gorm:"index"`
+	Period       string    `json:"period"` // monthly, quarterly, yearly
+	Year         int       `json:"year"`
+	Month        *int      `json:"month,omitempty"`
+	Quarter      *int      `json:"quarter,omitempty"`
+	Trigger      string    `json:"trigger"` // schedule: 按计划, catch_up: 服务重启后补开
+	Status       string    `json:"status"`  // success, partial, failed
+	CreatedCount int       `json:"created_count"`
+	SkippedCount int       `json:"skipped_count"`
+	FailedCount  int       `json:"failed_count"`
+	Message      string    `json:"message"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	// 关联关系
+	Template KPITemplate `json:"template,omitempty" gorm:"foreignKey:TemplateID"`
+}
+
+// OKR目标，归属员工或部门，周期与考核周期一致
+type Objective struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	Title        string    `json:"title" gorm:"not null"`
+	Description  string    `json:"description"`
+	OwnerType    string    `json:"owner_type" gorm:"index"` // employee, department
+	EmployeeID   *uint     `json:"employee_id,omitempty" gorm:"index"`
+	DepartmentID *uint     `json:"department_id,omitempty" gorm:"index"`
+	Period       string    `json:"period"` // monthly, quarterly, yearly
+	Year         int       `json:"year"`
+	Month        *int      `json:"month,omitempty"`
+	Quarter      *int      `json:"quarter,omitempty"`
+	Progress     float64   `json:"progress"` // 各关键结果完成率的平均值（0-100，超额完成时可超过100）
+	CreatedByID  uint      `json:"created_by_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+
+	// 关联关系
+	Employee   *Employee   `json:"employee,omitempty" gorm:"foreignKey:EmployeeID"`
+	Department *Department `json:"department,omitempty" gorm:"foreignKey:DepartmentID"`
+	CreatedBy  *Employee   `json:"created_by,omitempty" gorm:"foreignKey:CreatedByID"`
+	KeyResults []KeyResult `json:"key_results,omitempty" gorm:"foreignKey:ObjectiveID"`
+}
+
+// OKR关键结果，完成率 = (当前值 - 起始值) / (目标值 - 起始值)
+type KeyResult struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	ObjectiveID  uint      `json:"objective_id" gorm:"index"`
+	Title        string    `json:"title" gorm:"not null"`
+	StartValue   float64   `json:"start_value"`
+	TargetValue  float64   `json:"target_value"`
+	CurrentValue float64   `json:"current_value"`
+	Unit         string    `json:"unit"`
+	Progress     float64   `json:"progress"`                 // 完成率（0-100，超额完成时可超过100）
+	Confidence   int       `json:"confidence"`               // 信心指数（0-10），随每次进展更新
+	LinkedItemID *uint     `json:"linked_item_id,omitempty"` // 关联的量化考核项目，创建评估时按完成率计入该项目的实际完成值
+	Order        int       `json:"order"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+
+	// 关联关系
+	LinkedItem *KPIItem           `json:"linked_item,omitempty" gorm:"foreignKey:LinkedItemID"`
+	CheckIns   []KeyResultCheckIn `json:"check_ins,omitempty" gorm:"foreignKey:KeyResultID"`
+}
+
+// 关键结果进展更新记录
+type KeyResultCheckIn struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	KeyResultID uint      `json:"key_result_id" gorm:"index"`
+	Value       float64   `json:"value"`      // 更新后的当前值
+	Progress    float64   `json:"progress"`   // 更新后的完成率
+	Confidence  int       `json:"confidence"` // 更新时的信心指数
+	Note        string    `json:"note"`
+	CreatedByID uint      `json:"created_by_id"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// 关联关系
+	CreatedBy *Employee `json:"created_by,omitempty" gorm:"foreignKey:CreatedByID"`
+}
+
+// 目标设定阶段员工提出的个人目标：针对模板考核项目的目标，或额外增加的考核项目
+// 审批通过后写入对应评分记录的约定目标，额外考核项目同时创建考核项目和评分记录
+type EvaluationGoal struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	EvaluationID uint      `json:"evaluation_id" gorm:"index"`
+	ScoreID      *uint     `json:"score_id,omitempty"` // 针对的评分记录，为空表示额外考核项目（审批通过后指向新建的评分记录）
+	Extra        bool      `json:"extra"`              // 是否为额外增加的考核项目
+	Title        string    `json:"title"`              // 额外考核项目名称
+	Target       string    `json:"target"`             // 目标内容
+	MaxScore     float64   `json:"max_score"`          // 额外考核项目满分
+	Weight       float64   `json:"weight"`             // 额外考核项目权重
+	UpdatedByID  uint      `json:"updated_by_id"`      // 最后修改人（员工提出或上级修改）
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+
+	// 关联关系
+	UpdatedBy *Employee `json:"updated_by,omitempty" gorm:"foreignKey:UpdatedByID"`
+}
+
+// 绩效等级区间：得分落在 [MinScore, MaxScore) 内即为该等级，最高等级包含上限
+// TemplateID 为空表示组织默认等级，模板配置了等级区间时优先使用模板的等级区间
+type GradeBand struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	TemplateID *uint     `json:"template_id,omitempty" gorm:"index"`
+	Grade      string    `json:"grade" gorm:"not null"` // 等级代码，如 S、A、B、C、D
+	Label      string    `json:"label"`                 // 等级名称，如 卓越、优秀
+	MinScore   float64   `json:"min_score"`
+	MaxScore   float64   `json:"max_score"`
+	Order      int       `json:"order"` // 从高到低排列
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// DefaultGradeBands 返回组织默认绩效等级区间
+func DefaultGradeBands() []GradeBand {
+	return []GradeBand{
+		{Grade: "S", Label: "卓越", MinScore: 90, MaxScore: 100, Order: 1},
+		{Grade: "A", Label: "优秀", MinScore: 80, MaxScore: 90, Order: 2},
+		{Grade: "B", Label: "良好", MinScore: 70, MaxScore: 80, Order: 3},
+		{Grade: "C", Label: "合格", MinScore: 60, MaxScore: 70, Order: 4},
+		{Grade: "D", Label: "待改进", MinScore: 0, MaxScore: 60, Order: 5},
+	}
+}
+
+// 强制分布配额：限制部门内各绩效等级的人数占比
+// DepartmentID 为空表示适用于所有部门，Period/Year/Month/Quarter 为空表示适用于所有考核周期，同时匹配多条时使用最具体的一条
+type DistributionQuota struct {
+	ID           uint                `json:"id" gorm:"primaryKey"`
+	Name         string              `json:"name"`
+	DepartmentID *uint               `json:"department_id,omitempty" gorm:"index"`
+	Period       string              `json:"period"` // monthly, quarterly, yearly，为空表示所有周期类型
+	Year         *int                `json:"year,omitempty"`
+	Month        *int                `json:"month,omitempty"`
+	Quarter      *int                `json:"quarter,omitempty"`
+	Limits       []DistributionLimit `json:"limits" gorm:"serializer:json"`
+	Enforcement  string              `json:"enforcement" gorm:"default:warn"` // warn: 超出配额时提示, block: 超出配额时禁止进入待确认
+	CreatedAt    time.Time           `json:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+
+	// 关联关系
+	Department *Department `json:"department,omitempty" gorm:"foreignKey:DepartmentID"`
+}
+
+// 单个绩效等级的人数占比限制（百分比，为空表示不限制）
+type DistributionLimit struct {
+	Grade      string   `json:"grade"`
+	MaxPercent *float64 `json:"max_percent,omitempty"` // 最多占比，如最高等级不超过20%
+	MinPercent *float64 `json:"min_percent,omitempty"` // 最少占比，如最低等级不少于5%
+}
+
+// 校准会议：结果发布前由HR和部门负责人集中校准一组评估的得分
+// 会议中先提出调整建议，提交时在同一事务中将全部调整写入HR评分
+type CalibrationSession struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	Name          string     `json:"name" gorm:"not null"`
+	Description   string     `json:"description"`
+	Status        string     `json:"status" gorm:"default:open"` // open: 进行中, committed: 已提交, cancelled: 已取消
+	CreatedByID   uint       `json:"created_by_id"`
+	CommittedByID *uint      `json:"committed_by_id,omitempty"`
+	CommittedAt   *time.Time `json:"committed_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	// 关联关系
+	CreatedBy   *Employee               `json:"created_by,omitempty" gorm:"foreignKey:CreatedByID"`
+	CommittedBy *Employee               `json:"committed_by,omitempty" gorm:"foreignKey:CommittedByID"`
+	Evaluations []CalibrationEvaluation `json:"evaluations,omitempty" gorm:"foreignKey:SessionID"`
+	Adjustments []CalibrationAdjustment `json:"adjustments,omitempty" gorm:"foreignKey:SessionID"`
+}
+
+// 校准会议包含的评估，提交时记录校准前后的总分和等级
+type CalibrationEvaluation struct {
+	ID           uint     `json:"id" gorm:"primaryKey"`
+	SessionID    uint     `json:"session_id" gorm:"index"`
+	EvaluationID uint     `json:"evaluation_id" gorm:"index"`
+	BeforeScore  *float64 `json:"before_score,omitempty"`
+	BeforeGrade  string   `json:"before_grade"`
+	AfterScore   *float64 `json:"after_score,omitempty"`
+	AfterGrade   string   `json:"after_grade"`
+
+	// 关联关系
+	Evaluation *KPIEvaluation `json:"evaluation,omitempty" gorm:"foreignKey:EvaluationID"`
+}
+
+// 校准调整建议：将某个考核项目的HR评分调整为建议分数，每条调整都必须说明理由
+type CalibrationAdjustment struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	SessionID     uint      `json:"session_id" gorm:"index"`
+	EvaluationID  uint      `json:"evaluation_id" gorm:"index"`
+	ScoreID       uint      `json:"score_id"`
+	ProposedScore float64   `json:"proposed_score"`
+	Justification string    `json:"justification" gorm:"not null"`
+	PreviousScore *float64  `json:"previous_score,omitempty"` // 提交时该项目原有的HR评分
+	ProposedByID  uint      `json:"proposed_by_id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+
+	// 关联关系
+	ProposedBy *Employee `json:"proposed_by,omitempty" gorm:"foreignKey:ProposedByID"`
+}
+
+// 审批链：主管评分后、HR审核前依次经过的审批步骤，可按模板和/或部门配置
+// 模板和部门都为空表示组织默认审批链
+type ApprovalChain struct {
+	ID           uint           `json:"id" gorm:"primaryKey"`
+	Name         string         `json:"name" gorm:"not null"`
+	TemplateID   *uint          `json:"template_id,omitempty" gorm:"index"`
+	DepartmentID *uint          `json:"department_id,omitempty" gorm:"index"`
+	Steps        []ApprovalStep `json:"steps" gorm:"serializer:json"`
+	IsActive     bool           `json:"is_active" gorm:"default:true"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+
+	// 关联关系
+	Template   *KPITemplate `json:"template,omitempty" gorm:"foreignKey:TemplateID"`
+	Department *Department  `json:"department,omitempty" gorm:"foreignKey:DepartmentID"`
+}
+
+// 审批步骤：按与被评估员工的关系或按角色确定审批人
+type ApprovalStep struct {
+	Name     string `json:"name"`
+	Resolver string `json:"resolver"`       // manager: 直属上级, manager_of_manager: 上级的上级, department_head: 部门负责人, role: 指定角色
+	Role     string `json:"role,omitempty"` // resolver 为 role 时的角色
+	Action   string `json:"action"`         // score: 评分, approve: 审批
+}
+
+// 评估审批记录：评估进入审批链时按步骤生成，记录每一步的审批人和处理结果
+type EvaluationApproval struct {
+	ID           uint                `json:"id" gorm:"primaryKey"`
+	EvaluationID uint                `json:"evaluation_id" gorm:"index"`
+	ChainID      uint                `json:"chain_id"`
+	Round        int                 `json:"round"` // 第几轮审批，退回后重新提交主管评分时开始新一轮
+	StepOrder    int                 `json:"step_order"`
+	StepName     string              `json:"step_name"`
+	Resolver     string              `json:"resolver"`
+	Role         string              `json:"role,omitempty"`
+	Action       string              `json:"action"`
+	ApproverIDs  []uint              `json:"approver_ids" gorm:"serializer:json"`          // 进入审批链时确定的审批人
+	Status       string              `json:"status" gorm:"index;default:waiting"`          // waiting: 未开始, pending: 待处理, approved: 已通过, returned: 已退回, skipped: 无审批人已跳过, cancelled: 已取消
+	ItemScores   []ApprovalItemScore `json:"item_scores,omitempty" gorm:"serializer:json"` // 评分步骤的各项目评分
+	Score        *float64            `json:"score,omitempty"`                              // 评分步骤按计分方式计算的总分
+	Comment      string              `json:"comment"`
+	ActedByID    *uint               `json:"acted_by_id,omitempty"`
+	OnBehalfOfID *uint               `json:"on_behalf_of_id,omitempty"` // 受托人代审批人处理时为审批人
+	ActedAt      *time.Time          `json:"acted_at,omitempty"`
+	CreatedAt    time.Time           `json:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+
+	// 关联关系
+	Evaluation *KPIEvaluation `json:"evaluation,omitempty" gorm:"foreignKey:EvaluationID"`
+	ActedBy    *Employee      `json:"acted_by,omitempty" gorm:"foreignKey:ActedByID"`
+}
+
+// 评分步骤中单个考核项目的评分
+type ApprovalItemScore struct {
+	ScoreID uint    `json:"score_id"`
+	Score   float64 `json:"score"`
+}
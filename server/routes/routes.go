@@ -93,13 +93,74 @@ func SetupRoutes(r *gin.RouterGroup) {
 			templateRoutes.PUT("/:id", handlers.RoleMiddleware("hr", "manager"), handlers.UpdateTemplate)
 			templateRoutes.DELETE("/:id", handlers.RoleMiddleware("hr"), handlers.DeleteTemplate)
 			templateRoutes.GET("/:id/items", handlers.GetTemplateItems)
+			templateRoutes.GET("/:id/versions", handlers.GetTemplateVersions)
+			templateRoutes.POST("/:id/versions", handlers.RoleMiddleware("hr"), handlers.PublishTemplateVersion)
+			templateRoutes.GET("/:id/versions/diff", handlers.GetTemplateVersionDiff)
+			templateRoutes.GET("/:id/versions/:version", handlers.GetTemplateVersion)
+			templateRoutes.GET("/:id/assignments", handlers.GetTemplateAssignments)
+			templateRoutes.PUT("/:id/assignments", handlers.RoleMiddleware("hr"), handlers.UpdateTemplateAssignments)
 		}
 
 		// 绩效规则管理（仅HR）
 		performanceRuleRoutes := protected.Group("/performance-rules")
 		{
 			performanceRuleRoutes.GET("", handlers.RoleMiddleware("hr"), handlers.GetPerformanceRule)
-			performanceRuleRoutes.PUT("", handlers.RoleMiddleware("hr"), handlers.UpdatePerformanceRule)
+			performanceRuleRoutes.PUT("", handlers.RoleMiddleware("hr"), handlers.UpdatePerformanceRule)          // 组织默认规则
+			performanceRuleRoutes.POST("", handlers.RoleMiddleware("hr"), handlers.CreatePerformanceRule)         // 按模板和/或部门配置的规则
+			performanceRuleRoutes.GET("/resolve", handlers.RoleMiddleware("hr"), handlers.ResolvePerformanceRule) // 查询模板和部门适用的规则
+			performanceRuleRoutes.PUT("/:id", handlers.RoleMiddleware("hr"), handlers.UpdateScopedPerformanceRule)
+			performanceRuleRoutes.GET("/:id/versions", handlers.RoleMiddleware("hr"), handlers.GetPerformanceRuleVersions) // 规则的权重版本
+			performanceRuleRoutes.DELETE("/:id", handlers.RoleMiddleware("hr"), handlers.DeletePerformanceRule)
+		}
+
+		// 绩效等级区间（所有用户可读取，仅HR可修改）
+		gradeBandRoutes := protected.Group("/grade-bands")
+		{
+			gradeBandRoutes.GET("", handlers.GetGradeBands)
+			gradeBandRoutes.PUT("", handlers.RoleMiddleware("hr"), handlers.UpdateGradeBands)
+		}
+
+		// 部门强制分布配额（仅HR维护，HR和主管可检查分布情况）
+		distributionRoutes := protected.Group("/distribution-quotas")
+		{
+			distributionRoutes.GET("", handlers.RoleMiddleware("hr"), handlers.GetDistributionQuotas)
+			distributionRoutes.POST("", handlers.RoleMiddleware("hr"), handlers.CreateDistributionQuota)
+			distributionRoutes.GET("/check", handlers.RoleMiddleware("hr", "manager"), handlers.CheckDistribution)
+			distributionRoutes.PUT("/:id", handlers.RoleMiddleware("hr"), handlers.UpdateDistributionQuota)
+			distributionRoutes.DELETE("/:id", handlers.RoleMiddleware("hr"), handlers.DeleteDistributionQuota)
+		}
+
+		// 审批链配置（仅HR维护），待当前用户处理的审批步骤
+		approvalRoutes := protected.Group("/approval-chains")
+		{
+			approvalRoutes.GET("", handlers.RoleMiddleware("hr"), handlers.GetApprovalChains)
+			approvalRoutes.POST("", handlers.RoleMiddleware("hr"), handlers.CreateApprovalChain)
+			approvalRoutes.PUT("/:id", handlers.RoleMiddleware("hr"), handlers.UpdateApprovalChain)
+			approvalRoutes.DELETE("/:id", handlers.RoleMiddleware("hr"), handlers.DeleteApprovalChain)
+		}
+		protected.GET("/approvals/pending", handlers.GetPendingApprovals)
+
+		// 校准会议（HR和部门负责人）
+		calibrationRoutes := protected.Group("/calibrations")
+		calibrationRoutes.Use(handlers.RoleMiddleware("hr", "manager"))
+		{
+			calibrationRoutes.GET("", handlers.GetCalibrationSessions)
+			calibrationRoutes.POST("", handlers.RoleMiddleware("hr"), handlers.CreateCalibrationSession)
+			calibrationRoutes.GET("/:id", handlers.GetCalibrationSession)
+			calibrationRoutes.DELETE("/:id", handlers.RoleMiddleware("hr"), handlers.CancelCalibrationSession)
+			calibrationRoutes.POST("/:id/adjustments", handlers.SaveCalibrationAdjustment)
+			calibrationRoutes.DELETE("/:id/adjustments/:adjustment_id", handlers.DeleteCalibrationAdjustment)
+			calibrationRoutes.POST("/:id/commit", handlers.RoleMiddleware("hr"), handlers.CommitCalibrationSession)
+		}
+
+		// 周期考核自动开启（仅HR）
+		scheduleRoutes := protected.Group("/evaluation-schedule")
+		scheduleRoutes.Use(handlers.RoleMiddleware("hr"))
+		{
+			scheduleRoutes.GET("", handlers.GetEvaluationSchedule)
+			scheduleRoutes.PUT("", handlers.UpdateEvaluationSchedule)
+			scheduleRoutes.GET("/preview", handlers.PreviewEvaluationSchedule) // 预览（不创建数据）
+			scheduleRoutes.GET("/runs", handlers.GetEvaluationScheduleRuns)    // 运行记录
 		}
 
 		// KPI考核项目管理（HR和管理员）
@@ -116,9 +177,25 @@ func SetupRoutes(r *gin.RouterGroup) {
 		{
 			evaluationRoutes.GET("", handlers.GetEvaluations)
 			evaluationRoutes.POST("", handlers.RoleMiddleware("hr", "manager"), handlers.CreateEvaluation)
+			evaluationRoutes.POST("/batch", handlers.RoleMiddleware("hr"), handlers.BatchCreateEvaluations)                   // 按部门/员工批量创建评估
+			evaluationRoutes.GET("/duplicates", handlers.RoleMiddleware("hr"), handlers.GetDuplicateEvaluations)              // 重复评估检测报告
+			evaluationRoutes.POST("/duplicates/resolve", handlers.RoleMiddleware("hr"), handlers.ResolveDuplicateEvaluations) // 合并或删除重复评估
 			evaluationRoutes.GET("/:id", handlers.GetEvaluation)
 			evaluationRoutes.PUT("/:id", handlers.UpdateEvaluation)
 			evaluationRoutes.DELETE("/:id", handlers.RoleMiddleware("hr"), handlers.DeleteEvaluation)
+			evaluationRoutes.GET("/:id/actions", handlers.GetEvaluationActions)                                       // 当前用户可执行的流程操作
+			evaluationRoutes.GET("/:id/history", handlers.GetEvaluationHistory)                                       // 评估及评分变更历史
+			evaluationRoutes.GET("/:id/applied-rule", handlers.GetEvaluationAppliedRule)                              // 计算HR评分采用的绩效规则版本
+			evaluationRoutes.POST("/:id/reopen", handlers.RoleMiddleware("hr"), handlers.ReopenEvaluation)            // 重新打开已完成的评估
+			evaluationRoutes.POST("/:id/rollback", handlers.RoleMiddleware("hr"), handlers.RollbackEvaluation)        // 退回到更早阶段
+			evaluationRoutes.GET("/:id/escalations", handlers.GetEvaluationEscalations)                               // 主管评分超时升级记录
+			evaluationRoutes.PUT("/:id/deadlines", handlers.RoleMiddleware("hr"), handlers.UpdateEvaluationDeadlines) // 调整各阶段截止时间
+			evaluationRoutes.PUT("/:id/scores", handlers.BulkUpdateEvaluationScores)                                  // 批量保存或提交某一评分身份的全部评分
+			evaluationRoutes.GET("/:id/objectives", handlers.GetEvaluationObjectives)                                 // 与评估周期重叠的OKR目标
+			evaluationRoutes.GET("/:id/goals", handlers.GetEvaluationGoals)                                           // 目标设定阶段约定的目标
+			evaluationRoutes.PUT("/:id/goals", handlers.UpdateEvaluationGoals)                                        // 员工提出或上级修改目标（审批通过后锁定）
+			evaluationRoutes.GET("/:id/approvals", handlers.GetEvaluationApprovals)                                   // 审批链各步骤的审批记录
+			evaluationRoutes.POST("/:id/approvals", handlers.ActOnEvaluationApproval)                                 // 审批人通过（含评分）或退回当前审批步骤
 			evaluationRoutes.GET("/employee/:employeeId", handlers.GetEmployeeEvaluations)
 			evaluationRoutes.GET("/pending/:employeeId", handlers.GetPendingEvaluations)
 			evaluationRoutes.GET("/pending/count", handlers.GetPendingCountEvaluations)
@@ -139,6 +216,31 @@ func SetupRoutes(r *gin.RouterGroup) {
 			evaluationRoutes.PUT("/:id/objection/handle", handlers.RoleMiddleware("hr"), handlers.HandleObjection) // HR处理异议
 		}
 
+		// 评审委托（主管请假期间委托他人代为评分）
+		delegationRoutes := protected.Group("/delegations")
+		{
+			delegationRoutes.GET("", handlers.GetDelegations)
+			delegationRoutes.POST("", handlers.RoleMiddleware("manager", "hr"), handlers.CreateDelegation)
+			delegationRoutes.DELETE("/:id", handlers.DeleteDelegation)
+		}
+
+		// OKR目标与关键结果（维护权限检查在函数内部）
+		objectiveRoutes := protected.Group("/objectives")
+		{
+			objectiveRoutes.GET("", handlers.GetObjectives)
+			objectiveRoutes.POST("", handlers.CreateObjective)
+			objectiveRoutes.GET("/:id", handlers.GetObjective)
+			objectiveRoutes.PUT("/:id", handlers.UpdateObjective)
+			objectiveRoutes.DELETE("/:id", handlers.DeleteObjective)
+			objectiveRoutes.POST("/:id/key-results", handlers.CreateKeyResult)
+		}
+		keyResultRoutes := protected.Group("/key-results")
+		{
+			keyResultRoutes.PUT("/:id", handlers.UpdateKeyResult)
+			keyResultRoutes.DELETE("/:id", handlers.DeleteKeyResult)
+			keyResultRoutes.POST("/:id/check-ins", handlers.CreateKeyResultCheckIn) // 更新进展
+		}
+
 		// 邀请评分管理
 		invitationRoutes := protected.Group("/invitations")
 		{
@@ -166,9 +268,10 @@ func SetupRoutes(r *gin.RouterGroup) {
 		{
 			scoreRoutes.GET("/evaluation/:evaluationId", handlers.GetEvaluationScores)
 			scoreRoutes.PUT("/:id/self", handlers.UpdateSelfScore)
-			scoreRoutes.PUT("/:id/manager", handlers.RoleMiddleware("manager", "hr"), handlers.UpdateManagerScore)
+			scoreRoutes.PUT("/:id/manager", handlers.UpdateManagerScore) // 主管、HR及受托人/升级接收人（权限检查在函数内部）
 			scoreRoutes.PUT("/:id/hr", handlers.RoleMiddleware("hr"), handlers.UpdateHRScore)
 			scoreRoutes.PUT("/:id/final", handlers.RoleMiddleware("hr"), handlers.UpdateFinalScore)
+			scoreRoutes.PUT("/:id/actual", handlers.UpdateActualValue) // 量化指标实际完成值，评估相关人员均可录入（权限检查在函数内部）
 		}
 
 		// 统计分析（所有认证用户）